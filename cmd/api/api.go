@@ -20,6 +20,7 @@ import (
 	"github.com/n-korel/social-api/internal/auth"
 	"github.com/n-korel/social-api/internal/env"
 	"github.com/n-korel/social-api/internal/mailer"
+	"github.com/n-korel/social-api/internal/media"
 	"github.com/n-korel/social-api/internal/ratelimiter"
 	"github.com/n-korel/social-api/internal/service"
 	"github.com/n-korel/social-api/internal/store"
@@ -42,11 +43,49 @@ type config struct {
 	db          dbConfig
 	env         string
 	apiURL      string
+	baseURL     string
 	mail        mailConfig
 	frontendURL string
 	auth        authConfig
 	redisCfg    redisConfig
 	rateLimiter ratelimiter.Config
+	sweeper     sweeperConfig
+	timeline    timelineConfig
+	search      searchConfig
+	profile     profileConfig
+	media       mediaConfig
+	comments    commentsConfig
+}
+
+type mediaConfig struct {
+	// local or s3
+	storage       string
+	localDir      string
+	s3            media.S3Config
+	maxUploadSize int64
+	maxDimension  int
+	thumbnailSize int
+}
+
+type profileConfig struct {
+	usernameChangeCooldown time.Duration
+	emailChangeExp         time.Duration
+}
+
+type commentsConfig struct {
+	// Deepest reply level, 0 disables replies
+	maxDepth int
+}
+
+type searchConfig struct {
+	// Postgres text search configuration, e.g. english or russian
+	language string
+}
+
+type timelineConfig struct {
+	length             int
+	fanoutMaxFollowers int
+	ranking            store.FeedRanking
 }
 
 type redisConfig struct {
@@ -57,14 +96,50 @@ type redisConfig struct {
 }
 
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic            basicConfig
+	token            tokenConfig
+	passwordResetExp time.Duration
+	mfa              mfaConfig
+	loginGuard       loginGuardConfig
+	oidc             oidcConfig
+}
+
+type oidcConfig struct {
+	providers []oidcProviderConfig
+	stateExp  time.Duration
+}
+
+type oidcProviderConfig struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	trustEmail   bool
+}
+
+type loginGuardConfig struct {
+	maxFailures     int
+	baseDelay       time.Duration
+	maxDelay        time.Duration
+	lockoutDuration time.Duration
+	window          time.Duration
+}
+
+type mfaConfig struct {
+	issuer            string
+	challengeExp      time.Duration
+	requiredRoleLevel int
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	host   string
+	secret     string
+	exp        time.Duration
+	refreshExp time.Duration
+	host       string
+	// PEM files. When signingKey is set tokens are signed with RS256/EdDSA instead of the HS256 secret
+	signingKey string
+	verifyKeys []string
 }
 
 type basicConfig struct {
@@ -112,6 +187,7 @@ func (app *application) mount() http.Handler {
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
+		r.Get("/.well-known/jwks.json", app.jwksHandler)
 		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
@@ -119,39 +195,141 @@ func (app *application) mount() http.Handler {
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.requireScope(service.ScopePostsWrite)).Post("/", app.createPostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.With(app.requireScope(service.ScopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(service.ScopePostsRead)).Get("/comments", app.getCommentsHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireScope(service.ScopePostsWrite))
+					r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+					r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+
+					r.Post("/comments", app.createCommentHandler)
+					r.Patch("/comments/{commentID}", app.checkCommentOwnership("moderator", app.updateCommentHandler))
+					r.Delete("/comments/{commentID}", app.checkCommentOwnership("admin", app.deleteCommentHandler))
+				})
 			})
 		})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler)
+		r.Route("/media", func(r chi.Router) {
+			r.With(app.optionalAuth).Get("/{mediaID}", app.getMediaHandler)
+			r.With(app.optionalAuth).Get("/{mediaID}/thumbnail", app.getMediaThumbnailHandler)
 
-			r.Route("/{userID}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireScope(service.ScopePostsWrite))
+				r.Post("/", app.uploadMediaHandler)
+				r.Delete("/{mediaID}", app.deleteMediaHandler)
+			})
+		})
 
-				r.Get("/", app.getUserHandler)
+		r.Route("/users", func(r chi.Router) {
+			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Post("/activate/resend", app.resendActivationHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
 
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireSession)
+
+				r.Get("/", app.getCurrentUserHandler)
+				r.Patch("/", app.updateProfileHandler)
+				r.Put("/email", app.requestEmailChangeHandler)
+				r.Put("/avatar", app.uploadAvatarHandler)
+
+				r.Route("/follow-requests", func(r chi.Router) {
+					r.Get("/", app.getFollowRequestsHandler)
+					r.Put("/{userID}/accept", app.acceptFollowRequestHandler)
+					r.Put("/{userID}/reject", app.rejectFollowRequestHandler)
+				})
+
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", app.listAPITokensHandler)
+					r.Post("/", app.createAPITokenHandler)
+					r.Delete("/{tokenID}", app.revokeAPITokenHandler)
+				})
+
+				r.Route("/mfa/totp", func(r chi.Router) {
+					r.Post("/", app.enrollTOTPHandler)
+					r.Post("/confirm", app.confirmTOTPHandler)
+					r.Delete("/", app.disableTOTPHandler)
+				})
+			})
 
+			r.Route("/{userID}", func(r chi.Router) {
+				r.Get("/feed.atom", app.getUserAtomFeedHandler)
+				r.Get("/feed.rss", app.getUserRSSFeedHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.requireScope(service.ScopeUsersRead))
+						r.Get("/", app.getUserHandler)
+						r.Get("/followers", app.getFollowersHandler)
+						r.Get("/following", app.getFollowingHandler)
+					})
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.requireScope(service.ScopeUsersWrite))
+						r.Put("/follow", app.followUserHandler)
+						r.Put("/unfollow", app.unfollowUserHandler)
+						r.Put("/block", app.blockUserHandler)
+						r.Delete("/block", app.unblockUserHandler)
+						r.Put("/mute", app.muteUserHandler)
+						r.Delete("/mute", app.unmuteUserHandler)
+					})
+				})
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireScope(service.ScopeFeedRead))
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 
 		})
 
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireScope(service.ScopePostsRead))
+
+			r.Get("/explore", app.exploreHandler)
+			r.Get("/search", app.searchHandler)
+			r.Get("/tags/trending", app.getTrendingTagsHandler)
+			r.Get("/tags/{tag}/posts", app.getTagPostsHandler)
+		})
+
+		r.Get("/tags/{tag}/feed.atom", app.getTagAtomFeedHandler)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireSession)
+			r.Use(app.requireRole("admin"))
+
+			r.Post("/users/{userID}/unlock", app.unlockUserHandler)
+		})
+
 		// Public routes
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+			r.Post("/mfa/enroll", app.startMFAEnrollmentHandler)
+			r.Post("/mfa/verify", app.verifyMFAHandler)
+			r.Get("/oidc/{provider}/login", app.oidcLoginHandler)
+			r.Get("/oidc/{provider}/callback", app.oidcCallbackHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireSession)
+				r.Post("/logout", app.logoutHandler)
+				r.Post("/logout/all", app.logoutAllHandler)
+			})
 		})
 	})
 
@@ -172,6 +350,14 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// Background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	if app.config.sweeper.enabled {
+		go app.runInvitationSweeper(jobsCtx)
+	}
+
 	// SERVER SHUTDOWN
 	shutdown := make(chan error)
 
@@ -186,7 +372,14 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Infow("Signal caught", "signal", s.String())
 
-		shutdown <- server.Shutdown(ctx)
+		stopJobs()
+		if err := server.Shutdown(ctx); err != nil {
+			shutdown <- err
+			return
+		}
+
+		// Requests are done, but emails they started may still be sending
+		shutdown <- app.services.Shutdown(ctx)
 	}()
 
 	app.logger.Infow("Server has started", "addd", app.config.addr, "env", app.config.env)
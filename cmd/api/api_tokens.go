@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+type CreateAPITokenPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=posts:read posts:write feed:read users:read users:write"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,gte=1,lte=365"`
+}
+
+// APITokenResponse carries the plain API key, which is only returned on creation
+type APITokenResponse struct {
+	store.APIToken
+	Token string `json:"token"`
+}
+
+// CreateAPIToken godoc
+//
+//	@Summary		Create API key
+//	@Description	Create a personal API key with the given scopes. The key is only shown once.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateAPITokenPayload	true	"API key name and scopes"
+//	@Success		201		{object}	APITokenResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens [post]
+func (app *application) createAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateAPITokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	expiresIn := time.Duration(payload.ExpiresInDays) * 24 * time.Hour
+	token, plainToken, err := app.services.APITokens.CreateToken(ctx, user.ID, payload.Name, payload.Scopes, expiresIn)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	response := APITokenResponse{
+		APIToken: *token,
+		Token:    plainToken,
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ListAPITokens godoc
+//
+//	@Summary		List API keys
+//	@Description	List the personal API keys of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{array}		store.APIToken
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens [get]
+func (app *application) listAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	tokens, err := app.services.APITokens.ListTokens(ctx, user.ID)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RevokeAPIToken godoc
+//
+//	@Summary		Revoke API key
+//	@Description	Revoke a personal API key of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Param			tokenID	path		int		true	"API key ID"
+//	@Success		204		{string}	string	"API key revoked"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens/{tokenID} [delete]
+func (app *application) revokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil || tokenID < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.APITokens.RevokeToken(ctx, user.ID, tokenID); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
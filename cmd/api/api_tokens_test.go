@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	apiKey := service.APITokenPrefix + "test"
+
+	mockAPITokenService := app.services.APITokens.(*service.MockAPITokenService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+
+	mockAPITokenService.On("ValidateToken", mock.Anything, apiKey).Return(&service.TokenClaims{
+		UserID:     1,
+		APITokenID: 1,
+		Scopes:     []string{service.ScopeUsersRead},
+	}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+	mockUserService.On("GetFollowStats", mock.Anything, int64(1), int64(1)).Return(&store.FollowStats{}, nil)
+
+	t.Run("Allow routes within the granted scopes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Forbid routes outside the granted scopes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(`{"title":"t","content":"c"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Forbid API keys from managing API keys", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/tokens", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Never validate API keys as JWTs", func(t *testing.T) {
+		app := newTestApplication(t, config{})
+		mux := app.mount()
+
+		mockAuthService := app.services.Auth.(*service.MockAuthService)
+		mockAPITokenService := app.services.APITokens.(*service.MockAPITokenService)
+
+		mockAPITokenService.On("ValidateToken", mock.Anything, apiKey).Return(nil, service.ErrInvalidToken)
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, w.Code)
+		mockAPITokenService.AssertExpectations(t)
+		mockAuthService.AssertNotCalled(t, "ValidateToken", mock.Anything, mock.Anything)
+	})
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"errors"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/n-korel/social-api/internal/auth"
+	"github.com/n-korel/social-api/internal/service"
 )
 
+type tokenKey string
+
+const tokenCtx tokenKey = "token"
+
 type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,max=100"`
 	Email    string `json:"email" validate:"required,email,max=255"`
@@ -67,6 +77,22 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func newTokenResponse(pair *service.TokenPair) TokenResponse {
+	return TokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(pair.ExpiresAt).Seconds()),
+	}
+}
+
 type CreateUserTokenPayload struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
@@ -75,14 +101,16 @@ type CreateUserTokenPayload struct {
 // createTokenHandler godoc
 //
 //	@Summary		Creates a token
-//	@Description	Creates a token for a user
+//	@Description	Creates an access token and a refresh token for a user
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@Success		200		{string}	string					"Token"
+//	@Success		201		{object}	TokenResponse			"Token pair"
+//	@Success		202		{object}	MFAChallengeResponse	"Second factor required"
 //	@Failure		400		{object}	error
 //	@Failure		401		{object}	error
+//	@Failure		429		{object}	error	"Too many failed logins"
 //	@Failure		500		{object}	error
 //	@Router			/authentication/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -101,18 +129,256 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	ctx := r.Context()
 
 	// Service layer
-	token, err := app.services.Auth.CreateToken(
+	tokens, challenge, err := app.services.Auth.CreateToken(
 		ctx,
 		payload.Email,
 		payload.Password,
+		clientIP(r),
 	)
 	if err != nil {
 		app.handleServiceError(w, r, err)
 		return
 	}
 
+	// The password was right, but a second factor is needed to get tokens
+	if challenge != nil {
+		if err := app.jsonResponse(w, http.StatusAccepted, newMFAChallengeResponse(challenge)); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
 	// Send it to Client
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+	if err := app.jsonResponse(w, http.StatusCreated, newTokenResponse(tokens)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new token pair. Refresh tokens are one-time use
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		201		{object}	TokenResponse		"Token pair"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	tokens, err := app.services.Auth.RefreshToken(ctx, payload.RefreshToken)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, newTokenResponse(tokens)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"max=255"`
+}
+
+// logoutHandler godoc
+//
+//	@Summary		Log out
+//	@Description	Revokes the current access token and the session of the given refresh token
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		LogoutPayload	false	"Refresh token of the session"
+//	@Success		204		{string}	string			"Logged out"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	// Body is optional: without it only the access token is revoked
+	var payload LogoutPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if err := Validate.Struct(payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	claims := getTokenClaimsFromCtx(r)
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Auth.Logout(ctx, claims, payload.RefreshToken); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAllHandler godoc
+//
+//	@Summary		Log out everywhere
+//	@Description	Revokes every access token, refresh token and API key of the current user
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		204	{string}	string	"Logged out everywhere"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout/all [post]
+func (app *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Auth.LogoutAll(ctx, user.ID); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Request password reset
+//	@Description	Emails a one-time password reset link in the background. The response is the same, and as fast, whether the email exists or not
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordPayload	true	"Account email"
+//	@Success		202		{string}	string					"Reset requested"
+//	@Failure		400		{object}	error
+//	@Router			/authentication/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer. Failures only happen for existing accounts,
+	// so they are logged instead of being returned to the client
+	if err := app.services.Auth.ForgotPassword(ctx, payload.Email); err != nil {
+		app.logger.Errorw("Password reset failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Reset password
+//	@Description	Sets a new password using the emailed token and logs the user out everywhere
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		204		{string}	string					"Password reset"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Auth.ResetPassword(ctx, payload.Token, payload.Password); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jwksHandler godoc
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Public keys access tokens are signed with. Only available when asymmetric signing is configured
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JSONWebKeySet
+//	@Failure		404	{object}	error
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.authenticator.(auth.KeySetProvider)
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("tokens are not signed with asymmetric keys"))
+		return
+	}
+
+	// Verifiers expect the bare key set, not the data envelope
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, provider.KeySet()); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// clientIP is the remote address without its port, RealIP has already applied proxy headers
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func getTokenClaimsFromCtx(r *http.Request) *service.TokenClaims {
+	claims, _ := r.Context().Value(tokenCtx).(*service.TokenClaims)
+	return claims
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BlockUser godoc
+//
+//	@Summary		Block user
+//	@Description	Block a user. Follows between both users are removed, they cannot follow each other
+//	@Description	and their posts and comments are hidden from each other.
+//	@Tags			users
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User blocked"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.BlockUser)
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblock user
+//	@Description	Unblock a user, follows removed by the block are not restored
+//	@Tags			users
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unblocked"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.UnblockUser)
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mute user
+//	@Description	Hide the posts of a user from the home feed. The muted user is not notified.
+//	@Tags			users
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User muted"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.MuteUser)
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmute user
+//	@Description	Show the posts of a muted user in the home feed again
+//	@Tags			users
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unmuted"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.UnmuteUser)
+}
+
+// relationAction applies action from the authenticated user to the user in the path
+func (app *application) relationAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, userID, otherID int64) error) {
+	user := getUserFromCtx(r)
+
+	otherID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := action(ctx, user.ID, otherID); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+	// Comment of the same post to reply to, omitted for a top level comment
+	ParentID int64 `json:"parent_id" validate:"gte=0"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CommentListResponse is the envelope of a page of comments
+type CommentListResponse struct {
+	Data       []store.Comment `json:"data"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// GetComments godoc
+//
+//	@Summary		Fetch comments
+//	@Description	Fetch the top level comments of a post, or the replies to parent_id, each with its number
+//	@Description	of direct replies. Pages are linked with next_cursor and an RFC 8288 Link header.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			parent_id	query		int		false	"Comment to list the replies of"
+//	@Param			sort		query		string	false	"Sort order (newest, oldest or top, default newest)"
+//	@Param			limit		query		int		false	"Limit (1-100, default 20)"
+//	@Param			cursor		query		string	false	"Cursor from next_cursor"
+//	@Success		200			{object}	CommentListResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+
+	query, err := store.CommentListQuery{Limit: 20, Sort: store.CommentSortNewest}.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(query); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := app.services.Posts.GetComments(ctx, postID, getUserFromCtx(r).ID, query)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set("Link", feedLink(r, page.NextCursor, "next"))
+	}
+
+	res := CommentListResponse{
+		Data:       page.Comments,
+		NextCursor: page.NextCursor,
+	}
+	if res.Data == nil {
+		res.Data = []store.Comment{}
+	}
+
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// CreateComment godoc
+//
+//	@Summary		Create comment
+//	@Description	Comment on a post or reply to one of its comments. Posts the user may not see answer 404
+//	@Description	like missing ones.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx := r.Context()
+
+	// Service layer
+	comment, err := app.services.Posts.CreateComment(ctx, postID, user.ID, payload.ParentID, payload.Content)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	comment.User = store.User{ID: user.ID, Username: user.Username}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// UpdateComment godoc
+//
+//	@Summary		Update comment
+//	@Description	Edit the content of a comment, which records when it was edited
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			payload		body		UpdateCommentPayload	true	"Comment payload"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	commentID, _ := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	comment, err := app.services.Posts.UpdateComment(ctx, postID, commentID, getUserFromCtx(r).ID, payload.Content)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// DeleteComment godoc
+//
+//	@Summary		Delete comment
+//	@Description	Delete a comment of a post. A comment with replies stays in the thread with its content cleared.
+//	@Tags			posts
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Success		204			{string}	string	"No Content"
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	commentID, _ := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Posts.DeleteComment(ctx, postID, commentID); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestComments(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockPostService := app.services.Posts.(*service.MockPostService)
+
+	user := &store.User{ID: 1, Username: "alice"}
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(user, nil)
+
+	t.Run("Creates a comment", func(t *testing.T) {
+		mockPostService.On("CreateComment", mock.Anything, int64(5), int64(1), int64(0), "nice").Return(&store.Comment{ID: 1, PostID: 5, UserID: 1, Content: "nice"}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/5/comments", bytes.NewBufferString(`{"content":"nice"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Replies to a comment", func(t *testing.T) {
+		mockPostService.On("CreateComment", mock.Anything, int64(5), int64(1), int64(4), "agreed").Return(&store.Comment{ID: 7, PostID: 5, UserID: 1, Content: "agreed"}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/5/comments", bytes.NewBufferString(`{"content":"agreed","parent_id":4}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Lists comments with a next page link", func(t *testing.T) {
+		query := store.CommentListQuery{Limit: 2, Sort: store.CommentSortTop, ParentID: 4}
+		mockPostService.On("GetComments", mock.Anything, int64(5), int64(1), query).Return(&service.CommentPage{
+			Comments:   []store.Comment{{ID: 8}, {ID: 9}},
+			NextCursor: "next",
+		}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/5/comments?limit=2&sort=top&parent_id=4", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+			t.Errorf("expected a next link, got %q", w.Header().Get("Link"))
+		}
+	})
+
+	t.Run("Unknown sort is rejected", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/5/comments?sort=best", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Cursor of another sort is rejected", func(t *testing.T) {
+		cursor := store.FeedCursor{CreatedAt: "2025-01-01T00:00:00Z", ID: 10, Sort: store.CommentSortOldest}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/5/comments?sort=newest&cursor="+cursor.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Empty comments are rejected", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/5/comments", bytes.NewBufferString(`{"content":""}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Commenting on a hidden post is not found", func(t *testing.T) {
+		mockPostService.On("CreateComment", mock.Anything, int64(6), int64(1), int64(0), "nice").Return(nil, service.ErrPostNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/6/comments", bytes.NewBufferString(`{"content":"nice"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Editing a comment of another user is forbidden", func(t *testing.T) {
+		comment := &store.Comment{ID: 2, PostID: 5, UserID: 2}
+		mockPostService.On("GetComment", mock.Anything, int64(5), int64(2), int64(1)).Return(comment, nil).Once()
+		mockPostService.On("CanUserModifyComment", mock.Anything, user, comment, "moderator").Return(false, nil).Once()
+		mockPostService.On("GetPostByID", mock.Anything, int64(5), int64(1)).Return(&store.Post{ID: 5}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPatch, "/v1/posts/5/comments/2", bytes.NewBufferString(`{"content":"edited"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Deletes own comment", func(t *testing.T) {
+		comment := &store.Comment{ID: 3, PostID: 5, UserID: 1}
+		mockPostService.On("GetComment", mock.Anything, int64(5), int64(3), int64(1)).Return(comment, nil).Once()
+		mockPostService.On("CanUserModifyComment", mock.Anything, user, comment, "admin").Return(true, nil).Once()
+		mockPostService.On("DeleteComment", mock.Anything, int64(5), int64(3)).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodDelete, "/v1/posts/5/comments/3", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, w.Code)
+	})
+}
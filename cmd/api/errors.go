@@ -3,11 +3,15 @@ package main
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/n-korel/social-api/internal/service"
 )
 
 func (app *application) handleServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var throttled *service.LoginThrottledError
+	var usernameCooldown *service.UsernameChangeCooldownError
+
 	switch {
 	// User service errors
 	case errors.Is(err, service.ErrUserNotFound):
@@ -22,16 +26,77 @@ func (app *application) handleServiceError(w http.ResponseWriter, r *http.Reques
 		app.badRequestResponse(w, r, err)
 	case errors.Is(err, service.ErrAlreadyFollowing):
 		app.conflictResponse(w, r, err)
+	case errors.Is(err, service.ErrEmailUnchanged):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidEmailChangeToken):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrCannotBlockSelf):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrUserBlocked):
+		app.forbiddenResponse(w, r)
+	case errors.Is(err, service.ErrFollowRequestNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.As(err, &usernameCooldown):
+		app.rateLimitExceededResponse(w, r, max(usernameCooldown.RetryAfter.Round(time.Second), time.Second).String())
 
 	// Auth service errors
 	case errors.Is(err, service.ErrInvalidCredentials):
 		app.unauthorizedErrorResponse(w, r, err)
 	case errors.Is(err, service.ErrInvalidToken):
 		app.unauthorizedErrorResponse(w, r, err)
+	case errors.Is(err, service.ErrRefreshTokenReused):
+		app.unauthorizedErrorResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidResetToken):
+		app.badRequestResponse(w, r, err)
+
+	case errors.As(err, &throttled):
+		app.rateLimitExceededResponse(w, r, max(throttled.RetryAfter.Round(time.Second), time.Second).String())
+
+	// MFA errors
+	case errors.Is(err, service.ErrInvalidMFACode):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrMFANotEnabled):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, service.ErrMFAEnforced):
+		app.forbiddenResponse(w, r)
+
+	// OIDC errors
+	case errors.Is(err, service.ErrUnknownOIDCProvider):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		app.unauthorizedErrorResponse(w, r, err)
+	case errors.Is(err, service.ErrOIDCAccountExists):
+		app.conflictResponse(w, r, err)
+
+	// API token service errors
+	case errors.Is(err, service.ErrAPITokenNotFound):
+		app.notFoundResponse(w, r, err)
 
 	// Post service errors
 	case errors.Is(err, service.ErrPostNotFound):
 		app.notFoundResponse(w, r, err)
+	case errors.Is(err, service.ErrCommentNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidParentComment):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrCommentTooDeep):
+		app.badRequestResponse(w, r, err)
+
+	// Media service errors
+	case errors.Is(err, service.ErrMediaNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, service.ErrMediaTooLarge):
+		app.payloadTooLargeResponse(w, r, err)
+	case errors.Is(err, service.ErrUnsupportedMediaType):
+		app.unsupportedMediaTypeResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidImageDimensions):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrInvalidMedia):
+		app.badRequestResponse(w, r, err)
 
 	// Default internal server error
 	default:
@@ -67,6 +132,18 @@ func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request,
 	writeJSONError(w, http.StatusConflict, err.Error())
 }
 
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Payload too large", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("Unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnf("Not found error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
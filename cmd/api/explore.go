@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// trendingWindows are the windows trending tags are counted over
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": time.Hour * 24,
+	"7d":  time.Hour * 24 * 7,
+}
+
+// exploreHandler godoc
+//
+//	@Summary		Fetch explore feed
+//	@Description	Fetch posts of all users, newest first or with mode=ranked by popularity (recency and comments).
+//	@Description	Paging and filters work as in the user feed.
+//	@Tags			feed
+//	@Produce		json
+//	@Param			since	query		string	false	"Only posts created at or after: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			until	query		string	false	"Only posts created before: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			mode	query		string	false	"Feed order: chronological (default) or ranked"	Enums(chronological, ranked)
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	FeedResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/explore [get]
+func (app *application) exploreHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := parseFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := app.services.Posts.GetExploreFeed(ctx, getUserFromCtx(r).ID, fq)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	app.feedResponse(w, r, page)
+}
+
+// getTagPostsHandler godoc
+//
+//	@Summary		Fetch posts with a tag
+//	@Description	Fetch posts of all users with the tag. Paging and filters work as in the explore feed.
+//	@Tags			feed
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			since	query		string	false	"Only posts created at or after: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			until	query		string	false	"Only posts created before: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			mode	query		string	false	"Feed order: chronological (default) or ranked"	Enums(chronological, ranked)
+//	@Success		200		{object}	FeedResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := chi.URLParam(r, "tag")
+	if tag == "" || len(tag) > 100 {
+		app.badRequestResponse(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	fq, err := parseFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	fq.Tags = []string{tag}
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := app.services.Posts.GetExploreFeed(ctx, getUserFromCtx(r).ID, fq)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	app.feedResponse(w, r, page)
+}
+
+// getTrendingTagsHandler godoc
+//
+//	@Summary		Fetch trending tags
+//	@Description	Fetch the most used tags of posts created within the window
+//	@Tags			feed
+//	@Produce		json
+//	@Param			window	query		string	false	"Window, 24h by default"	Enums(1h, 24h, 7d)
+//	@Param			limit	query		int		false	"Number of tags, 1 to 50, 10 by default"
+//	@Success		200		{object}	[]store.TagCount
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	window := trendingWindows["24h"]
+	if v := qs.Get("window"); v != "" {
+		d, ok := trendingWindows[v]
+		if !ok {
+			app.badRequestResponse(w, r, errors.New("window must be one of 1h, 24h or 7d"))
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 50 {
+			app.badRequestResponse(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = l
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	tags, err := app.services.Posts.GetTrendingTags(ctx, window, limit)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if tags == nil {
+		tags = []store.TagCount{}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
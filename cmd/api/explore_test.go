@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExplore(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockPostService := app.services.Posts.(*service.MockPostService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("Fetch the explore feed", func(t *testing.T) {
+		mockPostService.On("GetExploreFeed", mock.Anything, int64(1), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return q.Mode == store.FeedModeRanked && len(q.Tags) == 0
+		})).Return(&store.FeedPage{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/explore?mode=ranked", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Fetch posts with a tag", func(t *testing.T) {
+		mockPostService.On("GetExploreFeed", mock.Anything, int64(1), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return len(q.Tags) == 1 && q.Tags[0] == "golang"
+		})).Return(&store.FeedPage{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/tags/golang/posts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockPostService.AssertExpectations(t)
+	})
+
+	t.Run("Fetch trending tags", func(t *testing.T) {
+		mockPostService.On("GetTrendingTags", mock.Anything, time.Hour*24*7, 5).Return([]store.TagCount{{Tag: "golang", Count: 2}}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/tags/trending?window=7d&limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockPostService.AssertExpectations(t)
+	})
+
+	t.Run("Reject an unknown trending window", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/tags/trending?window=2h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -1,58 +1,118 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/n-korel/social-api/internal/store"
 )
 
+// FeedResponse is the feed envelope. Cursors are opaque and are passed back as the cursor query parameter.
+type FeedResponse struct {
+	Data       []store.PostWithMetadata `json:"data"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+}
+
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetch user feed
-//	@Description	Fetch user feed
+//	@Description	Fetch user feed. Pages are linked with next_cursor/prev_cursor and RFC 8288 Link headers,
+//	@Description	offset pagination is kept for older clients. mode=ranked orders posts by recency, comments,
+//	@Description	the viewer's affinity with the author and tag overlap with the viewer's history.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
+//	@Param			since	query		string	false	"Only posts created at or after: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			until	query		string	false	"Only posts created before: RFC 3339 time or a duration back from now (24h, 7d)"
 //	@Param			limit	query		int		false	"Limit"
 //	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor or prev_cursor"
 //	@Param			sort	query		string	false	"Sort"
+//	@Param			mode	query		string	false	"Feed order: chronological (default) or ranked"	Enums(chronological, ranked)
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Success		200		{object}	FeedResponse
 //	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	fq, err := parseFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := app.services.Posts.GetUserFeed(ctx, user.ID, fq)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	app.feedResponse(w, r, page)
+}
 
+// parseFeedQuery reads and validates the paging and filter parameters shared by all feeds
+func parseFeedQuery(r *http.Request) (store.PaginatedFeedQuery, error) {
 	fq := store.PaginatedFeedQuery{
 		Limit:  20,
 		Offset: 0,
 		Sort:   "desc",
+		Mode:   store.FeedModeChronological,
 	}
 
 	fq, err := fq.Parse(r)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return fq, err
 	}
 
 	if err := Validate.Struct(fq); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return fq, err
 	}
 
-	ctx := r.Context()
+	return fq, nil
+}
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(35), fq)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
+// feedResponse writes a feed page with its cursors in the envelope and in Link headers
+func (app *application) feedResponse(w http.ResponseWriter, r *http.Request, page *store.FeedPage) {
+	var links []string
+	if page.NextCursor != "" {
+		links = append(links, feedLink(r, page.NextCursor, "next"))
+	}
+	if page.PrevCursor != "" {
+		links = append(links, feedLink(r, page.PrevCursor, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	res := FeedResponse{
+		Data:       page.Posts,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}
+	if res.Data == nil {
+		res.Data = []store.PostWithMetadata{}
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// feedLink returns a Link header value for the same request continued from cursor
+func feedLink(r *http.Request, cursor, rel string) string {
+	qs := r.URL.Query()
+	qs.Del("offset")
+	qs.Set("cursor", cursor)
+
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, qs.Encode(), rel)
+}
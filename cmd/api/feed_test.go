@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockPostService := app.services.Posts.(*service.MockPostService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 7}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(7), true).Return(&store.User{ID: 7}, nil)
+
+	t.Run("Not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, w.Code)
+		mockPostService.AssertNotCalled(t, "GetUserFeed", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Build the feed for the authenticated user", func(t *testing.T) {
+		expectedQuery := store.PaginatedFeedQuery{
+			Limit:  5,
+			Offset: 0,
+			Sort:   "desc",
+			Mode:   store.FeedModeChronological,
+		}
+		mockPostService.On("GetUserFeed", mock.Anything, int64(7), expectedQuery).Return(&store.FeedPage{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockPostService.AssertExpectations(t)
+	})
+
+	t.Run("Link neighbouring pages", func(t *testing.T) {
+		cursor := store.FeedCursor{CreatedAt: "2025-01-01T00:00:00Z", ID: 10, Sort: "desc"}
+		mockPostService.On("GetUserFeed", mock.Anything, int64(7), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return q.Cursor != nil && *q.Cursor == cursor
+		})).Return(&store.FeedPage{
+			NextCursor: "next",
+			PrevCursor: "prev",
+		}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?limit=5&cursor="+cursor.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+
+		expected := `</v1/users/feed?cursor=next&limit=5>; rel="next", </v1/users/feed?cursor=prev&limit=5>; rel="prev"`
+		if link := w.Header().Get("Link"); link != expected {
+			t.Errorf("Expected Link header %q. Got %q", expected, link)
+		}
+	})
+
+	t.Run("Reject an invalid cursor", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?cursor=garbage", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Reject a cursor of another sort", func(t *testing.T) {
+		cursor := store.FeedCursor{CreatedAt: "2025-01-01T00:00:00Z", ID: 10, Sort: "asc"}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?cursor="+cursor.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Filter by since and until", func(t *testing.T) {
+		since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		mockPostService.On("GetUserFeed", mock.Anything, int64(7), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return q.Since != nil && q.Since.Equal(since) &&
+				q.Until != nil && time.Since(*q.Until) > 7*24*time.Hour-time.Minute
+		})).Return(&store.FeedPage{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?since=2025-01-01T00:00:00Z&until=7d", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Reject invalid time bounds", func(t *testing.T) {
+		for _, query := range []string{"since=yesterday", "until=-24h", "since=24h&until=48h"} {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?"+query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			w := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Reject time cursors in ranked mode", func(t *testing.T) {
+		cursor := store.FeedCursor{CreatedAt: "2025-01-01T00:00:00Z", ID: 10}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?mode=ranked&cursor="+cursor.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Reject an invalid query", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?sort=random", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Surface service errors", func(t *testing.T) {
+		mockPostService.On("GetUserFeed", mock.Anything, int64(7), mock.Anything).Return(nil, errors.New("db down")).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusInternalServerError, w.Code)
+	})
+}
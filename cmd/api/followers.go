@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// FollowListResponse is the envelope of followers and following lists
+type FollowListResponse struct {
+	Data       []store.FollowEntry `json:"data"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// GetFollowers godoc
+//
+//	@Summary		Fetch followers
+//	@Description	Fetch the users following a user, newest follows first. Pages are linked with next_cursor
+//	@Description	and an RFC 8288 Link header.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit (1-100, default 20)"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor"
+//	@Success		200		{object}	FollowListResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followList(w, r, app.services.Users.GetFollowers)
+}
+
+// GetFollowing godoc
+//
+//	@Summary		Fetch following
+//	@Description	Fetch the users a user follows, newest follows first. Pages are linked with next_cursor
+//	@Description	and an RFC 8288 Link header.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit (1-100, default 20)"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor"
+//	@Success		200		{object}	FollowListResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followList(w, r, app.services.Users.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*service.FollowPage, error)
+
+// followList writes a page of a followers or following list read by list
+func (app *application) followList(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil || userID < 1 {
+		app.badRequestResponse(w, r, errors.New("invalid user ID"))
+		return
+	}
+
+	query, err := readFollowListQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := getUserFromCtx(r)
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := list(ctx, userID, viewer.ID, query)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	app.writeFollowPage(w, r, page)
+}
+
+// GetFollowRequests godoc
+//
+//	@Summary		Fetch follow requests
+//	@Description	Fetch the users waiting for the authenticated user to approve their follow request,
+//	@Description	newest first. Pages are linked with next_cursor and an RFC 8288 Link header.
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit (1-100, default 20)"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor"
+//	@Success		200		{object}	FollowListResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	query, err := readFollowListQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	page, err := app.services.Users.GetFollowRequests(ctx, user.ID, query)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	app.writeFollowPage(w, r, page)
+}
+
+// AcceptFollowRequest godoc
+//
+//	@Summary		Accept follow request
+//	@Description	Approve the follow request of a user, who then follows the authenticated user
+//	@Tags			users
+//	@Param			userID	path		int		true	"Requesting user ID"
+//	@Success		204		{string}	string	"Request accepted"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error	"Request not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{userID}/accept [put]
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.AcceptFollowRequest)
+}
+
+// RejectFollowRequest godoc
+//
+//	@Summary		Reject follow request
+//	@Description	Reject the follow request of a user. The user is not notified and may ask again.
+//	@Tags			users
+//	@Param			userID	path		int		true	"Requesting user ID"
+//	@Success		204		{string}	string	"Request rejected"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error	"Request not found"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{userID}/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.relationAction(w, r, app.services.Users.RejectFollowRequest)
+}
+
+// readFollowListQuery reads and validates the limit and cursor of a follow list
+func readFollowListQuery(r *http.Request) (store.FollowListQuery, error) {
+	query, err := store.FollowListQuery{Limit: 20}.Parse(r)
+	if err != nil {
+		return query, err
+	}
+
+	return query, Validate.Struct(query)
+}
+
+// writeFollowPage writes page in a FollowListResponse, linking the next page
+func (app *application) writeFollowPage(w http.ResponseWriter, r *http.Request, page *service.FollowPage) {
+	if page.NextCursor != "" {
+		w.Header().Set("Link", feedLink(r, page.NextCursor, "next"))
+	}
+
+	res := FollowListResponse{
+		Data:       page.Users,
+		NextCursor: page.NextCursor,
+	}
+	if res.Data == nil {
+		res.Data = []store.FollowEntry{}
+	}
+
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+type sweeperConfig struct {
+	enabled              bool
+	interval             time.Duration
+	unactivatedUserGrace time.Duration
+}
+
+// runInvitationSweeper periodically purges expired invitations and never activated users
+// so their emails and usernames can be registered again
+func (app *application) runInvitationSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.sweeper.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			invitations, users, err := app.services.Users.CleanupInvitations(ctx)
+			if err != nil {
+				app.logger.Errorw("Invitation sweeper failed", "error", err.Error())
+				continue
+			}
+
+			if invitations > 0 || users > 0 {
+				app.logger.Infow("Invitation sweeper finished", "invitations", invitations, "users", users)
+			}
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"expvar"
+	"fmt"
 	"log"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,6 +14,8 @@ import (
 	"github.com/n-korel/social-api/internal/db"
 	"github.com/n-korel/social-api/internal/env"
 	"github.com/n-korel/social-api/internal/mailer"
+	"github.com/n-korel/social-api/internal/media"
+	"github.com/n-korel/social-api/internal/oidc"
 	"github.com/n-korel/social-api/internal/ratelimiter"
 	"github.com/n-korel/social-api/internal/service"
 	"github.com/n-korel/social-api/internal/store"
@@ -46,6 +51,7 @@ func main() {
 	cfg := config{
 		addr:        ":" + env.GetString("PORT", "8080"),
 		apiURL:      env.GetString("EXTERNAL_URL", "localhost:8080"),
+		baseURL:     env.GetString("BASE_URL", "http://"+env.GetString("EXTERNAL_URL", "localhost:8080")),
 		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:5173"),
 		db: dbConfig{
 			dsn:          env.GetString("DSN", "host=localhost user=postgres password=my_pass dbname=social-api port=5432 sslmode=disable"),
@@ -74,9 +80,31 @@ func main() {
 				pass: env.GetString("AUTH_BASIC_PASS", ""),
 			},
 			token: tokenConfig{
-				secret: env.GetString("AUTH_TOKEN_SECRET", "example"),
-				exp:    time.Hour * 24 * 2, // 2 Days
-				host:   env.GetString("AUTH_TOKEN_HOST", "example"),
+				secret:     env.GetString("AUTH_TOKEN_SECRET", "example"),
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour * 24 * 30, // 30 Days
+				host:       env.GetString("AUTH_TOKEN_HOST", "example"),
+				signingKey: env.GetString("AUTH_TOKEN_SIGNING_KEY", ""),
+				verifyKeys: strings.FieldsFunc(env.GetString("AUTH_TOKEN_VERIFY_KEYS", ""), func(r rune) bool {
+					return r == ','
+				}),
+			},
+			passwordResetExp: time.Hour,
+			mfa: mfaConfig{
+				issuer:            env.GetString("MFA_ISSUER", mailer.FromName),
+				challengeExp:      time.Minute * 5,
+				requiredRoleLevel: env.Getint("MFA_REQUIRED_ROLE_LEVEL", 0),
+			},
+			loginGuard: loginGuardConfig{
+				maxFailures:     env.Getint("LOGIN_MAX_FAILURES", 5),
+				baseDelay:       time.Second,
+				maxDelay:        time.Minute,
+				lockoutDuration: env.GetDuration("LOGIN_LOCKOUT_DURATION", time.Minute*15),
+				window:          time.Hour,
+			},
+			oidc: oidcConfig{
+				providers: oidcProvidersFromEnv(env.GetString("EXTERNAL_URL", "localhost:8080")),
+				stateExp:  time.Minute * 10,
 			},
 		},
 		rateLimiter: ratelimiter.Config{
@@ -84,6 +112,48 @@ func main() {
 			TimeFrame:            time.Second * 5,
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
 		},
+		sweeper: sweeperConfig{
+			enabled:              env.GetBool("SWEEPER_ENABLED", true),
+			interval:             env.GetDuration("SWEEPER_INTERVAL", time.Hour),
+			unactivatedUserGrace: env.GetDuration("UNACTIVATED_USER_GRACE_PERIOD", time.Hour*24*7), // 7 Days
+		},
+		timeline: timelineConfig{
+			length:             env.Getint("TIMELINE_LENGTH", 800),
+			fanoutMaxFollowers: env.Getint("TIMELINE_FANOUT_MAX_FOLLOWERS", 10000),
+			ranking: store.FeedRanking{
+				RecencyWeight:       env.GetFloat("FEED_RANK_RECENCY_WEIGHT", 1),
+				CommentsWeight:      env.GetFloat("FEED_RANK_COMMENTS_WEIGHT", 0.3),
+				AffinityWeight:      env.GetFloat("FEED_RANK_AFFINITY_WEIGHT", 0.5),
+				TagsWeight:          env.GetFloat("FEED_RANK_TAGS_WEIGHT", 0.4),
+				AuthorRepeatPenalty: env.GetFloat("FEED_RANK_AUTHOR_REPEAT_PENALTY", 0.5),
+				HalfLife:            env.GetDuration("FEED_RANK_HALF_LIFE", time.Hour*12),
+				Window:              env.GetDuration("FEED_RANK_WINDOW", time.Hour*24*7), // 7 Days
+			},
+		},
+		profile: profileConfig{
+			usernameChangeCooldown: env.GetDuration("USERNAME_CHANGE_COOLDOWN", time.Hour*24*30), // 30 Days
+			emailChangeExp:         time.Hour * 24,
+		},
+		comments: commentsConfig{
+			maxDepth: env.Getint("COMMENTS_MAX_DEPTH", 5),
+		},
+		search: searchConfig{
+			language: env.GetString("SEARCH_LANGUAGE", "english"),
+		},
+		media: mediaConfig{
+			storage:  env.GetString("MEDIA_STORAGE", "local"),
+			localDir: env.GetString("MEDIA_LOCAL_DIR", "./uploads"),
+			s3: media.S3Config{
+				Endpoint:  env.GetString("S3_ENDPOINT", ""),
+				Bucket:    env.GetString("S3_BUCKET", ""),
+				Region:    env.GetString("S3_REGION", "us-east-1"),
+				AccessKey: env.GetString("S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("S3_SECRET_KEY", ""),
+			},
+			maxUploadSize: int64(env.Getint("MEDIA_MAX_UPLOAD_SIZE", 10<<20)), // 10 MB
+			maxDimension:  env.Getint("MEDIA_MAX_DIMENSION", 4096),
+			thumbnailSize: env.Getint("MEDIA_THUMBNAIL_SIZE", 320),
+		},
 	}
 
 	// Initialize Logger
@@ -127,6 +197,22 @@ func main() {
 		cfg.rateLimiter.TimeFrame,
 	)
 
+	// Initialize login guard, shared between instances through Redis when enabled
+	loginConfig := ratelimiter.LoginConfig{
+		MaxFailures:     cfg.auth.loginGuard.maxFailures,
+		BaseDelay:       cfg.auth.loginGuard.baseDelay,
+		MaxDelay:        cfg.auth.loginGuard.maxDelay,
+		LockoutDuration: cfg.auth.loginGuard.lockoutDuration,
+		Window:          cfg.auth.loginGuard.window,
+	}
+
+	var loginGuard service.LoginGuard
+	if cfg.redisCfg.enabled {
+		loginGuard = cache.NewLoginAttemptStore(rdb, loginConfig)
+	} else {
+		loginGuard = ratelimiter.NewMemoryLoginGuard(loginConfig)
+	}
+
 	// Initialize repository layer
 	store := store.NewStorage(db)
 
@@ -137,31 +223,122 @@ func main() {
 	}
 
 	// Initialize Authenticator
-	JWTAuthenticator := auth.NewJWTAuthenticator(
-		cfg.auth.token.secret,
-		cfg.auth.token.host,
-		cfg.auth.token.host,
-	)
+	var authenticator auth.Authenticator
+
+	if cfg.auth.token.signingKey != "" {
+		authenticator, err = auth.NewAsymmetricAuthenticator(
+			cfg.auth.token.signingKey,
+			cfg.auth.token.verifyKeys,
+			cfg.auth.token.host,
+			cfg.auth.token.host,
+		)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Asymmetric token signing enabled")
+	} else {
+		authenticator = auth.NewJWTAuthenticator(
+			cfg.auth.token.secret,
+			cfg.auth.token.host,
+			cfg.auth.token.host,
+		)
+	}
+
+	// Initialize OpenID providers
+	oidcProviders := make(map[string]service.OIDCProvider, len(cfg.auth.oidc.providers))
+	oidcTrustEmail := make(map[string]bool)
+	for _, p := range cfg.auth.oidc.providers {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    p.issuer,
+			ClientID:     p.clientID,
+			ClientSecret: p.clientSecret,
+			RedirectURL:  p.redirectURL,
+		})
+		if err != nil {
+			logger.Fatalw("failed to initialize OpenID provider", "provider", p.name, "error", err)
+		}
+		oidcProviders[p.name] = provider
+		oidcTrustEmail[p.name] = p.trustEmail
+		logger.Infow("OpenID provider enabled", "provider", p.name)
+	}
+
+	// Initialize media storage
+	var blobs media.BlobStore
+	switch cfg.media.storage {
+	case "s3":
+		blobs = media.NewS3Store(cfg.media.s3, nil)
+		logger.Infow("Media stored in S3", "endpoint", cfg.media.s3.Endpoint, "bucket", cfg.media.s3.Bucket)
+	case "local":
+		blobs, err = media.NewLocalStore(cfg.media.localDir)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	default:
+		logger.Fatalw("unknown media storage", "storage", cfg.media.storage)
+	}
 
 	// Initialize Service layer
 	userServiceConfig := service.UserServiceConfig{
-		FrontendURL:     cfg.frontendURL,
-		MailExpiration:  cfg.mail.exp,
-		IsProductionEnv: cfg.env == "production",
+		FrontendURL:                cfg.frontendURL,
+		MailExpiration:             cfg.mail.exp,
+		IsProductionEnv:            cfg.env == "production",
+		UnactivatedUserGracePeriod: cfg.sweeper.unactivatedUserGrace,
+		UsernameChangeCooldown:     cfg.profile.usernameChangeCooldown,
+		EmailChangeExpiration:      cfg.profile.emailChangeExp,
+		Logger:                     logger,
+	}
+
+	postServiceConfig := service.PostServiceConfig{
+		TimelineLength:     cfg.timeline.length,
+		FanoutMaxFollowers: cfg.timeline.fanoutMaxFollowers,
+		Ranking:            cfg.timeline.ranking,
+		SearchLanguage:     cfg.search.language,
+		MaxCommentDepth:    cfg.comments.maxDepth,
 	}
 
 	authServiceConfig := service.AuthServiceConfig{
-		TokenExpiration: cfg.auth.token.exp,
-		TokenHost:       cfg.auth.token.host,
+		TokenExpiration:         cfg.auth.token.exp,
+		RefreshTokenExpiration:  cfg.auth.token.refreshExp,
+		TokenHost:               cfg.auth.token.host,
+		FrontendURL:             cfg.frontendURL,
+		PasswordResetExpiration: cfg.auth.passwordResetExp,
+		IsProductionEnv:         cfg.env == "production",
+		MFAIssuer:               cfg.auth.mfa.issuer,
+		MFAChallengeExpiration:  cfg.auth.mfa.challengeExp,
+		MFARequiredRoleLevel:    cfg.auth.mfa.requiredRoleLevel,
+		Logger:                  logger,
+		LoginLockoutDuration:    cfg.auth.loginGuard.lockoutDuration,
+	}
+
+	oidcServiceConfig := service.OIDCServiceConfig{
+		StateExpiration: cfg.auth.oidc.stateExp,
+		TrustEmail:      oidcTrustEmail,
+	}
+
+	searchServiceConfig := service.SearchServiceConfig{
+		Language: cfg.search.language,
+	}
+
+	mediaServiceConfig := service.MediaServiceConfig{
+		MaxUploadSize: cfg.media.maxUploadSize,
+		MaxDimension:  cfg.media.maxDimension,
+		ThumbnailSize: cfg.media.thumbnailSize,
 	}
 
 	services := service.NewServices(
 		store,
 		cacheStorage,
 		mailtrap,
-		JWTAuthenticator,
+		authenticator,
+		loginGuard,
+		oidcProviders,
+		blobs,
 		userServiceConfig,
+		postServiceConfig,
 		authServiceConfig,
+		oidcServiceConfig,
+		searchServiceConfig,
+		mediaServiceConfig,
 	)
 
 	app := &application{
@@ -171,7 +348,7 @@ func main() {
 		services:      services,
 		logger:        logger,
 		mailer:        mailtrap,
-		authenticator: JWTAuthenticator,
+		authenticator: authenticator,
 		rateLimiter:   rateLimiter,
 	}
 
@@ -188,3 +365,30 @@ func main() {
 
 	logger.Fatal((app.run(mux)))
 }
+
+// oidcProvidersFromEnv reads the providers listed in OIDC_PROVIDERS (e.g. "google,gitlab").
+// Each one is configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and optionally _REDIRECT_URL.
+func oidcProvidersFromEnv(apiURL string) []oidcProviderConfig {
+	var providers []oidcProviderConfig
+
+	for _, name := range strings.FieldsFunc(env.GetString("OIDC_PROVIDERS", ""), func(r rune) bool {
+		return r == ','
+	}) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, oidcProviderConfig{
+			name:         name,
+			issuer:       env.GetString(prefix+"ISSUER", ""),
+			clientID:     env.GetString(prefix+"CLIENT_ID", ""),
+			clientSecret: env.GetString(prefix+"CLIENT_SECRET", ""),
+			redirectURL:  env.GetString(prefix+"REDIRECT_URL", fmt.Sprintf("http://%s/v1/authentication/oidc/%s/callback", apiURL, name)),
+			trustEmail:   env.GetBool(prefix+"TRUST_EMAIL", false),
+		})
+	}
+
+	return providers
+}
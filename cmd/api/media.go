@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// multipartOverhead allows for the part headers and boundaries around the uploaded file
+const multipartOverhead = 64 << 10
+
+// UploadMedia godoc
+//
+//	@Summary		Upload image
+//	@Description	Upload a JPEG, PNG or GIF image to attach to posts. The type is detected from the content,
+//	@Description	a thumbnail is generated.
+//	@Tags			media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		415		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	m, ok := app.uploadMedia(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, m); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetMedia godoc
+//
+//	@Summary		Fetch image
+//	@Description	Fetch an uploaded image. Avatars and images of public posts need no authentication,
+//	@Description	images of other posts are only served to users who may see one of those posts.
+//	@Tags			media
+//	@Produce		image/jpeg,image/png,image/gif
+//	@Param			mediaID	path		string	true	"Media ID"
+//	@Success		200		{file}		file
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID} [get]
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveMedia(w, r, false)
+}
+
+// GetMediaThumbnail godoc
+//
+//	@Summary		Fetch thumbnail
+//	@Description	Fetch the thumbnail of an uploaded image, with the same access rules as the image
+//	@Tags			media
+//	@Produce		image/jpeg,image/png
+//	@Param			mediaID	path		string	true	"Media ID"
+//	@Success		200		{file}		file
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID}/thumbnail [get]
+func (app *application) getMediaThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveMedia(w, r, true)
+}
+
+// DeleteMedia godoc
+//
+//	@Summary		Delete image
+//	@Description	Delete an uploaded image of the authenticated user. It is removed from posts and the avatar.
+//	@Tags			media
+//	@Param			mediaID	path		string	true	"Media ID"
+//	@Success		204		{object}	string
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID} [delete]
+func (app *application) deleteMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Media.DeleteMedia(ctx, chi.URLParam(r, "mediaID"), user.ID); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadAvatar godoc
+//
+//	@Summary		Upload avatar
+//	@Description	Upload an image and use its thumbnail as the avatar of the authenticated user
+//	@Tags			users
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		415		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	m, ok := app.uploadMedia(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	avatarURL := app.baseURL() + "/v1/media/" + m.ID + "/thumbnail"
+	updated, err := app.services.Users.UpdateProfile(ctx, user.ID, service.ProfileUpdateRequest{
+		AvatarURL:     &avatarURL,
+		AvatarMediaID: &m.ID,
+	})
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, updated); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// uploadMedia stores the "file" part of a multipart request. It writes the error response
+// and returns false when the upload failed.
+func (app *application) uploadMedia(w http.ResponseWriter, r *http.Request, userID int64) (*store.Media, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.media.maxUploadSize+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooLarge):
+				app.payloadTooLargeResponse(w, r, service.ErrMediaTooLarge)
+			case errors.Is(err, io.EOF):
+				app.badRequestResponse(w, r, errors.New("missing file"))
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return nil, false
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		ctx := r.Context()
+
+		// Service layer
+		m, err := app.services.Media.Upload(ctx, userID, part)
+		part.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				err = service.ErrMediaTooLarge
+			}
+			app.handleServiceError(w, r, err)
+			return nil, false
+		}
+
+		return m, true
+	}
+}
+
+// serveMedia writes an image or its thumbnail if the viewer may see it. Anonymous requests only
+// get media anyone may see, which shared caches may keep. Access changes with the visibility of
+// posts, so media is not cached for long.
+func (app *application) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	var viewerID int64
+	if user := getUserFromCtx(r); user != nil && getTokenClaimsFromCtx(r).HasScope(service.ScopePostsRead) {
+		viewerID = user.ID
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	m, err := app.services.Media.GetMedia(ctx, chi.URLParam(r, "mediaID"), viewerID)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	body, err := app.services.Media.Open(ctx, m, thumbnail)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+	defer body.Close()
+
+	contentType := m.ContentType
+	if thumbnail {
+		contentType = m.ThumbnailContentType
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(m.Size, 10))
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if viewerID == 0 {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
+	w.Header().Set("Vary", "Authorization")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, body); err != nil {
+		app.logger.Warnw("failed to write media", "media", m.ID, "error", err)
+	}
+}
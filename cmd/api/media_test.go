@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func multipartBody(t *testing.T, field string, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	return &body, writer.FormDataContentType()
+}
+
+func TestMedia(t *testing.T) {
+	app := newTestApplication(t, config{baseURL: "https://api.example.com", media: mediaConfig{maxUploadSize: 1024}})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockMediaService := app.services.Media.(*service.MockMediaService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("Upload an image", func(t *testing.T) {
+		mockMediaService.On("Upload", mock.Anything, int64(1), mock.MatchedBy(func(r io.Reader) bool {
+			data, _ := io.ReadAll(r)
+			return string(data) == "image data"
+		})).Return(&store.Media{ID: "m1", UserID: 1}, nil).Once()
+
+		body, contentType := multipartBody(t, "file", []byte("image data"))
+		req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", contentType)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, w.Code)
+		mockMediaService.AssertExpectations(t)
+	})
+
+	t.Run("Reject a request without a file", func(t *testing.T) {
+		body, contentType := multipartBody(t, "other", []byte("image data"))
+		req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", contentType)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Answer 413 for bodies over the limit", func(t *testing.T) {
+		body, contentType := multipartBody(t, "file", bytes.Repeat([]byte("x"), 1024+multipartOverhead))
+		req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", contentType)
+
+		mockMediaService.On("Upload", mock.Anything, int64(1), mock.MatchedBy(func(r io.Reader) bool {
+			_, err := io.ReadAll(r)
+			return err != nil
+		})).Return(nil, service.ErrMediaTooLarge).Once()
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("Answer 415 for unsupported types", func(t *testing.T) {
+		mockMediaService.On("Upload", mock.Anything, int64(1), mock.Anything).Return(nil, service.ErrUnsupportedMediaType).Once()
+
+		body, contentType := multipartBody(t, "file", []byte("%PDF"))
+		req, err := http.NewRequest(http.MethodPost, "/v1/media", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", contentType)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("Serve a thumbnail without authentication", func(t *testing.T) {
+		m := &store.Media{ID: "m1", ContentType: "image/gif", ThumbnailContentType: "image/png"}
+		mockMediaService.On("GetMedia", mock.Anything, "m1", int64(0)).Return(m, nil).Once()
+		mockMediaService.On("Open", mock.Anything, m, true).Return(io.NopCloser(strings.NewReader("thumb")), nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/media/m1/thumbnail", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if w.Header().Get("Content-Type") != "image/png" || w.Header().Get("X-Content-Type-Options") != "nosniff" ||
+			w.Header().Get("Cache-Control") != "public, max-age=3600" {
+			t.Errorf("unexpected headers: %v", w.Header())
+		}
+		if w.Body.String() != "thumb" {
+			t.Errorf("unexpected body: %s", w.Body.String())
+		}
+	})
+
+	t.Run("Serve media of restricted posts privately to authenticated users", func(t *testing.T) {
+		m := &store.Media{ID: "m2", ContentType: "image/png", Size: 5}
+		mockMediaService.On("GetMedia", mock.Anything, "m2", int64(1)).Return(m, nil).Once()
+		mockMediaService.On("Open", mock.Anything, m, false).Return(io.NopCloser(strings.NewReader("image")), nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/media/m2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if w.Header().Get("Cache-Control") != "private, max-age=3600" {
+			t.Errorf("unexpected Cache-Control: %s", w.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("Answer 404 for unknown media", func(t *testing.T) {
+		mockMediaService.On("GetMedia", mock.Anything, "missing", int64(0)).Return(nil, service.ErrMediaNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/media/missing", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Delete own media", func(t *testing.T) {
+		mockMediaService.On("DeleteMedia", mock.Anything, "m1", int64(1)).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodDelete, "/v1/media/m1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Upload an avatar", func(t *testing.T) {
+		mockMediaService.On("Upload", mock.Anything, int64(1), mock.Anything).Return(&store.Media{ID: "m2", UserID: 1}, nil).Once()
+		mockUserService.On("UpdateProfile", mock.Anything, int64(1), mock.MatchedBy(func(u service.ProfileUpdateRequest) bool {
+			return *u.AvatarURL == "https://api.example.com/v1/media/m2/thumbnail" && *u.AvatarMediaID == "m2"
+		})).Return(&store.User{ID: 1}, nil).Once()
+
+		body, contentType := multipartBody(t, "file", []byte("image data"))
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/avatar", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Content-Type", contentType)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockUserService.AssertExpectations(t)
+	})
+}
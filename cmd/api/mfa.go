@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/n-korel/social-api/internal/service"
+)
+
+// MFAChallengeResponse is returned by the token endpoint when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ExpiresIn          int64  `json:"expires_in"`
+}
+
+func newMFAChallengeResponse(challenge *service.MFAChallenge) MFAChallengeResponse {
+	return MFAChallengeResponse{
+		MFARequired:        true,
+		MFAToken:           challenge.Token,
+		EnrollmentRequired: challenge.EnrollmentRequired,
+		ExpiresIn:          int64(time.Until(challenge.ExpiresAt).Seconds()),
+	}
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+func newTOTPEnrollmentResponse(enrollment *service.TOTPEnrollment) TOTPEnrollmentResponse {
+	return TOTPEnrollmentResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+	}
+}
+
+type MFAVerifyResponse struct {
+	TokenResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFATokenPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type MFAVerifyPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// verifyMFAHandler godoc
+//
+//	@Summary		Completes a two-factor login
+//	@Description	Exchanges the MFA token from the token endpoint and a TOTP or recovery code for a token pair.
+//	@Description	When the login required enrollment, the enrollment is confirmed and recovery codes are returned once.
+//	@Description	Wrong codes are throttled like passwords, the token is revoked once the account gets locked out.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFAVerifyPayload	true	"MFA token and code"
+//	@Success		201		{object}	MFAVerifyResponse	"Token pair"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/mfa/verify [post]
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFAVerifyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	tokens, recoveryCodes, err := app.services.Auth.VerifyMFA(ctx, payload.MFAToken, payload.Code)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	response := MFAVerifyResponse{
+		TokenResponse: newTokenResponse(tokens),
+		RecoveryCodes: recoveryCodes,
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// startMFAEnrollmentHandler godoc
+//
+//	@Summary		Starts a required two-factor enrollment
+//	@Description	Returns a TOTP secret for a user who must enroll before logging in. Confirm it through /authentication/mfa/verify
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFATokenPayload			true	"MFA token"
+//	@Success		200		{object}	TOTPEnrollmentResponse	"TOTP secret"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/mfa/enroll [post]
+func (app *application) startMFAEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFATokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	enrollment, err := app.services.Auth.StartMFAEnrollment(ctx, payload.MFAToken)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, newTOTPEnrollmentResponse(enrollment)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// enrollTOTPHandler godoc
+//
+//	@Summary		Starts two-factor enrollment
+//	@Description	Returns a TOTP secret and otpauth URI. 2FA is enabled once a first code is confirmed
+//	@Tags			users
+//	@Produce		json
+//	@Success		201	{object}	TOTPEnrollmentResponse	"TOTP secret"
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [post]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	enrollment, err := app.services.Auth.EnrollTOTP(ctx, user)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, newTOTPEnrollmentResponse(enrollment)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmTOTPHandler godoc
+//
+//	@Summary		Confirms two-factor enrollment
+//	@Description	Enables 2FA with a first code from the authenticator app and returns recovery codes, shown only once
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TOTPCodePayload			true	"TOTP code"
+//	@Success		200		{object}	RecoveryCodesResponse	"Recovery codes"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp/confirm [post]
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	recoveryCodes, err := app.services.Auth.ConfirmTOTP(ctx, user.ID, payload.Code)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: recoveryCodes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// disableTOTPHandler godoc
+//
+//	@Summary		Disables two-factor authentication
+//	@Description	Disables 2FA after checking a TOTP or recovery code. Not allowed for roles that require 2FA
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TOTPCodePayload	true	"TOTP or recovery code"
+//	@Success		204		{string}	string			"2FA disabled"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Auth.DisableTOTP(ctx, user, payload.Code); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
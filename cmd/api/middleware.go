@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/service"
 )
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
@@ -27,29 +28,101 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Validate
+		ctx := r.Context()
+
+		// Validate, API keys are told apart from JWTs by their prefix
 		token := parts[1]
-		userID, err := app.services.Auth.ValidateToken(token)
+		var claims *service.TokenClaims
+		var err error
+		if strings.HasPrefix(token, service.APITokenPrefix) {
+			claims, err = app.services.APITokens.ValidateToken(ctx, token)
+		} else {
+			claims, err = app.services.Auth.ValidateToken(ctx, token)
+		}
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
 
-		ctx := r.Context()
-
 		// UserService to get user
-		user, err := app.services.Users.GetUserByID(ctx, userID, true)
+		user, err := app.services.Users.GetUserByID(ctx, claims.UserID, true)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
 
 		ctx = context.WithValue(ctx, userCtx, user)
+		ctx = context.WithValue(ctx, tokenCtx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 }
 
+// optionalAuth authenticates requests with an Authorization header like AuthTokenMiddleware
+// and lets anonymous requests through without a user
+func (app *application) optionalAuth(next http.Handler) http.Handler {
+	authenticated := app.AuthTokenMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// requireScope rejects API keys that were not granted the scope, session tokens always pass
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := getTokenClaimsFromCtx(r)
+			if !claims.HasScope(scope) {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession rejects API keys, so they cannot manage credentials
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := getTokenClaimsFromCtx(r)
+		if claims.IsAPIToken() {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole rejects users whose role is less privileged than role
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getUserFromCtx(r)
+
+			allowed, err := app.services.Users.HasRole(r.Context(), user, role)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -89,13 +162,15 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
+// checkPostOwnership lets the author and users with requiredRole modify the post. Others get
+// 404 for posts they may not see, so drafts do not leak, and 403 for posts they may see.
 func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromCtx(r)
 		postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
 
-		// Get post using service
-		post, err := app.services.Posts.GetPostByID(r.Context(), postID)
+		// Get post using service. Moderation ignores blocks and visibility, so no viewer is passed
+		post, err := app.services.Posts.GetPostByID(r.Context(), postID, 0)
 		if err != nil {
 			app.handleServiceError(w, r, err)
 			return
@@ -109,6 +184,46 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 		}
 
 		if !allowed {
+			if _, err := app.services.Posts.GetPostByID(r.Context(), postID, user.ID); err != nil {
+				app.handleServiceError(w, r, err)
+				return
+			}
+
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkCommentOwnership lets the commenter and users with requiredRole modify the comment. Like
+// checkPostOwnership, others get 404 when they may not see the post and 403 when they may.
+func (app *application) checkCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+		postID, _ := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+		commentID, _ := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+
+		comment, err := app.services.Posts.GetComment(r.Context(), postID, commentID, user.ID)
+		if err != nil {
+			app.handleServiceError(w, r, err)
+			return
+		}
+
+		// Role check
+		allowed, err := app.services.Posts.CanUserModifyComment(r.Context(), user, comment, requiredRole)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			if _, err := app.services.Posts.GetPostByID(r.Context(), postID, user.ID); err != nil {
+				app.handleServiceError(w, r, err)
+				return
+			}
+
 			app.forbiddenResponse(w, r)
 			return
 		}
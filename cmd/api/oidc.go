@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// oidcLoginHandler godoc
+//
+//	@Summary		Starts an OpenID Connect login
+//	@Description	Redirects to the identity provider. The provider redirects back to the callback endpoint.
+//	@Tags			authentication
+//	@Param			provider	path	string	true	"Provider name"
+//	@Success		302
+//	@Failure		404	{object}	error	"Unknown provider"
+//	@Failure		500	{object}	error
+//	@Router			/authentication/oidc/{provider}/login [get]
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	ctx := r.Context()
+
+	// Service layer
+	authURL, err := app.services.OIDC.StartLogin(ctx, provider)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler godoc
+//
+//	@Summary		Completes an OpenID Connect login
+//	@Description	Exchanges the authorization code for a token pair. The first login creates a new account.
+//	@Description	An existing account with the same verified email is linked only for providers with OIDC_<NAME>_TRUST_EMAIL.
+//	@Tags			authentication
+//	@Produce		json
+//	@Param			provider	path		string					true	"Provider name"
+//	@Param			code		query		string					true	"Authorization code"
+//	@Param			state		query		string					true	"Login state"
+//	@Success		201			{object}	TokenResponse			"Token pair"
+//	@Success		202			{object}	MFAChallengeResponse	"Second factor required"
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error	"Unknown provider"
+//	@Failure		409			{object}	error	"Email belongs to an account not linked to the provider"
+//	@Failure		500			{object}	error
+//	@Router			/authentication/oidc/{provider}/callback [get]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	query := r.URL.Query()
+
+	// The provider reports a denied or failed authorization instead of a code
+	if errParam := query.Get("error"); errParam != "" {
+		app.unauthorizedErrorResponse(w, r, errors.New("identity provider returned "+errParam))
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		app.badRequestResponse(w, r, errors.New("code and state are required"))
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	tokens, challenge, err := app.services.OIDC.CompleteLogin(ctx, provider, code, state)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if challenge != nil {
+		if err := app.jsonResponse(w, http.StatusAccepted, newMFAChallengeResponse(challenge)); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, newTokenResponse(tokens)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
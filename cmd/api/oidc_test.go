@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	mockOIDCService := app.services.OIDC.(*service.MockOIDCService)
+
+	mockOIDCService.On("StartLogin", mock.Anything, "test").Return("https://idp.example.com/authorize?state=abc", nil)
+	mockOIDCService.On("StartLogin", mock.Anything, "missing").Return("", service.ErrUnknownOIDCProvider)
+	mockOIDCService.On("CompleteLogin", mock.Anything, "test", "code", "abc").Return(nil, &service.MFAChallenge{
+		Token:     "mfa-token",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}, nil)
+
+	t.Run("Redirect to the provider", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/test/login", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusFound, w.Code)
+		if location := w.Header().Get("Location"); location != "https://idp.example.com/authorize?state=abc" {
+			t.Errorf("Unexpected redirect location %q", location)
+		}
+	})
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/missing/login", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Callback without a code", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/test/callback?state=abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Callback returns an MFA challenge", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/test/callback?code=code&state=abc", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusAccepted, w.Code)
+	})
+}
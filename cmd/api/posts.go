@@ -12,6 +12,10 @@ type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
 	Tags    []string `json:"tags"`
+	// IDs of images uploaded with POST /media
+	MediaIDs []string `json:"media_ids" validate:"max=4,dive,uuid"`
+	// Who may see the post, public by default
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
 }
 
 // CreatePost godoc
@@ -51,6 +55,8 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		payload.Title,
 		payload.Content,
 		payload.Tags,
+		payload.MediaIDs,
+		payload.Visibility,
 	)
 	if err != nil {
 		app.handleServiceError(w, r, err)
@@ -66,7 +72,7 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // GetPost godoc
 //
 //	@Summary		Fetch post
-//	@Description	Fetch post by ID
+//	@Description	Fetch post by ID. Posts the user may not see answer 404 like missing ones.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -82,7 +88,7 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Service layer
-	post, err := app.services.Posts.GetPostByID(ctx, postID)
+	post, err := app.services.Posts.GetPostByID(ctx, postID, getUserFromCtx(r).ID)
 	if err != nil {
 		app.handleServiceError(w, r, err)
 		return
@@ -122,8 +128,9 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string `json:"title" validate:"omitempty,max=100"`
+	Content    *string `json:"content" validate:"omitempty,max=1000"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers mentioned private"`
 }
 
 // UpdatePost godoc
@@ -163,8 +170,9 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		ctx,
 		postID,
 		service.PostUpdateRequest{
-			Title:   payload.Title,
-			Content: payload.Content,
+			Title:      payload.Title,
+			Content:    payload.Content,
+			Visibility: payload.Visibility,
 		},
 	)
 	if err != nil {
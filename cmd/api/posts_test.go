@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPostVisibility(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockPostService := app.services.Posts.(*service.MockPostService)
+
+	user := &store.User{ID: 1}
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(user, nil)
+
+	t.Run("Hidden post is not found", func(t *testing.T) {
+		mockPostService.On("GetPostByID", mock.Anything, int64(5), int64(1)).Return(nil, service.ErrPostNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Editing a hidden post of another user is not found", func(t *testing.T) {
+		post := &store.Post{ID: 6, UserID: 2, Visibility: store.VisibilityPrivate}
+		mockPostService.On("GetPostByID", mock.Anything, int64(6), int64(0)).Return(post, nil).Once()
+		mockPostService.On("CanUserModifyPost", mock.Anything, user, post, "moderator").Return(false, nil).Once()
+		mockPostService.On("GetPostByID", mock.Anything, int64(6), int64(1)).Return(nil, service.ErrPostNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodPatch, "/v1/posts/6", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Editing a visible post of another user is forbidden", func(t *testing.T) {
+		post := &store.Post{ID: 7, UserID: 2, Visibility: store.VisibilityPublic}
+		mockPostService.On("GetPostByID", mock.Anything, int64(7), int64(0)).Return(post, nil).Once()
+		mockPostService.On("CanUserModifyPost", mock.Anything, user, post, "moderator").Return(false, nil).Once()
+		mockPostService.On("GetPostByID", mock.Anything, int64(7), int64(1)).Return(post, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPatch, "/v1/posts/7", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/service"
+)
+
+type UpdateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitempty,min=1,max=100"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Website     *string `json:"website" validate:"omitempty,max=255,eq=|http_url"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,max=255,eq=|http_url"`
+	IsPrivate   *bool   `json:"is_private"`
+}
+
+type EmailChangePayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// GetCurrentUser godoc
+//
+//	@Summary		Fetch current user
+//	@Description	Fetch the profile of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Update current user profile
+//	@Description	Update the username and profile of the authenticated user. Omitted fields are kept,
+//	@Description	empty strings clear them. The username can be changed once per cooldown period.
+//	@Description	Making the account public accepts all pending follow requests.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile fields"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error	"Username taken"
+//	@Failure		429		{object}	error	"Username changed too recently"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	updated, err := app.services.Users.UpdateProfile(ctx, user.ID, service.ProfileUpdateRequest{
+		Username:    payload.Username,
+		DisplayName: payload.DisplayName,
+		Bio:         payload.Bio,
+		Location:    payload.Location,
+		Website:     payload.Website,
+		AvatarURL:   payload.AvatarURL,
+		IsPrivate:   payload.IsPrivate,
+	})
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, updated); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RequestEmailChange godoc
+//
+//	@Summary		Change email
+//	@Description	Sends a confirmation link to the new email. The email is switched once the link is followed.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		EmailChangePayload	true	"New email"
+//	@Success		202		{string}	string				"Confirmation email sent"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error	"Email taken"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [put]
+func (app *application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	var payload EmailChangePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Users.RequestEmailChange(ctx, user.ID, payload.Email); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, "Confirmation email sent"); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirm email change
+//	@Description	Switches the email of the account to the address the confirmation token was sent to
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Email change token"
+//	@Success		204		{string}	string	"Email changed"
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error	"Email taken"
+//	@Failure		500		{object}	error
+//	@Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	ctx := r.Context()
+
+	// Service layer
+	if err := app.services.Users.ConfirmEmailChange(ctx, token); err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
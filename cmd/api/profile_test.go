@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProfile(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1, Username: "gopher"}, nil)
+
+	t.Run("Fetch the current user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Body.String(), `"username":"gopher"`) {
+			t.Errorf("unexpected body: %s", w.Body.String())
+		}
+	})
+
+	t.Run("Update the profile", func(t *testing.T) {
+		mockUserService.On("UpdateProfile", mock.Anything, int64(1), mock.MatchedBy(func(u service.ProfileUpdateRequest) bool {
+			return u.Bio != nil && *u.Bio == "Gopher" && u.Website != nil && *u.Website == "" && u.Username == nil
+		})).Return(&store.User{ID: 1}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(`{"bio":"Gopher","website":""}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockUserService.AssertExpectations(t)
+	})
+
+	t.Run("Reject a website that is not an http URL", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(`{"website":"javascript:alert(1)"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Answer 429 during the username cooldown", func(t *testing.T) {
+		mockUserService.On("UpdateProfile", mock.Anything, int64(1), mock.Anything).
+			Return(nil, &service.UsernameChangeCooldownError{RetryAfter: time.Hour}).Once()
+
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(`{"username":"gopher2"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusTooManyRequests, w.Code)
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("Request an email change", func(t *testing.T) {
+		mockUserService.On("RequestEmailChange", mock.Anything, int64(1), "new@example.com").Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/email", strings.NewReader(`{"email":"new@example.com"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusAccepted, w.Code)
+		mockUserService.AssertExpectations(t)
+	})
+
+	t.Run("Confirm an email change", func(t *testing.T) {
+		mockUserService.On("ConfirmEmailChange", mock.Anything, "token").Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/email/confirm/token", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Reject an invalid email change token", func(t *testing.T) {
+		mockUserService.On("ConfirmEmailChange", mock.Anything, "bad").Return(service.ErrInvalidEmailChangeToken).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/email/confirm/bad", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+}
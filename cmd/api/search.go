@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// searchHandler godoc
+//
+//	@Summary		Search posts, comments and users
+//	@Description	Full-text search ranked by relevance. Posts and comments come with highlighted snippets,
+//	@Description	matches are wrapped in <mark> and the rest of the snippet is HTML escaped. Users are matched
+//	@Description	by username. Author, tag and time filters apply to posts and comments.
+//	@Tags			search
+//	@Produce		json
+//	@Param			q		query		string	true	"Search query, supports quoted phrases, OR and -exclusion"
+//	@Param			type	query		string	false	"Comma separated types to search: posts, comments, users (all by default)"
+//	@Param			author	query		int		false	"Only posts or comments written by the user ID"
+//	@Param			tag		query		string	false	"Only posts with the tag, or comments on them"
+//	@Param			since	query		string	false	"Only created at or after: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			until	query		string	false	"Only created before: RFC 3339 time or a duration back from now (24h, 7d)"
+//	@Param			limit	query		int		false	"Results per type, 1 to 50, 20 by default"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	service.SearchResults
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/search [get]
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.SearchQuery{
+		Types: []string{store.SearchTypePosts, store.SearchTypeComments, store.SearchTypeUsers},
+		Limit: 20,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	sq.ViewerID = getUserFromCtx(r).ID
+
+	ctx := r.Context()
+
+	// Service layer
+	results, err := app.services.Search.Search(ctx, sq)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
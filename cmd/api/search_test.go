@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockSearchService := app.services.Search.(*service.MockSearchService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("Search all types by default", func(t *testing.T) {
+		mockSearchService.On("Search", mock.Anything, mock.MatchedBy(func(q store.SearchQuery) bool {
+			return q.Query == "golang" && len(q.Types) == 3 && q.Limit == 20
+		})).Return(&service.SearchResults{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/search?q=golang", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockSearchService.AssertExpectations(t)
+	})
+
+	t.Run("Pass filters to the service", func(t *testing.T) {
+		mockSearchService.On("Search", mock.Anything, mock.MatchedBy(func(q store.SearchQuery) bool {
+			return len(q.Types) == 1 && q.Types[0] == store.SearchTypeComments &&
+				q.AuthorID == 2 && q.Tag == "go" && q.Since != nil
+		})).Return(&service.SearchResults{}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/search?q=generics&type=comments&author=2&tag=go&since=7d", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		mockSearchService.AssertExpectations(t)
+	})
+
+	t.Run("Reject a missing query", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/search", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Reject an unknown type", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/search?q=go&type=groups", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Require authentication", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/search?q=go", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/n-korel/social-api/internal/syndication"
+)
+
+// syndicationFeedSize is the number of newest posts rendered in Atom and RSS feeds
+const syndicationFeedSize = 20
+
+// getUserAtomFeedHandler godoc
+//
+//	@Summary		Fetch user Atom feed
+//	@Description	Fetch the newest public posts of the user as an Atom 1.0 feed. Supports conditional
+//	@Description	requests with If-None-Match and If-Modified-Since.
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		200		{string}	string	"Atom feed"
+//	@Success		304		{string}	string	"Not modified"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/{userID}/feed.atom [get]
+func (app *application) getUserAtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	app.userSyndicationFeed(w, r, "atom")
+}
+
+// getUserRSSFeedHandler godoc
+//
+//	@Summary		Fetch user RSS feed
+//	@Description	Fetch the newest public posts of the user as an RSS 2.0 feed. Supports conditional
+//	@Description	requests with If-None-Match and If-Modified-Since.
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		200		{string}	string	"RSS feed"
+//	@Success		304		{string}	string	"Not modified"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/{userID}/feed.rss [get]
+func (app *application) getUserRSSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	app.userSyndicationFeed(w, r, "rss")
+}
+
+func (app *application) userSyndicationFeed(w http.ResponseWriter, r *http.Request, format string) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil || userID < 1 {
+		app.badRequestResponse(w, r, errors.New("invalid user ID"))
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer
+	user, err := app.services.Users.GetUserByID(ctx, userID, true)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	page, err := app.services.Posts.GetUserPosts(ctx, userID, syndicationFeedQuery())
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	base := app.baseURL()
+	feed := &syndication.Feed{
+		ID:       fmt.Sprintf("%s/v1/users/%d", base, userID),
+		Title:    "Posts by " + user.Username,
+		Link:     fmt.Sprintf("%s/v1/users/%d", base, userID),
+		SelfLink: fmt.Sprintf("%s/v1/users/%d/feed.%s", base, userID, format),
+		Updated:  parsePostTime(user.CreatedAt),
+		Entries:  app.syndicationEntries(page.Posts),
+	}
+
+	app.syndicationResponse(w, r, feed, format)
+}
+
+// getTagAtomFeedHandler godoc
+//
+//	@Summary		Fetch tag Atom feed
+//	@Description	Fetch the newest public posts with the tag as an Atom 1.0 feed. Supports conditional
+//	@Description	requests with If-None-Match and If-Modified-Since.
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		200	{string}	string	"Atom feed"
+//	@Success		304	{string}	string	"Not modified"
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/tags/{tag}/feed.atom [get]
+func (app *application) getTagAtomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	tag := chi.URLParam(r, "tag")
+	if tag == "" || len(tag) > 100 {
+		app.badRequestResponse(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	fq := syndicationFeedQuery()
+	fq.Tags = []string{tag}
+
+	ctx := r.Context()
+
+	// Service layer, anonymous readers only get public posts of public accounts
+	page, err := app.services.Posts.GetExploreFeed(ctx, 0, fq)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	base := app.baseURL()
+	tagPath := url.PathEscape(tag)
+	feed := &syndication.Feed{
+		ID:       fmt.Sprintf("%s/v1/tags/%s", base, tagPath),
+		Title:    "Posts tagged #" + tag,
+		Link:     fmt.Sprintf("%s/v1/tags/%s/posts", base, tagPath),
+		SelfLink: fmt.Sprintf("%s/v1/tags/%s/feed.atom", base, tagPath),
+		Entries:  app.syndicationEntries(page.Posts),
+	}
+
+	app.syndicationResponse(w, r, feed, "atom")
+}
+
+func syndicationFeedQuery() store.PaginatedFeedQuery {
+	return store.PaginatedFeedQuery{
+		Limit: syndicationFeedSize,
+		Sort:  "desc",
+		Mode:  store.FeedModeChronological,
+	}
+}
+
+// baseURL is the public URL of the API, with its scheme, that absolute links are built from
+func (app *application) baseURL() string {
+	return strings.TrimSuffix(app.config.baseURL, "/")
+}
+
+func (app *application) syndicationEntries(posts []store.PostWithMetadata) []syndication.Entry {
+	base := app.baseURL()
+
+	entries := make([]syndication.Entry, 0, len(posts))
+	for _, p := range posts {
+		published := parsePostTime(p.CreatedAt)
+		updated := parsePostTime(p.UpdatedAt)
+		if updated.Before(published) {
+			updated = published
+		}
+
+		entries = append(entries, syndication.Entry{
+			ID:         fmt.Sprintf("%s/v1/posts/%d", base, p.ID),
+			Title:      p.Title,
+			Link:       fmt.Sprintf("%s/v1/posts/%d", base, p.ID),
+			Content:    p.Content,
+			Author:     p.User.Username,
+			Categories: p.Tags,
+			Published:  published,
+			Updated:    updated,
+			Version:    p.Version,
+		})
+	}
+
+	return entries
+}
+
+// syndicationResponse renders feed in format unless the client already has it: If-None-Match
+// takes precedence over If-Modified-Since as in RFC 9110
+func (app *application) syndicationResponse(w http.ResponseWriter, r *http.Request, feed *syndication.Feed, format string) {
+	etag := feed.ETag(format)
+	lastModified := feed.LastModified()
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+	switch format {
+	case "rss":
+		body, err = feed.RSS()
+		contentType = syndication.RSSContentType
+	default:
+		body, err = feed.Atom()
+		contentType = syndication.AtomContentType
+	}
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.After(t)
+	}
+
+	return false
+}
+
+// parsePostTime parses a timestamp read from Postgres, zero when it is empty or malformed
+func parsePostTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/service"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSyndicationFeeds(t *testing.T) {
+	app := newTestApplication(t, config{baseURL: "https://api.example.com/"})
+	mux := app.mount()
+
+	mockUserService := app.services.Users.(*service.MockUserService)
+	mockPostService := app.services.Posts.(*service.MockPostService)
+
+	page := &store.FeedPage{Posts: []store.PostWithMetadata{{
+		Post: store.Post{
+			ID:        7,
+			UserID:    1,
+			Title:     "Hello",
+			Content:   "First post",
+			Tags:      []string{"golang"},
+			CreatedAt: "2025-01-01T00:00:00.123456Z",
+			UpdatedAt: "2025-01-02T10:00:00Z",
+			Version:   1,
+			User:      store.User{Username: "alice"},
+		},
+	}}}
+
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1, Username: "alice", CreatedAt: "2024-12-01T00:00:00Z"}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(2), true).Return(nil, service.ErrUserNotFound)
+	mockPostService.On("GetUserPosts", mock.Anything, int64(1), mock.Anything).Return(page, nil)
+	mockPostService.On("GetExploreFeed", mock.Anything, int64(0), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+		return len(q.Tags) == 1 && q.Tags[0] == "golang"
+	})).Return(page, nil)
+
+	t.Run("Serve a user Atom feed without authentication", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+			t.Errorf("expected an Atom content type, got %q", ct)
+		}
+		if lm := w.Header().Get("Last-Modified"); lm != "Thu, 02 Jan 2025 10:00:00 GMT" {
+			t.Errorf("unexpected Last-Modified %q", lm)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "<id>https://api.example.com/v1/posts/7</id>") || !strings.Contains(body, "<updated>2025-01-02T10:00:00Z</updated>") {
+			t.Errorf("unexpected feed body: %s", body)
+		}
+	})
+
+	t.Run("Serve a user RSS feed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/feed.rss", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Body.String(), `<rss version="2.0"`) {
+			t.Errorf("expected an RSS document, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("Answer 304 to a matching ETag", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		etag := executeRequest(req, mux).Header().Get("ETag")
+		req.Header.Set("If-None-Match", etag)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotModified, w.Code)
+		if w.Body.Len() != 0 {
+			t.Errorf("expected an empty body, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Answer 304 when not modified since", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/feed.rss", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Modified-Since", "Fri, 03 Jan 2025 00:00:00 GMT")
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotModified, w.Code)
+	})
+
+	t.Run("Return 404 for an unknown user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Serve a tag Atom feed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/tags/golang/feed.atom", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Body.String(), "<title>Posts tagged #golang</title>") {
+			t.Errorf("unexpected feed body: %s", w.Body.String())
+		}
+	})
+}
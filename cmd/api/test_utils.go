@@ -31,11 +31,19 @@ func newTestApplication(t *testing.T, cfg config) *application {
 	mockAuthService := &service.MockAuthService{}
 	mockUserService := &service.MockUserService{}
 	mockPostService := &service.MockPostService{}
+	mockAPITokenService := &service.MockAPITokenService{}
+	mockOIDCService := &service.MockOIDCService{}
+	mockSearchService := &service.MockSearchService{}
+	mockMediaService := &service.MockMediaService{}
 
 	services := &service.Services{
-		Users: mockUserService,
-		Posts: mockPostService,
-		Auth:  mockAuthService,
+		Users:     mockUserService,
+		Posts:     mockPostService,
+		Auth:      mockAuthService,
+		APITokens: mockAPITokenService,
+		OIDC:      mockOIDCService,
+		Search:    mockSearchService,
+		Media:     mockMediaService,
 	}
 
 	return &application{
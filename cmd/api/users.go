@@ -12,15 +12,21 @@ type userKey string
 
 const userCtx userKey = "user"
 
+// UserResponse is a user profile with follower counts and the viewer's relation to the user
+type UserResponse struct {
+	*store.User
+	store.FollowStats
+}
+
 // GetUser godoc
 //
 //	@Summary		Fetch user profile
-//	@Description	Fetch user profile by ID
+//	@Description	Fetch user profile by ID with follower counts and whether the viewer and the user follow each other
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	UserResponse
 //	@Failure		400	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
@@ -42,7 +48,13 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	stats, err := app.services.Users.GetFollowStats(ctx, userID, getUserFromCtx(r).ID)
+	if err != nil {
+		app.handleServiceError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, UserResponse{User: user, FollowStats: *stats}); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -51,11 +63,12 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // FollowUser godoc
 //
 //	@Summary		Follow user
-//	@Description	Follow user by ID
+//	@Description	Follow user by ID. Following a private user sends a follow request instead.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			userID	path		int		true	"User ID"
+//	@Success		202		{string}	string	"Follow request sent"
 //	@Success		204		{string}	string	"User followed"
 //	@Failure		400		{object}	error	"User payload missing"
 //	@Failure		404		{object}	error	"User not found"
@@ -73,11 +86,17 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 	ctx := r.Context()
 
 	// Service layer
-	if err := app.services.Users.FollowUser(ctx, followerUser.ID, followedUserID); err != nil {
+	requested, err := app.services.Users.FollowUser(ctx, followerUser.ID, followedUserID)
+	if err != nil {
 		app.handleServiceError(w, r, err)
 		return
 	}
 
+	if requested {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -142,6 +161,43 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// ResendActivation godoc
+//
+//	@Summary		Resend activation email
+//	@Description	Issues a fresh invitation for an inactive account. The response is the same whether the email exists or not
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationPayload	true	"Account email"
+//	@Success		202		{string}	string					"Activation email requested"
+//	@Failure		400		{object}	error
+//	@Router			/users/activate/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// Service layer. Failures are logged so the response does not reveal the account state
+	if err := app.services.Users.ResendActivation(ctx, payload.Email); err != nil {
+		app.logger.Errorw("Resend activation failed", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
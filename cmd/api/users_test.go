@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/n-korel/social-api/internal/service"
@@ -38,7 +39,7 @@ func TestGetUser(t *testing.T) {
 		mockAuthService := app.services.Auth.(*service.MockAuthService)
 		mockUserService := app.services.Users.(*service.MockUserService)
 		
-		mockAuthService.On("ValidateToken", testToken).Return(int64(1), nil).Once()
+		mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil).Once()
 		
 		expectedUser := &store.User{
 			ID:       1,
@@ -50,6 +51,7 @@ func TestGetUser(t *testing.T) {
 			},
 		}
 		mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(expectedUser, nil)
+		mockUserService.On("GetFollowStats", mock.Anything, int64(1), int64(1)).Return(&store.FollowStats{FollowersCount: 3}, nil)
 
 		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
 		if err != nil {
@@ -65,4 +67,203 @@ func TestGetUser(t *testing.T) {
 		mockAuthService.AssertExpectations(t)
 		mockUserService.AssertExpectations(t)
 	})
-}
\ No newline at end of file
+}
+func TestFollowLists(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("List followers with a next page", func(t *testing.T) {
+		mockUserService.On("GetFollowers", mock.Anything, int64(2), int64(1), store.FollowListQuery{Limit: 1}).Return(&service.FollowPage{
+			Users:      []store.FollowEntry{{ID: 3, Username: "gopher", FollowedByViewer: true}},
+			NextCursor: "next",
+		}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/followers?limit=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Body.String(), `"followed_by_viewer":true`) || !strings.Contains(w.Body.String(), `"next_cursor":"next"`) {
+			t.Errorf("unexpected body: %s", w.Body.String())
+		}
+		if !strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+			t.Errorf("missing Link header: %v", w.Header())
+		}
+	})
+
+	t.Run("List following of an unknown user", func(t *testing.T) {
+		mockUserService.On("GetFollowing", mock.Anything, int64(9), int64(1), store.FollowListQuery{Limit: 20}).Return(nil, service.ErrUserNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/9/following", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Reject an invalid cursor", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/followers?cursor=bogus", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestBlockAndMute(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("Block a user", func(t *testing.T) {
+		mockUserService.On("BlockUser", mock.Anything, int64(1), int64(2)).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/2/block", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Cannot mute yourself", func(t *testing.T) {
+		mockUserService.On("MuteUser", mock.Anything, int64(1), int64(1)).Return(service.ErrCannotBlockSelf).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/1/mute", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Cannot follow a blocked user", func(t *testing.T) {
+		mockUserService.On("FollowUser", mock.Anything, int64(1), int64(3)).Return(false, service.ErrUserBlocked).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/3/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestFollowRequests(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAuthService := app.services.Auth.(*service.MockAuthService)
+	mockUserService := app.services.Users.(*service.MockUserService)
+
+	mockAuthService.On("ValidateToken", mock.Anything, testToken).Return(&service.TokenClaims{UserID: 1}, nil)
+	mockUserService.On("GetUserByID", mock.Anything, int64(1), true).Return(&store.User{ID: 1}, nil)
+
+	t.Run("Following a private user is accepted for approval", func(t *testing.T) {
+		mockUserService.On("FollowUser", mock.Anything, int64(1), int64(2)).Return(true, nil).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/2/follow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusAccepted, w.Code)
+	})
+
+	t.Run("List pending requests", func(t *testing.T) {
+		mockUserService.On("GetFollowRequests", mock.Anything, int64(1), store.FollowListQuery{Limit: 20}).Return(&service.FollowPage{
+			Users: []store.FollowEntry{{ID: 2, Username: "gopher"}},
+		}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/follow-requests", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, w.Code)
+		if !strings.Contains(w.Body.String(), `"username":"gopher"`) {
+			t.Errorf("unexpected body: %s", w.Body.String())
+		}
+	})
+
+	t.Run("Accept a request", func(t *testing.T) {
+		mockUserService.On("AcceptFollowRequest", mock.Anything, int64(1), int64(2)).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/follow-requests/2/accept", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Reject an unknown request", func(t *testing.T) {
+		mockUserService.On("RejectFollowRequest", mock.Anything, int64(1), int64(3)).Return(service.ErrFollowRequestNotFound).Once()
+
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/me/follow-requests/3/reject", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		w := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti uuid PRIMARY KEY,
+  expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expiry ON revoked_tokens (expiry);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+  user_id bigint PRIMARY KEY,
+  revoked_at timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
\ No newline at end of file
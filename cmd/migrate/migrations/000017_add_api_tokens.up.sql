@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  name varchar(100) NOT NULL,
+  token bytea NOT NULL UNIQUE,
+  scopes varchar(50) [] NOT NULL,
+  expiry timestamp(0) with time zone,
+  last_used_at timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
\ No newline at end of file
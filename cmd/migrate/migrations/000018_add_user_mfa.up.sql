@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id bigint PRIMARY KEY,
+  secret varchar(64) NOT NULL,
+  last_used_step bigint NOT NULL DEFAULT 0,
+  confirmed_at timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  code bytea NOT NULL,
+  used_at timestamp(0) with time zone,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  UNIQUE (user_id, code)
+);
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  provider varchar(50) NOT NULL,
+  subject varchar(255) NOT NULL,
+  email citext,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+  state bytea PRIMARY KEY,
+  provider varchar(50) NOT NULL,
+  code_verifier varchar(128) NOT NULL,
+  nonce varchar(128) NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL
+);
\ No newline at end of file
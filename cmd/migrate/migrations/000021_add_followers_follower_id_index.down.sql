@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_followers_follower_id;
\ No newline at end of file
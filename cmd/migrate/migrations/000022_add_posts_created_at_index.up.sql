@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_posts_created_at_id ON posts (created_at, id);
\ No newline at end of file
@@ -0,0 +1,18 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'english';
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector(language, coalesce(title, '')), 'A') ||
+    setweight(to_tsvector(language, coalesce(content, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'english';
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector(language, coalesce(content, ''))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING gin (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
\ No newline at end of file
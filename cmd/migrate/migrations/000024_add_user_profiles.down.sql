@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS email_changes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS username_changed_at,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS website,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS display_name;
\ No newline at end of file
@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS bio text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS location varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url varchar(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS username_changed_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS email_changes (
+  token bytea PRIMARY KEY,
+  user_id bigint NOT NULL,
+  new_email citext NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS avatar_media_id;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS media_ids;
+
+DROP TABLE IF EXISTS media;
\ No newline at end of file
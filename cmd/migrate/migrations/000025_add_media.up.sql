@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS media (
+  id uuid PRIMARY KEY,
+  user_id bigint NOT NULL,
+  content_type varchar(50) NOT NULL,
+  size bigint NOT NULL,
+  width int NOT NULL,
+  height int NOT NULL,
+  storage_key varchar(255) NOT NULL,
+  thumbnail_key varchar(255) NOT NULL,
+  thumbnail_content_type varchar(50) NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS media_ids uuid[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS avatar_media_id uuid REFERENCES media (id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_created_at ON followers (user_id, created_at DESC, follower_id DESC);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_created_at ON followers (follower_id, created_at DESC, user_id DESC);
+
+DROP INDEX IF EXISTS idx_followers_follower_id;
\ No newline at end of file
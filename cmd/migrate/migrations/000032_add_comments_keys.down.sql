@@ -0,0 +1,5 @@
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_user_id_fkey;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_post_id_fkey;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_pkey;
\ No newline at end of file
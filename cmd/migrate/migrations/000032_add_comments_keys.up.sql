@@ -0,0 +1,9 @@
+DELETE FROM comments c
+WHERE NOT EXISTS (SELECT 1 FROM posts p WHERE p.id = c.post_id)
+   OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = c.user_id);
+
+ALTER TABLE comments ADD CONSTRAINT comments_pkey PRIMARY KEY (id);
+
+ALTER TABLE comments ADD CONSTRAINT comments_post_id_fkey FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+ALTER TABLE comments ADD CONSTRAINT comments_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
\ No newline at end of file
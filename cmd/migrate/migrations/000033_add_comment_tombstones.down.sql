@@ -0,0 +1,3 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_parent_id_fkey;
\ No newline at end of file
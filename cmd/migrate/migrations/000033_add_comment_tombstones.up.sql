@@ -0,0 +1,11 @@
+WITH RECURSIVE orphans AS (
+    SELECT c.id FROM comments c
+    WHERE c.parent_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM comments p WHERE p.id = c.parent_id)
+    UNION ALL
+    SELECT c.id FROM comments c JOIN orphans o ON c.parent_id = o.id
+)
+DELETE FROM comments WHERE id IN (SELECT id FROM orphans);
+
+ALTER TABLE comments ADD CONSTRAINT comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
\ No newline at end of file
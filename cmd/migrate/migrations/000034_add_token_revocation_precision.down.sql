@@ -0,0 +1 @@
+ALTER TABLE user_token_revocations ALTER COLUMN revoked_at TYPE timestamp(0) with time zone;
\ No newline at end of file
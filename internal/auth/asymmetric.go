@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto"
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AsymmetricAuthenticator signs tokens with an RSA (RS256) or Ed25519 (EdDSA) private key.
+// Tokens carry the key id in the kid header, so tokens signed with a previous key keep
+// validating while its public key is listed among the verification keys.
+type AsymmetricAuthenticator struct {
+	signingKey crypto.Signer
+	signing    verificationKey
+	verifyKeys map[string]verificationKey
+	audience   string
+	issue      string
+}
+
+func NewAsymmetricAuthenticator(signingKeyFile string, verifyKeyFiles []string, audience, issue string) (*AsymmetricAuthenticator, error) {
+	signingKey, err := loadPrivateKey(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	signing, err := newVerificationKey(signingKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	a := &AsymmetricAuthenticator{
+		signingKey: signingKey,
+		signing:    signing,
+		verifyKeys: map[string]verificationKey{signing.kid: signing},
+		audience:   audience,
+		issue:      issue,
+	}
+
+	for _, file := range verifyKeyFiles {
+		publicKey, err := loadPublicKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load verification key: %w", err)
+		}
+
+		key, err := newVerificationKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		a.verifyKeys[key.kid] = key
+	}
+
+	return a, nil
+}
+
+func (a *AsymmetricAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.signing.method, claims)
+	token.Header["kid"] = a.signing.kid
+
+	tokenString, err := token.SignedString(a.signingKey)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func (a *AsymmetricAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing kid header")
+		}
+
+		key, ok := a.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+
+		// The algorithm is bound to the key, never taken from the token alone
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+
+		return key.key, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.audience),
+		jwt.WithIssuer(a.issue),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+// KeySet returns every key tokens are currently verified with, the signing key first
+func (a *AsymmetricAuthenticator) KeySet() JSONWebKeySet {
+	set := JSONWebKeySet{
+		Keys: []JSONWebKey{a.signing.jwk()},
+	}
+
+	previous := []JSONWebKey{}
+	for kid, key := range a.verifyKeys {
+		if kid == a.signing.kid {
+			continue
+		}
+		previous = append(previous, key.jwk())
+	}
+
+	sort.Slice(previous, func(i, j int) bool {
+		return previous[i].Kid < previous[j].Kid
+	})
+
+	set.Keys = append(set.Keys, previous...)
+
+	return set
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, key any, public bool) string {
+	t.Helper()
+
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "key-*.pem")
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, pem.Encode(f, block))
+
+	return filepath.Clean(f.Name())
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return key
+}
+
+func testTokenClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": 1,
+		"aud": "test-aud",
+		"iss": "test-aud",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestAsymmetricAuthenticator(t *testing.T) {
+	keys := map[string]any{
+		"RS256": newRSAKey(t),
+		"EdDSA": newEd25519Key(t),
+	}
+
+	for alg, key := range keys {
+		t.Run(alg, func(t *testing.T) {
+			a, err := NewAsymmetricAuthenticator(writeKey(t, key, false), nil, "test-aud", "test-aud")
+			require.NoError(t, err)
+
+			token, err := a.GenerateToken(testTokenClaims())
+			require.NoError(t, err)
+
+			parsed, err := a.ValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, alg, parsed.Method.Alg())
+			assert.Equal(t, a.signing.kid, parsed.Header["kid"])
+
+			set := a.KeySet()
+			require.Len(t, set.Keys, 1)
+			assert.Equal(t, alg, set.Keys[0].Alg)
+			assert.Equal(t, a.signing.kid, set.Keys[0].Kid)
+		})
+	}
+}
+
+func TestAsymmetricAuthenticator_Rotation(t *testing.T) {
+	oldKey := newRSAKey(t)
+	newKey := newEd25519Key(t)
+
+	oldAuth, err := NewAsymmetricAuthenticator(writeKey(t, oldKey, false), nil, "test-aud", "test-aud")
+	require.NoError(t, err)
+
+	oldToken, err := oldAuth.GenerateToken(testTokenClaims())
+	require.NoError(t, err)
+
+	t.Run("previous key still verifies", func(t *testing.T) {
+		a, err := NewAsymmetricAuthenticator(
+			writeKey(t, newKey, false),
+			[]string{writeKey(t, oldKey.Public(), true)},
+			"test-aud",
+			"test-aud",
+		)
+		require.NoError(t, err)
+
+		_, err = a.ValidateToken(oldToken)
+		assert.NoError(t, err)
+
+		set := a.KeySet()
+		require.Len(t, set.Keys, 2)
+		assert.Equal(t, "OKP", set.Keys[0].Kty)
+		assert.Equal(t, "RSA", set.Keys[1].Kty)
+		assert.Equal(t, oldAuth.signing.kid, set.Keys[1].Kid)
+	})
+
+	t.Run("retired key is rejected", func(t *testing.T) {
+		a, err := NewAsymmetricAuthenticator(writeKey(t, newKey, false), nil, "test-aud", "test-aud")
+		require.NoError(t, err)
+
+		_, err = a.ValidateToken(oldToken)
+		assert.Error(t, err)
+	})
+}
+
+func TestAsymmetricAuthenticator_RejectsForgedTokens(t *testing.T) {
+	key := newRSAKey(t)
+	a, err := NewAsymmetricAuthenticator(writeKey(t, key, false), nil, "test-aud", "test-aud")
+	require.NoError(t, err)
+
+	t.Run("HS256 signed with the public key", func(t *testing.T) {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testTokenClaims())
+		token.Header["kid"] = a.signing.kid
+		forged, err := token.SignedString(der)
+		require.NoError(t, err)
+
+		_, err = a.ValidateToken(forged)
+		assert.Error(t, err)
+	})
+
+	t.Run("small RSA key", func(t *testing.T) {
+		small, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+
+		_, err = NewAsymmetricAuthenticator(writeKey(t, small, false), nil, "test-aud", "test-aud")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B vectors for SHA1, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(secret, v.code, time.Unix(v.unix, 0))
+		assert.True(t, ok, "code %s at %d", v.code, v.unix)
+		assert.Equal(t, v.unix/totpPeriod, step)
+	}
+
+	t.Run("accepts one step of clock drift", func(t *testing.T) {
+		step, ok := ValidateTOTP(secret, "287082", time.Unix(59+totpPeriod, 0))
+		assert.True(t, ok)
+		assert.Equal(t, int64(1), step)
+	})
+
+	t.Run("rejects codes outside the window", func(t *testing.T) {
+		_, ok := ValidateTOTP(secret, "287082", time.Unix(59+3*totpPeriod, 0))
+		assert.False(t, ok)
+	})
+
+	t.Run("rejects malformed input", func(t *testing.T) {
+		_, ok := ValidateTOTP(secret, "28708", time.Unix(59, 0))
+		assert.False(t, ok)
+
+		_, ok = ValidateTOTP("not base32!", "287082", time.Unix(59, 0))
+		assert.False(t, ok)
+	})
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	uri := TOTPURI(secret, "GopherSocial", "gopher@example.com")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/GopherSocial:gopher@example.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=GopherSocial")
+}
@@ -3,9 +3,12 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "Social Forum Golang"
-	maxRetires          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "Social Forum Golang"
+	maxRetires            = 3
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+	AccountLockedTemplate = "account_locked.tmpl"
+	EmailChangeTemplate   = "email_change.tmpl"
 )
 
 //go:embed "templates"
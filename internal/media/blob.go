@@ -0,0 +1,33 @@
+// Package media stores uploaded files and processes uploaded images
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+// BlobStore keeps uploaded files by key. Keys are slash separated relative paths.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get returns ErrBlobNotFound for unknown keys
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds for unknown keys
+	Delete(ctx context.Context, key string) error
+}
+
+// cleanKey rejects keys that are empty or escape the store root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
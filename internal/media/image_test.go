@@ -0,0 +1,85 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	t.Run("reads type and dimensions", func(t *testing.T) {
+		info, err := Inspect(encodePNG(t, 30, 20))
+		require.NoError(t, err)
+		assert.Equal(t, ImageInfo{ContentType: "image/png", Width: 30, Height: 20}, info)
+	})
+
+	t.Run("rejects non images", func(t *testing.T) {
+		_, err := Inspect([]byte("<html><script>alert(1)</script></html>"))
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+	})
+
+	t.Run("rejects truncated images", func(t *testing.T) {
+		_, err := Inspect(encodePNG(t, 30, 20)[:12])
+		assert.ErrorIs(t, err, ErrInvalidImage)
+	})
+}
+
+func TestThumbnail(t *testing.T) {
+	t.Run("scales down keeping the aspect ratio", func(t *testing.T) {
+		data, contentType, err := Thumbnail(encodePNG(t, 400, 100), 100)
+		require.NoError(t, err)
+		assert.Equal(t, "image/png", contentType)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 100, 25), img.Bounds())
+
+		r, _, _, a := img.At(50, 10).RGBA()
+		assert.Equal(t, uint32(200*0x101), r)
+		assert.Equal(t, uint32(0xffff), a)
+	})
+
+	t.Run("keeps small images", func(t *testing.T) {
+		data, _, err := Thumbnail(encodePNG(t, 10, 20), 100)
+		require.NoError(t, err)
+
+		info, err := Inspect(data)
+		require.NoError(t, err)
+		assert.Equal(t, 10, info.Width)
+		assert.Equal(t, 20, info.Height)
+	})
+
+	t.Run("keeps JPEGs as JPEGs", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 300, 300)), nil))
+
+		data, contentType, err := Thumbnail(buf.Bytes(), 100)
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", contentType)
+
+		info, err := Inspect(data)
+		require.NoError(t, err)
+		assert.Equal(t, 100, info.Width)
+	})
+}
@@ -0,0 +1,51 @@
+package media
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	t.Run("puts and gets a blob", func(t *testing.T) {
+		require.NoError(t, s.Put(ctx, "media/a.png", strings.NewReader("data"), 4, "image/png"))
+
+		body, err := s.Get(ctx, "media/a.png")
+		require.NoError(t, err)
+		defer body.Close()
+
+		got, err := io.ReadAll(body)
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(got))
+	})
+
+	t.Run("returns ErrBlobNotFound for unknown keys", func(t *testing.T) {
+		_, err := s.Get(ctx, "media/missing.png")
+		assert.ErrorIs(t, err, ErrBlobNotFound)
+	})
+
+	t.Run("deletes blobs", func(t *testing.T) {
+		require.NoError(t, s.Put(ctx, "media/gone.png", strings.NewReader("x"), 1, "image/png"))
+		require.NoError(t, s.Delete(ctx, "media/gone.png"))
+		require.NoError(t, s.Delete(ctx, "media/gone.png"))
+
+		_, err := s.Get(ctx, "media/gone.png")
+		assert.ErrorIs(t, err, ErrBlobNotFound)
+	})
+
+	t.Run("rejects keys outside the root", func(t *testing.T) {
+		for _, key := range []string{"", "../etc/passwd", "/abs", "media/../../x", `media\x`} {
+			err := s.Put(ctx, key, strings.NewReader("x"), 1, "image/png")
+			assert.ErrorIs(t, err, ErrInvalidKey, key)
+		}
+	})
+}
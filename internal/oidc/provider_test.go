@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	t.Cleanup(mock.Close)
+
+	provider, err := NewProvider(context.Background(), Config{
+		IssuerURL:    mock.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/v1/authentication/oidc/test/callback",
+	})
+	require.NoError(t, err)
+
+	return mock, provider
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	mock, provider := newTestProvider(t)
+
+	verifier, err := RandomString()
+	require.NoError(t, err)
+
+	authURL := provider.AuthCodeURL("state", "nonce", S256Challenge(verifier))
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	t.Run("exchanges the code and verifies the id token", func(t *testing.T) {
+		code, state, err := mock.Authorize(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, "state", state)
+
+		token, err := provider.Exchange(ctx, code, verifier)
+		require.NoError(t, err)
+
+		claims, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce")
+		require.NoError(t, err)
+		assert.Equal(t, mock.User.Subject, claims.Subject)
+		assert.Equal(t, mock.User.Email, claims.Email)
+		assert.True(t, claims.EmailVerified)
+	})
+
+	t.Run("rejects a wrong PKCE verifier", func(t *testing.T) {
+		code, _, err := mock.Authorize(authURL)
+		require.NoError(t, err)
+
+		_, err = provider.Exchange(ctx, code, "wrong-verifier")
+		assert.ErrorIs(t, err, ErrExchangeFailed)
+	})
+
+	t.Run("rejects a nonce mismatch", func(t *testing.T) {
+		code, _, err := mock.Authorize(authURL)
+		require.NoError(t, err)
+
+		token, err := provider.Exchange(ctx, code, verifier)
+		require.NoError(t, err)
+
+		_, err = provider.VerifyIDToken(ctx, token.IDToken, "other-nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+}
+
+func TestNewProvider_IssuerMismatch(t *testing.T) {
+	mock, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	defer mock.Close()
+
+	_, err = NewProvider(context.Background(), Config{
+		IssuerURL: mock.Issuer() + "/",
+		ClientID:  "client",
+	})
+	assert.Error(t, err)
+}
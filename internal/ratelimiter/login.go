@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LoginConfig controls how failed logins are throttled. Every failure blocks the key
+// for an exponentially growing delay, and MaxFailures failures lock it out entirely.
+type LoginConfig struct {
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Backoff returns how long a key is blocked after its nth consecutive failure
+func (c LoginConfig) Backoff(failures int) time.Duration {
+	if failures >= c.MaxFailures {
+		return c.LockoutDuration
+	}
+
+	delay := c.BaseDelay
+	for i := 1; i < failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, c.MaxDelay)
+}
+
+func (c LoginConfig) LockedOut(failures int) bool {
+	return failures >= c.MaxFailures
+}
+
+type loginState struct {
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+// MemoryLoginGuard tracks failed logins in process, for single instance deployments
+type MemoryLoginGuard struct {
+	sync.Mutex
+	config    LoginConfig
+	keys      map[string]*loginState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLoginGuard(config LoginConfig) *MemoryLoginGuard {
+	return NewMemoryLoginGuardWithClock(config, time.Now)
+}
+
+// NewMemoryLoginGuardWithClock returns a guard that reads the time from now, so that tests
+// control when failures happen
+func NewMemoryLoginGuardWithClock(config LoginConfig, now func() time.Time) *MemoryLoginGuard {
+	return &MemoryLoginGuard{
+		config:    config,
+		keys:      make(map[string]*loginState),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+func (g *MemoryLoginGuard) Check(ctx context.Context, key string) (time.Duration, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	state, ok := g.keys[key]
+	if !ok {
+		return 0, nil
+	}
+
+	return max(state.blockedUntil.Sub(g.now()), 0), nil
+}
+
+// Fail records a failed attempt and reports whether it locked key out. While key is blocked
+// the attempt is not counted and Fail returns how long the block lasts instead.
+func (g *MemoryLoginGuard) Fail(ctx context.Context, key string) (time.Duration, bool, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	state, ok := g.keys[key]
+	if ok && now.Before(state.blockedUntil) {
+		return state.blockedUntil.Sub(now), false, nil
+	}
+
+	if !ok || now.Sub(state.lastFailure) > g.config.Window {
+		state = &loginState{}
+		g.keys[key] = state
+	}
+
+	state.failures++
+	state.lastFailure = now
+	state.blockedUntil = now.Add(g.config.Backoff(state.failures))
+
+	return 0, g.config.LockedOut(state.failures), nil
+}
+
+func (g *MemoryLoginGuard) Reset(ctx context.Context, key string) error {
+	g.Lock()
+	defer g.Unlock()
+
+	delete(g.keys, key)
+
+	return nil
+}
+
+// sweep forgets expired keys, at most once per window
+func (g *MemoryLoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.config.Window {
+		return
+	}
+
+	for key, state := range g.keys {
+		if now.Sub(state.lastFailure) > g.config.Window && now.After(state.blockedUntil) {
+			delete(g.keys, key)
+		}
+	}
+
+	g.lastSweep = now
+}
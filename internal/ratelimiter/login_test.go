@@ -0,0 +1,124 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLoginConfig = LoginConfig{
+	MaxFailures:     4,
+	BaseDelay:       time.Second,
+	MaxDelay:        3 * time.Second,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+func TestLoginConfig_Backoff(t *testing.T) {
+	assert.Equal(t, time.Second, testLoginConfig.Backoff(1))
+	assert.Equal(t, 2*time.Second, testLoginConfig.Backoff(2))
+	assert.Equal(t, 3*time.Second, testLoginConfig.Backoff(3), "capped at MaxDelay")
+	assert.Equal(t, time.Minute, testLoginConfig.Backoff(4), "locked out")
+	assert.Equal(t, time.Minute, testLoginConfig.Backoff(10))
+}
+
+// newTestGuard returns a guard whose clock only moves with advance
+func newTestGuard() (*MemoryLoginGuard, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	g := NewMemoryLoginGuardWithClock(testLoginConfig, func() time.Time { return now })
+
+	return g, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryLoginGuard(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("backs off exponentially and locks out", func(t *testing.T) {
+		g, advance := newTestGuard()
+
+		for failures := 1; failures <= testLoginConfig.MaxFailures; failures++ {
+			blockedFor, lockedOut, err := g.Fail(ctx, "key")
+			require.NoError(t, err)
+			assert.Zero(t, blockedFor)
+			assert.Equal(t, failures == testLoginConfig.MaxFailures, lockedOut)
+
+			remaining, err := g.Check(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, testLoginConfig.Backoff(failures), remaining)
+
+			advance(remaining)
+		}
+	})
+
+	t.Run("attempts while blocked are rejected and not counted", func(t *testing.T) {
+		g, advance := newTestGuard()
+
+		_, _, err := g.Fail(ctx, "key")
+		require.NoError(t, err)
+
+		advance(300 * time.Millisecond)
+		for range 10 {
+			blockedFor, lockedOut, err := g.Fail(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, 700*time.Millisecond, blockedFor)
+			assert.False(t, lockedOut)
+		}
+
+		// The next failure is only the second one
+		advance(time.Second)
+		_, _, err = g.Fail(ctx, "key")
+		require.NoError(t, err)
+		remaining, err := g.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Second, remaining)
+	})
+
+	t.Run("failures are forgotten after the window", func(t *testing.T) {
+		g, advance := newTestGuard()
+
+		for range 3 {
+			_, _, err := g.Fail(ctx, "key")
+			require.NoError(t, err)
+			advance(testLoginConfig.MaxDelay)
+		}
+
+		advance(testLoginConfig.Window)
+		_, _, err := g.Fail(ctx, "key")
+		require.NoError(t, err)
+
+		remaining, err := g.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, remaining)
+	})
+
+	t.Run("reset lifts a lockout", func(t *testing.T) {
+		g, advance := newTestGuard()
+
+		for range testLoginConfig.MaxFailures {
+			_, _, err := g.Fail(ctx, "key")
+			require.NoError(t, err)
+			advance(testLoginConfig.MaxDelay)
+		}
+
+		require.NoError(t, g.Reset(ctx, "key"))
+
+		remaining, err := g.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.Zero(t, remaining)
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		g, _ := newTestGuard()
+
+		_, _, err := g.Fail(ctx, "a")
+		require.NoError(t, err)
+
+		remaining, err := g.Check(ctx, "b")
+		require.NoError(t, err)
+		assert.Zero(t, remaining)
+	})
+}
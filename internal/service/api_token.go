@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// APITokenPrefix tells API keys apart from JWTs in the Authorization header
+const APITokenPrefix = "sfa_"
+
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopeFeedRead   = "feed:read"
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+var (
+	ErrAPITokenNotFound = errors.New("api token not found")
+)
+
+type APITokenService struct {
+	store store.Storage
+}
+
+type APITokenServiceInterface interface {
+	CreateToken(ctx context.Context, userID int64, name string, scopes []string, expiresIn time.Duration) (*store.APIToken, string, error)
+	ListTokens(ctx context.Context, userID int64) ([]store.APIToken, error)
+	RevokeToken(ctx context.Context, userID, tokenID int64) error
+	ValidateToken(ctx context.Context, token string) (*TokenClaims, error)
+}
+
+func NewAPITokenService(store store.Storage) *APITokenService {
+	return &APITokenService{
+		store: store,
+	}
+}
+
+// CreateToken returns the stored token and the plain API key, which is only shown once.
+// A zero expiresIn creates a key that never expires.
+func (s *APITokenService) CreateToken(ctx context.Context, userID int64, name string, scopes []string, expiresIn time.Duration) (*store.APIToken, string, error) {
+	plainToken, err := generateAPIToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+
+	token := &store.APIToken{
+		UserID: userID,
+		Name:   name,
+		Token:  hashToken(plainToken),
+		Scopes: scopes,
+	}
+
+	if expiresIn > 0 {
+		expiry := time.Now().Add(expiresIn)
+		token.Expiry = &expiry
+	}
+
+	if err := s.store.APITokens.Create(ctx, token); err != nil {
+		return nil, "", fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return token, plainToken, nil
+}
+
+func (s *APITokenService) ListTokens(ctx context.Context, userID int64) ([]store.APIToken, error) {
+	tokens, err := s.store.APITokens.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *APITokenService) RevokeToken(ctx context.Context, userID, tokenID int64) error {
+	if err := s.store.APITokens.Delete(ctx, tokenID, userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrAPITokenNotFound
+		}
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *APITokenService) ValidateToken(ctx context.Context, token string) (*TokenClaims, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	apiToken, err := s.store.APITokens.GetByToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+
+	if apiToken.Expiry != nil && time.Now().After(*apiToken.Expiry) {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.store.APITokens.Touch(ctx, apiToken.ID); err != nil {
+		return nil, fmt.Errorf("failed to update api token usage: %w", err)
+	}
+
+	claims := &TokenClaims{
+		UserID:     apiToken.UserID,
+		APITokenID: apiToken.ID,
+		Scopes:     apiToken.Scopes,
+	}
+	if apiToken.Expiry != nil {
+		claims.ExpiresAt = *apiToken.Expiry
+	}
+
+	return claims, nil
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return APITokenPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockAPITokenStore struct {
+	mock.Mock
+}
+
+func (m *MockAPITokenStore) Create(ctx context.Context, token *store.APIToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockAPITokenStore) GetByUserID(ctx context.Context, userID int64) ([]store.APIToken, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenStore) GetByToken(ctx context.Context, token string) (*store.APIToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenStore) Touch(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockAPITokenStore) Delete(ctx context.Context, id, userID int64) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockAPITokenStore) DeleteByUserID(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestAPITokenService_CreateToken(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores hashed token and returns plain one", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		var stored *store.APIToken
+		mockAPITokenStore.On("Create", ctx, mock.Anything).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*store.APIToken) }).
+			Return(nil)
+
+		// Execute
+		token, plainToken, err := service.CreateToken(ctx, 1, "bot", []string{ScopePostsRead}, time.Hour)
+
+		// Assert
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(plainToken, APITokenPrefix))
+		assert.Equal(t, hashToken(plainToken), stored.Token)
+		assert.Equal(t, []string{ScopePostsRead}, token.Scopes)
+		require.NotNil(t, token.Expiry)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *token.Expiry, time.Minute)
+	})
+
+	t.Run("zero expiry never expires", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		mockAPITokenStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		// Execute
+		token, _, err := service.CreateToken(ctx, 1, "bot", []string{ScopePostsRead}, 0)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Nil(t, token.Expiry)
+	})
+}
+
+func TestAPITokenService_RevokeToken(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockAPITokenStore := new(MockAPITokenStore)
+	service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+	mockAPITokenStore.On("Delete", ctx, int64(2), int64(1)).Return(store.ErrNotFound)
+
+	// Execute
+	err := service.RevokeToken(ctx, 1, 2)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrAPITokenNotFound)
+}
+
+func TestAPITokenService_ValidateToken(t *testing.T) {
+	ctx := context.Background()
+
+	plainToken := APITokenPrefix + "secret"
+
+	t.Run("valid token returns its claims", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		mockAPITokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(&store.APIToken{
+			ID:     2,
+			UserID: 1,
+			Scopes: []string{ScopeFeedRead},
+		}, nil)
+		mockAPITokenStore.On("Touch", ctx, int64(2)).Return(nil)
+
+		// Execute
+		claims, err := service.ValidateToken(ctx, plainToken)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), claims.UserID)
+		assert.Equal(t, int64(2), claims.APITokenID)
+		assert.Equal(t, []string{ScopeFeedRead}, claims.Scopes)
+		mockAPITokenStore.AssertExpectations(t)
+	})
+
+	t.Run("token without prefix is not looked up", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		// Execute
+		_, err := service.ValidateToken(ctx, "secret")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		mockAPITokenStore.AssertNotCalled(t, "GetByToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		mockAPITokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(nil, store.ErrNotFound)
+
+		// Execute
+		_, err := service.ValidateToken(ctx, plainToken)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		// Setup
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := NewAPITokenService(store.Storage{APITokens: mockAPITokenStore})
+
+		expiry := time.Now().Add(-time.Minute)
+		mockAPITokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(&store.APIToken{
+			ID:     2,
+			UserID: 1,
+			Expiry: &expiry,
+		}, nil)
+
+		// Execute
+		_, err := service.ValidateToken(ctx, plainToken)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		mockAPITokenStore.AssertNotCalled(t, "Touch", mock.Anything, mock.Anything)
+	})
+}
@@ -2,65 +2,606 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/n-korel/social-api/internal/auth"
+	"github.com/n-korel/social-api/internal/mailer"
 	"github.com/n-korel/social-api/internal/store"
+	"go.uber.org/zap"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid email or password")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	ErrInvalidResetToken  = errors.New("invalid or expired password reset token")
+	ErrLoginThrottled     = errors.New("too many failed login attempts")
 )
 
+// LoginThrottledError tells how long the client has to wait before trying to log in again
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLoginThrottled, e.RetryAfter)
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
 type AuthService struct {
 	store         store.Storage
+	cache         CacheStorage
+	mailer        mailer.Client
 	authenticator auth.Authenticator
+	loginGuard    LoginGuard
 	config        AuthServiceConfig
+	// Work finishing after the request, like password reset emails
+	background *backgroundTasks
 }
 
 type AuthServiceConfig struct {
-	TokenExpiration time.Duration
-	TokenHost       string
+	TokenExpiration         time.Duration
+	RefreshTokenExpiration  time.Duration
+	TokenHost               string
+	FrontendURL             string
+	PasswordResetExpiration time.Duration
+	IsProductionEnv         bool
+	MFAIssuer               string
+	MFAChallengeExpiration  time.Duration
+	LoginLockoutDuration    time.Duration
+	// MFARequiredRoleLevel forces users with this role level or above into 2FA, 0 disables it
+	MFARequiredRoleLevel int
+	// Logger reports failures that do not fail the request, they are discarded when nil
+	Logger *zap.SugaredLogger
+}
+
+// TokenPair is a short-lived access token with the refresh token used to renew it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// TokenClaims are the validated claims of an access token or API key.
+// Scopes is nil for session tokens, which are not restricted.
+type TokenClaims struct {
+	UserID     int64
+	ID         string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	APITokenID int64
+	Scopes     []string
+}
+
+func (c *TokenClaims) IsAPIToken() bool {
+	return c.APITokenID != 0
+}
+
+func (c *TokenClaims) HasScope(scope string) bool {
+	if !c.IsAPIToken() {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
+
+// TokenRevocationList is backed by Redis when enabled and by Postgres otherwise
+type TokenRevocationList interface {
+	Revoke(ctx context.Context, jti string, expiry time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error
+	UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error)
+}
+
+// LoginGuard throttles failed logins per key, backed by Redis when enabled and memory otherwise
+type LoginGuard interface {
+	// Check returns how long key is still blocked, zero if it may try to log in
+	Check(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt and reports whether it locked key out. While key is blocked
+	// the attempt is not counted and Fail returns how long the block lasts instead. Checking and
+	// counting in one step keeps parallel attempts from getting past the threshold.
+	Fail(ctx context.Context, key string) (blockedFor time.Duration, lockedOut bool, err error)
+	Reset(ctx context.Context, key string) error
 }
 
 type AuthServiceInterface interface {
-	CreateToken(ctx context.Context, email, password string) (string, error)
-	ValidateToken(token string) (int64, error)
+	CreateToken(ctx context.Context, email, password, clientIP string) (*TokenPair, *MFAChallenge, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error)
+	ValidateToken(ctx context.Context, token string) (*TokenClaims, error)
+	Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error
+	LogoutAll(ctx context.Context, userID int64) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string) (*TokenPair, []string, error)
+	StartMFAEnrollment(ctx context.Context, mfaToken string) (*TOTPEnrollment, error)
+	EnrollTOTP(ctx context.Context, user *store.User) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, user *store.User, code string) error
+	UnlockUser(ctx context.Context, userID int64) error
+	Shutdown(ctx context.Context) error
 }
 
-func NewAuthService(store store.Storage, authenticator auth.Authenticator, config AuthServiceConfig) *AuthService {
+func NewAuthService(store store.Storage, cache CacheStorage, mailer mailer.Client, authenticator auth.Authenticator, loginGuard LoginGuard, config AuthServiceConfig) *AuthService {
+	if config.Logger == nil {
+		config.Logger = zap.NewNop().Sugar()
+	}
+
 	return &AuthService{
 		store:         store,
+		cache:         cache,
+		mailer:        mailer,
 		authenticator: authenticator,
+		loginGuard:    loginGuard,
 		config:        config,
+		background:    newBackgroundTasks(backgroundTaskLimit),
 	}
 }
 
-func (s *AuthService) CreateToken(ctx context.Context, email, password string) (string, error) {
+// Shutdown waits for the work still running after its request, like password reset emails,
+// until ctx is done
+func (s *AuthService) Shutdown(ctx context.Context) error {
+	return s.background.Wait(ctx)
+}
+
+func (s *AuthService) CreateToken(ctx context.Context, email, password, clientIP string) (*TokenPair, *MFAChallenge, error) {
+	// Failed logins are throttled per account and per client IP
+	if err := s.checkLoginThrottle(ctx, ipLoginKey(clientIP)); err != nil {
+		return nil, nil, err
+	}
+
+	// The attempt counts as failed until the password is verified, so parallel guesses
+	// cannot get past the account threshold
+	lockedOut, err := s.countAttempt(ctx, accountLoginKey(email))
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Fetch User (check if user exist) from payload
 	user, err := s.store.Users.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			return "", ErrInvalidCredentials
+			return nil, nil, s.loginFailed(ctx, nil, lockedOut, clientIP)
 		}
-		return "", fmt.Errorf("failed to get user: %w", err)
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	// Verify password
 	if err := user.Password.Compare(password); err != nil {
-		return "", ErrInvalidCredentials
+		return nil, nil, s.loginFailed(ctx, user, lockedOut, clientIP)
+	}
+
+	if err := s.resetAttempts(ctx, accountLoginKey(email)); err != nil {
+		return nil, nil, err
+	}
+
+	// Users with a second factor, or who must enroll one, get an MFA challenge instead
+	challenge, err := s.mfaChallenge(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge != nil {
+		return nil, challenge, nil
+	}
+
+	tokens, err := s.newSession(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, nil, nil
+}
+
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	current, err := s.store.RefreshTokens.GetByToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	// Refresh tokens are one-time use: seeing a revoked one again means
+	// it was stolen, so the whole family is revoked
+	if current.RevokedAt != nil {
+		return nil, s.revokeFamily(ctx, current.FamilyID)
+	}
+
+	if time.Now().After(current.Expiry) {
+		return nil, ErrInvalidToken
+	}
+
+	accessToken, expiresAt, err := s.generateAccessToken(current.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	plainRefreshToken, next := s.newRefreshToken(current.UserID, current.FamilyID)
+	if err := s.store.RefreshTokens.Rotate(ctx, current.ID, next); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			// Lost the race against another request using the same token
+			return nil, s.revokeFamily(ctx, current.FamilyID)
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: plainRefreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (s *AuthService) ValidateToken(ctx context.Context, token string) (*TokenClaims, error) {
+	jwtToken, err := s.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	mapClaims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	userID, ok := mapClaims["sub"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	// MFA challenge tokens only grant access to the second login step
+	if _, ok := mapClaims["mfa"]; ok {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens without jti cannot be revoked, so they are not accepted
+	jti, ok := mapClaims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, ErrInvalidToken
+	}
+
+	// iat is read directly, the jwt parser truncates it to whole seconds
+	issuedAt, ok := mapClaims["iat"].(float64)
+	if !ok || issuedAt == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	expiresAt, err := mapClaims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &TokenClaims{
+		UserID:    int64(userID),
+		ID:        jti,
+		IssuedAt:  time.UnixMilli(int64(math.Round(issuedAt * 1000))),
+		ExpiresAt: expiresAt.Time,
+	}
+
+	// Revocation list
+	revoked, err := s.revocationList().IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+
+	revokedAt, err := s.revocationList().UserTokensRevokedAt(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if !revokedAt.IsZero() && !claims.IssuedAt.After(revokedAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Logout revokes the current access token and, if given, the refresh token family of the session
+func (s *AuthService) Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error {
+	if err := s.revocationList().Revoke(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	current, err := s.store.RefreshTokens.GetByToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	// Never let one user revoke somebody else's session
+	if current.UserID != claims.UserID {
+		return nil
+	}
+
+	if err := s.store.RefreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every access token, refresh token and API key issued to the user so far
+func (s *AuthService) LogoutAll(ctx context.Context, userID int64) error {
+	// Access tokens carry iat in milliseconds, so tokens issued right after this are not revoked
+	now := time.Now().Truncate(time.Millisecond)
+
+	// Older access tokens are expired by now + TokenExpiration, no need to remember longer
+	if err := s.revocationList().RevokeUserTokens(ctx, userID, now, now.Add(s.config.TokenExpiration)); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	if err := s.store.RefreshTokens.RevokeByUserID(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	// API keys never expire on their own, so a compromised account must lose them too
+	if err := s.store.APITokens.DeleteByUserID(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke api tokens: %w", err)
 	}
 
+	return nil
+}
+
+// ForgotPassword emails a reset link. Unknown emails are silently ignored, and the link is
+// created and sent after returning, so neither the result nor the response time tells the
+// caller which accounts exist.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// The request is done before the email is sent
+	ctx = context.WithoutCancel(ctx)
+
+	s.background.Go(func() {
+		if err := s.sendPasswordReset(ctx, user); err != nil {
+			s.config.Logger.Errorw("failed to send password reset", "user", user.ID, "error", err)
+		}
+	})
+
+	return nil
+}
+
+func (s *AuthService) sendPasswordReset(ctx context.Context, user *store.User) error {
+	// Hash token for storage but keep plain token for email
+	plainToken := uuid.New().String()
+
+	err := s.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), s.config.PasswordResetExpiration)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset: %w", err)
+	}
+
+	if err := s.sendPasswordResetEmail(user, plainToken); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password and logs the user out everywhere
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	user := &store.User{}
+
+	// Hash user password
+	if err := user.Password.Set(password); err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.store.Users.ResetPassword(ctx, token, user); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	return s.LogoutAll(ctx, user.ID)
+}
+
+// newSession starts a new refresh token family for a fully authenticated user
+func (s *AuthService) newSession(ctx context.Context, userID int64) (*TokenPair, error) {
+	accessToken, expiresAt, err := s.generateAccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	plainRefreshToken, refreshToken := s.newRefreshToken(userID, uuid.New().String())
+	if err := s.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: plainRefreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// UnlockUser lifts an account lockout caused by failed logins or two-factor codes
+func (s *AuthService) UnlockUser(ctx context.Context, userID int64) error {
+	user, err := s.store.Users.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := s.resetAttempts(ctx, accountLoginKey(user.Email)); err != nil {
+		return err
+	}
+
+	return s.resetAttempts(ctx, mfaLoginKey(user.ID))
+}
+
+func (s *AuthService) checkLoginThrottle(ctx context.Context, key string) error {
+	if s.loginGuard == nil {
+		return nil
+	}
+
+	blockedFor, err := s.loginGuard.Check(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check login failures: %w", err)
+	}
+
+	if blockedFor > 0 {
+		return &LoginThrottledError{RetryAfter: blockedFor}
+	}
+
+	return nil
+}
+
+// countAttempt counts an attempt on key as failed up front and reports whether that locked it
+// out. A blocked key gets a LoginThrottledError. The caller resets key when the attempt succeeds.
+func (s *AuthService) countAttempt(ctx context.Context, key string) (bool, error) {
+	if s.loginGuard == nil {
+		return false, nil
+	}
+
+	blockedFor, lockedOut, err := s.loginGuard.Fail(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	if blockedFor > 0 {
+		return false, &LoginThrottledError{RetryAfter: blockedFor}
+	}
+
+	return lockedOut, nil
+}
+
+// resetAttempts forgets the failures of key after a successful attempt
+func (s *AuthService) resetAttempts(ctx context.Context, key string) error {
+	if s.loginGuard == nil {
+		return nil
+	}
+
+	if err := s.loginGuard.Reset(ctx, key); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	return nil
+}
+
+// loginFailed records a failed login for the client IP, the account was counted by countAttempt.
+// Unknown emails are tracked too, so lockouts don't reveal which accounts exist. The owner is
+// emailed when their account gets locked.
+func (s *AuthService) loginFailed(ctx context.Context, user *store.User, lockedOut bool, clientIP string) error {
+	if s.loginGuard == nil {
+		return ErrInvalidCredentials
+	}
+
+	if _, _, err := s.loginGuard.Fail(ctx, ipLoginKey(clientIP)); err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	if lockedOut && user != nil {
+		if err := s.sendAccountLockedEmail(user); err != nil {
+			s.config.Logger.Errorw("failed to send account locked email", "user", user.ID, "error", err)
+		}
+	}
+
+	return ErrInvalidCredentials
+}
+
+func (s *AuthService) sendAccountLockedEmail(user *store.User) error {
+	vars := struct {
+		Username          string
+		LockoutDuration   string
+		ForgotPasswordURL string
+	}{
+		Username:          user.Username,
+		LockoutDuration:   s.config.LoginLockoutDuration.String(),
+		ForgotPasswordURL: fmt.Sprintf("%s/forgot-password", s.config.FrontendURL),
+	}
+
+	_, err := s.mailer.Send(
+		mailer.AccountLockedTemplate,
+		user.Username,
+		user.Email,
+		vars,
+		!s.config.IsProductionEnv,
+	)
+
+	return err
+}
+
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipLoginKey(ip string) string {
+	return "ip:" + ip
+}
+
+// mfaLoginKey throttles second factor codes of an account, separately from its password
+func mfaLoginKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
+
+func (s *AuthService) sendPasswordResetEmail(user *store.User, token string) error {
+	resetURL := fmt.Sprintf("%s/reset-password/%s", s.config.FrontendURL, token)
+
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  resetURL,
+		ExpiresIn: s.config.PasswordResetExpiration.String(),
+	}
+
+	_, err := s.mailer.Send(
+		mailer.PasswordResetTemplate,
+		user.Username,
+		user.Email,
+		vars,
+		!s.config.IsProductionEnv,
+	)
+
+	return err
+}
+
+func (s *AuthService) revocationList() TokenRevocationList {
+	if s.cache != nil {
+		return s.cache.RevokedTokens()
+	}
+	return s.store.RevokedTokens
+}
+
+func (s *AuthService) generateAccessToken(userID int64) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.config.TokenExpiration)
+
 	// Generate JWT token
 	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(s.config.TokenExpiration).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
+		"jti": uuid.New().String(),
+		"sub": userID,
+		"exp": expiresAt.Unix(),
+		"iat": float64(now.UnixMilli()) / 1000,
+		"nbf": now.Unix(),
 		"iss": s.config.TokenHost,
 		"aud": s.config.TokenHost,
 	}
@@ -68,27 +609,32 @@ func (s *AuthService) CreateToken(ctx context.Context, email, password string) (
 	// Generate token -> add claims
 	token, err := s.authenticator.GenerateToken(claims)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	return token, nil
+	return token, expiresAt, nil
 }
 
-func (s *AuthService) ValidateToken(token string) (int64, error) {
-	jwtToken, err := s.authenticator.ValidateToken(token)
-	if err != nil {
-		return 0, ErrInvalidToken
-	}
+// newRefreshToken returns the plain token for the client and its hashed record for storage
+func (s *AuthService) newRefreshToken(userID int64, familyID string) (string, *store.RefreshToken) {
+	plainToken := uuid.New().String()
 
-	claims, ok := jwtToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, ErrInvalidToken
+	return plainToken, &store.RefreshToken{
+		UserID:   userID,
+		Token:    hashToken(plainToken),
+		FamilyID: familyID,
+		Expiry:   time.Now().Add(s.config.RefreshTokenExpiration),
 	}
+}
 
-	userID, ok := claims["sub"].(float64)
-	if !ok {
-		return 0, ErrInvalidToken
+func (s *AuthService) revokeFamily(ctx context.Context, familyID string) error {
+	if err := s.store.RefreshTokens.RevokeFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
 	}
+	return ErrRefreshTokenReused
+}
 
-	return int64(userID), nil
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
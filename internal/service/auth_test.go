@@ -0,0 +1,758 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/auth"
+	"github.com/n-korel/social-api/internal/mailer"
+	"github.com/n-korel/social-api/internal/ratelimiter"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockRefreshTokenStore struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenStore) Create(ctx context.Context, token *store.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenStore) GetByToken(ctx context.Context, token string) (*store.RefreshToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenStore) Rotate(ctx context.Context, usedID int64, next *store.RefreshToken) error {
+	args := m.Called(ctx, usedID, next)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenStore) RevokeByUserID(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type MockRevokedTokenStore struct {
+	mock.Mock
+}
+
+func (m *MockRevokedTokenStore) Revoke(ctx context.Context, jti string, expiry time.Time) error {
+	args := m.Called(ctx, jti, expiry)
+	return args.Error(0)
+}
+
+func (m *MockRevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	args := m.Called(ctx, jti)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRevokedTokenStore) RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	args := m.Called(ctx, userID, issuedBefore, expiry)
+	return args.Error(0)
+}
+
+func (m *MockRevokedTokenStore) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+type MockMFAStore struct {
+	mock.Mock
+}
+
+func (m *MockMFAStore) GetByUserID(ctx context.Context, userID int64) (*store.UserMFA, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.UserMFA), args.Error(1)
+}
+
+func (m *MockMFAStore) CreatePending(ctx context.Context, userID int64, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFAStore) Confirm(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	args := m.Called(ctx, userID, step, recoveryCodes)
+	return args.Error(0)
+}
+
+func (m *MockMFAStore) UseStep(ctx context.Context, userID, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+func (m *MockMFAStore) Delete(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func newTestAuthService(storage store.Storage) *AuthService {
+	return newTestAuthServiceWithMailer(storage, nil)
+}
+
+func newTestAuthServiceWithMailer(storage store.Storage, mailer *MockMailer) *AuthService {
+	return NewAuthService(
+		storage,
+		nil,
+		mailer,
+		auth.NewJWTAuthenticator("secret", "test", "test"),
+		nil,
+		AuthServiceConfig{
+			TokenExpiration:         15 * time.Minute,
+			RefreshTokenExpiration:  24 * time.Hour,
+			TokenHost:               "test",
+			FrontendURL:             "http://localhost:3000",
+			PasswordResetExpiration: time.Hour,
+			MFAIssuer:               "test",
+			MFAChallengeExpiration:  5 * time.Minute,
+			LoginLockoutDuration:    time.Minute,
+		},
+	)
+}
+
+func TestAuthService_CreateToken(t *testing.T) {
+	ctx := context.Background()
+
+	user := &store.User{ID: 1, Email: "test@example.com"}
+	if err := user.Password.Set("password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("issues access and refresh token", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+		mockMFAStore := new(MockMFAStore)
+
+		service := newTestAuthService(store.Storage{
+			Users:         mockUserStore,
+			RefreshTokens: mockRefreshTokenStore,
+			RevokedTokens: mockRevokedTokenStore,
+			MFA:           mockMFAStore,
+		})
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockMFAStore.On("GetByUserID", ctx, user.ID).Return(nil, store.ErrNotFound)
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockRevokedTokenStore.On("UserTokensRevokedAt", ctx, user.ID).Return(time.Time{}, nil)
+		mockRefreshTokenStore.On("Create", ctx, mock.MatchedBy(func(token *store.RefreshToken) bool {
+			return token.UserID == user.ID && token.FamilyID != "" && token.Expiry.After(time.Now())
+		})).Return(nil)
+
+		// Execute
+		tokens, challenge, err := service.CreateToken(ctx, user.Email, "password123", "127.0.0.1")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Nil(t, challenge)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		claims, err := service.ValidateToken(ctx, tokens.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.NotEmpty(t, claims.ID)
+
+		mockUserStore.AssertExpectations(t)
+		mockRefreshTokenStore.AssertExpectations(t)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := newTestAuthService(store.Storage{
+			Users: mockUserStore,
+		})
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+
+		// Execute
+		tokens, challenge, err := service.CreateToken(ctx, user.Email, "wrong", "127.0.0.1")
+
+		// Assert
+		assert.Nil(t, tokens)
+		assert.Nil(t, challenge)
+		assert.Equal(t, ErrInvalidCredentials, err)
+	})
+}
+
+func TestAuthService_RefreshToken(t *testing.T) {
+	ctx := context.Background()
+	plainToken := "refresh-token"
+
+	t.Run("rotates token within the same family", func(t *testing.T) {
+		// Setup
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		service := newTestAuthService(store.Storage{
+			RefreshTokens: mockRefreshTokenStore,
+		})
+
+		current := &store.RefreshToken{
+			ID:       10,
+			UserID:   1,
+			FamilyID: "family",
+			Expiry:   time.Now().Add(time.Hour),
+		}
+		mockRefreshTokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(current, nil)
+		mockRefreshTokenStore.On("Rotate", ctx, current.ID, mock.MatchedBy(func(next *store.RefreshToken) bool {
+			return next.FamilyID == current.FamilyID && next.UserID == current.UserID
+		})).Return(nil)
+
+		// Execute
+		tokens, err := service.RefreshToken(ctx, plainToken)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEqual(t, plainToken, tokens.RefreshToken)
+		mockRefreshTokenStore.AssertExpectations(t)
+	})
+
+	t.Run("reuse revokes the whole family", func(t *testing.T) {
+		// Setup
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		service := newTestAuthService(store.Storage{
+			RefreshTokens: mockRefreshTokenStore,
+		})
+
+		revokedAt := time.Now().Add(-time.Minute)
+		current := &store.RefreshToken{
+			ID:        10,
+			UserID:    1,
+			FamilyID:  "family",
+			Expiry:    time.Now().Add(time.Hour),
+			RevokedAt: &revokedAt,
+		}
+		mockRefreshTokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(current, nil)
+		mockRefreshTokenStore.On("RevokeFamily", ctx, "family").Return(nil)
+
+		// Execute
+		tokens, err := service.RefreshToken(ctx, plainToken)
+
+		// Assert
+		assert.Nil(t, tokens)
+		assert.Equal(t, ErrRefreshTokenReused, err)
+		mockRefreshTokenStore.AssertNotCalled(t, "Rotate")
+		mockRefreshTokenStore.AssertExpectations(t)
+	})
+
+	t.Run("concurrent rotation is treated as reuse", func(t *testing.T) {
+		// Setup
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		service := newTestAuthService(store.Storage{
+			RefreshTokens: mockRefreshTokenStore,
+		})
+
+		current := &store.RefreshToken{
+			ID:       10,
+			UserID:   1,
+			FamilyID: "family",
+			Expiry:   time.Now().Add(time.Hour),
+		}
+		mockRefreshTokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(current, nil)
+		mockRefreshTokenStore.On("Rotate", ctx, current.ID, mock.Anything).Return(store.ErrConflict)
+		mockRefreshTokenStore.On("RevokeFamily", ctx, "family").Return(nil)
+
+		// Execute
+		_, err := service.RefreshToken(ctx, plainToken)
+
+		// Assert
+		assert.Equal(t, ErrRefreshTokenReused, err)
+		mockRefreshTokenStore.AssertExpectations(t)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		// Setup
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		service := newTestAuthService(store.Storage{
+			RefreshTokens: mockRefreshTokenStore,
+		})
+
+		current := &store.RefreshToken{
+			ID:       10,
+			UserID:   1,
+			FamilyID: "family",
+			Expiry:   time.Now().Add(-time.Hour),
+		}
+		mockRefreshTokenStore.On("GetByToken", ctx, hashToken(plainToken)).Return(current, nil)
+
+		// Execute
+		_, err := service.RefreshToken(ctx, plainToken)
+
+		// Assert
+		assert.Equal(t, ErrInvalidToken, err)
+		mockRefreshTokenStore.AssertNotCalled(t, "Rotate")
+	})
+}
+
+func TestAuthService_ValidateToken_Revocation(t *testing.T) {
+	ctx := context.Background()
+	userID := int64(1)
+
+	newToken := func(t *testing.T, service *AuthService) string {
+		token, _, err := service.generateAccessToken(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Run("revoked jti", func(t *testing.T) {
+		// Setup
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+		service := newTestAuthService(store.Storage{
+			RevokedTokens: mockRevokedTokenStore,
+		})
+
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(true, nil)
+
+		// Execute
+		claims, err := service.ValidateToken(ctx, newToken(t, service))
+
+		// Assert
+		assert.Nil(t, claims)
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	t.Run("issued before logout everywhere", func(t *testing.T) {
+		// Setup
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+		service := newTestAuthService(store.Storage{
+			RevokedTokens: mockRevokedTokenStore,
+		})
+
+		token := newToken(t, service)
+
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockRevokedTokenStore.On("UserTokensRevokedAt", ctx, userID).Return(time.Now().Add(time.Second), nil)
+
+		// Execute
+		claims, err := service.ValidateToken(ctx, token)
+
+		// Assert
+		assert.Nil(t, claims)
+		assert.Equal(t, ErrInvalidToken, err)
+	})
+
+	t.Run("issued right after logout everywhere", func(t *testing.T) {
+		// Setup
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := newTestAuthService(store.Storage{
+			RefreshTokens: mockRefreshTokenStore,
+			RevokedTokens: mockRevokedTokenStore,
+			APITokens:     mockAPITokenStore,
+		})
+
+		var revokedAt time.Time
+		mockRevokedTokenStore.On("RevokeUserTokens", ctx, userID, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { revokedAt = args.Get(2).(time.Time) }).
+			Return(nil)
+		mockRefreshTokenStore.On("RevokeByUserID", ctx, userID).Return(nil)
+		mockAPITokenStore.On("DeleteByUserID", ctx, userID).Return(nil)
+
+		before := newToken(t, service)
+		time.Sleep(2 * time.Millisecond)
+		if err := service.LogoutAll(ctx, userID); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		after := newToken(t, service)
+
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockRevokedTokenStore.On("UserTokensRevokedAt", ctx, userID).Return(revokedAt, nil)
+
+		// Execute
+		_, beforeErr := service.ValidateToken(ctx, before)
+		claims, afterErr := service.ValidateToken(ctx, after)
+
+		// Assert
+		assert.Equal(t, ErrInvalidToken, beforeErr)
+		if assert.NoError(t, afterErr) {
+			assert.Equal(t, userID, claims.UserID)
+		}
+	})
+
+	t.Run("prefers redis when cache is enabled", func(t *testing.T) {
+		// Setup
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewAuthService(
+			store.Storage{},
+			mockCacheStorage,
+			nil,
+			auth.NewJWTAuthenticator("secret", "test", "test"),
+			nil,
+			AuthServiceConfig{TokenExpiration: time.Minute, TokenHost: "test"},
+		)
+
+		mockCacheStorage.revokedTokens.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockCacheStorage.revokedTokens.On("UserTokensRevokedAt", ctx, userID).Return(time.Time{}, nil)
+
+		// Execute
+		claims, err := service.ValidateToken(ctx, newToken(t, service))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, userID, claims.UserID)
+		mockCacheStorage.revokedTokens.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_LogoutAll(t *testing.T) {
+	ctx := context.Background()
+	userID := int64(1)
+
+	// Setup
+	mockRefreshTokenStore := new(MockRefreshTokenStore)
+	mockRevokedTokenStore := new(MockRevokedTokenStore)
+	mockAPITokenStore := new(MockAPITokenStore)
+	service := newTestAuthService(store.Storage{
+		RefreshTokens: mockRefreshTokenStore,
+		RevokedTokens: mockRevokedTokenStore,
+		APITokens:     mockAPITokenStore,
+	})
+
+	mockRevokedTokenStore.On("RevokeUserTokens", ctx, userID, mock.Anything, mock.Anything).Return(nil)
+	mockRefreshTokenStore.On("RevokeByUserID", ctx, userID).Return(nil)
+	mockAPITokenStore.On("DeleteByUserID", ctx, userID).Return(nil)
+
+	// Execute
+	err := service.LogoutAll(ctx, userID)
+
+	// Assert
+	assert.NoError(t, err)
+	mockRevokedTokenStore.AssertExpectations(t)
+	mockRefreshTokenStore.AssertExpectations(t)
+	mockAPITokenStore.AssertExpectations(t)
+}
+
+func TestAuthService_ForgotPassword(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown email is not revealed", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newTestAuthServiceWithMailer(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		mockUserStore.On("GetByEmail", ctx, "unknown@example.com").Return(nil, store.ErrNotFound)
+
+		// Execute
+		err := service.ForgotPassword(ctx, "unknown@example.com")
+
+		// Assert
+		assert.NoError(t, err)
+		mockUserStore.AssertNotCalled(t, "CreatePasswordReset")
+		mockMailer.AssertNotCalled(t, "Send")
+	})
+
+	t.Run("known email answers like an unknown one before the email is sent", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newTestAuthServiceWithMailer(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		user := &store.User{ID: 1, Username: "testuser", Email: "test@example.com"}
+		sending := make(chan struct{})
+
+		mockUserStore.On("GetByEmail", ctx, "unknown@example.com").Return(nil, store.ErrNotFound)
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockUserStore.On("CreatePasswordReset", mock.Anything, user.ID, mock.Anything, time.Hour).Return(nil)
+		mockMailer.On("Send", "password_reset.tmpl", user.Username, user.Email, mock.Anything, true).
+			Run(func(mock.Arguments) { <-sending }).
+			Return(200, nil)
+
+		// Execute
+		unknownErr := service.ForgotPassword(ctx, "unknown@example.com")
+		knownErr := service.ForgotPassword(ctx, user.Email)
+
+		// Assert
+		assert.NoError(t, unknownErr)
+		assert.Equal(t, unknownErr, knownErr)
+
+		close(sending)
+		assert.NoError(t, service.Shutdown(ctx))
+		mockMailer.AssertExpectations(t)
+	})
+
+	t.Run("stores hashed token and sends plain one", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newTestAuthServiceWithMailer(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		user := &store.User{ID: 1, Username: "testuser", Email: "test@example.com"}
+		var storedToken string
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockUserStore.On("CreatePasswordReset", mock.Anything, user.ID, mock.Anything, time.Hour).
+			Run(func(args mock.Arguments) { storedToken = args.String(2) }).
+			Return(nil)
+		mockMailer.On("Send", "password_reset.tmpl", user.Username, user.Email, mock.Anything, true).Return(200, nil)
+
+		// Execute
+		err := service.ForgotPassword(ctx, user.Email)
+		assert.NoError(t, service.Shutdown(ctx))
+
+		// Assert
+		assert.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+
+		vars := mockMailer.Calls[0].Arguments.Get(3)
+		resetURL := vars.(struct {
+			Username  string
+			ResetURL  string
+			ExpiresIn string
+		}).ResetURL
+		plainToken := resetURL[len("http://localhost:3000/reset-password/"):]
+		assert.Equal(t, hashToken(plainToken), storedToken)
+	})
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("invalid token", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := newTestAuthService(store.Storage{
+			Users: mockUserStore,
+		})
+
+		mockUserStore.On("ResetPassword", ctx, "token", mock.Anything).Return(store.ErrNotFound)
+
+		// Execute
+		err := service.ResetPassword(ctx, "token", "newpassword")
+
+		// Assert
+		assert.Equal(t, ErrInvalidResetToken, err)
+	})
+
+	t.Run("revokes existing sessions and api keys", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+		mockAPITokenStore := new(MockAPITokenStore)
+		service := newTestAuthService(store.Storage{
+			Users:         mockUserStore,
+			RefreshTokens: mockRefreshTokenStore,
+			RevokedTokens: mockRevokedTokenStore,
+			APITokens:     mockAPITokenStore,
+		})
+
+		mockUserStore.On("ResetPassword", ctx, "token", mock.MatchedBy(func(user *store.User) bool {
+			return user.Password.Compare("newpassword") == nil
+		})).
+			Run(func(args mock.Arguments) { args.Get(2).(*store.User).ID = 1 }).
+			Return(nil)
+		mockRevokedTokenStore.On("RevokeUserTokens", ctx, int64(1), mock.Anything, mock.Anything).Return(nil)
+		mockRefreshTokenStore.On("RevokeByUserID", ctx, int64(1)).Return(nil)
+		mockAPITokenStore.On("DeleteByUserID", ctx, int64(1)).Return(nil)
+
+		// Execute
+		err := service.ResetPassword(ctx, "token", "newpassword")
+
+		// Assert
+		assert.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+		mockRevokedTokenStore.AssertExpectations(t)
+		mockRefreshTokenStore.AssertExpectations(t)
+		mockAPITokenStore.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+
+	user := &store.User{ID: 1, Username: "test", Email: "test@example.com"}
+	if err := user.Password.Set("password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	newGuardedService := func(storage store.Storage, mailer *MockMailer) *AuthService {
+		// The clock stands still, so lockouts last exactly LockoutDuration
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		service := newTestAuthServiceWithMailer(storage, mailer)
+		service.loginGuard = ratelimiter.NewMemoryLoginGuardWithClock(ratelimiter.LoginConfig{
+			MaxFailures:     3,
+			LockoutDuration: time.Minute,
+			Window:          time.Hour,
+		}, func() time.Time { return now })
+		return service
+	}
+
+	t.Run("locks the account after repeated failures and emails the owner", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newGuardedService(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockMailer.On("Send", mailer.AccountLockedTemplate, user.Username, user.Email, mock.Anything, true).Return(200, nil).Once()
+
+		// Execute
+		for range 3 {
+			_, _, err := service.CreateToken(ctx, user.Email, "wrong", "10.0.0.1")
+			assert.Equal(t, ErrInvalidCredentials, err)
+		}
+
+		// Assert the right password is refused as well, from any IP
+		_, _, err := service.CreateToken(ctx, "TEST@example.com", "password123", "10.0.0.2")
+
+		var throttled *LoginThrottledError
+		assert.ErrorAs(t, err, &throttled)
+		assert.ErrorIs(t, err, ErrLoginThrottled)
+		assert.Equal(t, time.Minute, throttled.RetryAfter)
+
+		mockMailer.AssertExpectations(t)
+	})
+
+	t.Run("unknown emails are throttled without sending email", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newGuardedService(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		mockUserStore.On("GetByEmail", ctx, "ghost@example.com").Return(nil, store.ErrNotFound)
+
+		// Execute
+		for range 3 {
+			_, _, err := service.CreateToken(ctx, "ghost@example.com", "wrong", "10.0.0.1")
+			assert.Equal(t, ErrInvalidCredentials, err)
+		}
+		_, _, err := service.CreateToken(ctx, "ghost@example.com", "wrong", "10.0.0.3")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrLoginThrottled)
+		mockMailer.AssertNotCalled(t, "Send")
+	})
+
+	t.Run("parallel guesses cannot get past the backoff", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := newTestAuthService(store.Storage{Users: mockUserStore})
+		service.loginGuard = ratelimiter.NewMemoryLoginGuard(ratelimiter.LoginConfig{
+			MaxFailures:     3,
+			BaseDelay:       time.Minute,
+			MaxDelay:        time.Minute,
+			LockoutDuration: time.Hour,
+			Window:          time.Hour,
+		})
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+
+		// Execute
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var invalid, throttled int
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := service.CreateToken(ctx, user.Email, "wrong", "10.0.0.4")
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case errors.Is(err, ErrInvalidCredentials):
+					invalid++
+				case errors.Is(err, ErrLoginThrottled):
+					throttled++
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Assert only one guess was checked, the others hit the backoff it started
+		assert.Equal(t, 1, invalid)
+		assert.Equal(t, 9, throttled)
+	})
+
+	t.Run("a failed lockout email is logged, not returned", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newGuardedService(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+		core, logs := observer.New(zap.ErrorLevel)
+		service.config.Logger = zap.New(core).Sugar()
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockMailer.On("Send", mailer.AccountLockedTemplate, user.Username, user.Email, mock.Anything, true).Return(500, errors.New("smtp down")).Once()
+
+		// Execute
+		var err error
+		for range 3 {
+			_, _, err = service.CreateToken(ctx, user.Email, "wrong", "10.0.0.5")
+		}
+
+		// Assert
+		assert.Equal(t, ErrInvalidCredentials, err)
+		assert.Equal(t, 1, logs.FilterMessage("failed to send account locked email").Len())
+	})
+
+	t.Run("admin unlock lifts the lockout", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := newGuardedService(store.Storage{
+			Users: mockUserStore,
+		}, mockMailer)
+
+		mockUserStore.On("GetByID", ctx, user.ID).Return(user, nil)
+
+		for range 3 {
+			_, _, err := service.loginGuard.Fail(ctx, accountLoginKey(user.Email))
+			assert.NoError(t, err)
+		}
+
+		// Execute
+		err := service.UnlockUser(ctx, user.ID)
+
+		// Assert
+		assert.NoError(t, err)
+		blockedFor, err := service.loginGuard.Check(ctx, accountLoginKey(user.Email))
+		assert.NoError(t, err)
+		assert.Zero(t, blockedFor)
+	})
+}
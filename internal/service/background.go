@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// backgroundTaskLimit bounds the tasks running after their request, so that requests cannot pile them up
+const backgroundTaskLimit = 32
+
+// backgroundTasks runs work that finishes after the request that started it, like emails
+// whose sending time must not show in the response time
+type backgroundTasks struct {
+	wg    sync.WaitGroup
+	slots chan struct{}
+}
+
+func newBackgroundTasks(limit int) *backgroundTasks {
+	return &backgroundTasks{slots: make(chan struct{}, limit)}
+}
+
+// Go runs task in the background, waiting for a free slot while limit tasks are running
+func (b *backgroundTasks) Go(task func()) {
+	b.slots <- struct{}{}
+	b.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-b.slots
+			b.wg.Done()
+		}()
+
+		task()
+	}()
+}
+
+// Wait returns once the running tasks are done, or with the error of ctx when it is done first
+func (b *backgroundTasks) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundTasks(t *testing.T) {
+	t.Run("waits for running tasks", func(t *testing.T) {
+		// Setup
+		tasks := newBackgroundTasks(2)
+		var done atomic.Int32
+
+		// Execute
+		for range 5 {
+			tasks.Go(func() { done.Add(1) })
+		}
+		err := tasks.Wait(context.Background())
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, int32(5), done.Load())
+	})
+
+	t.Run("runs at most limit tasks at once", func(t *testing.T) {
+		// Setup
+		tasks := newBackgroundTasks(1)
+		release := make(chan struct{})
+		tasks.Go(func() { <-release })
+
+		// Execute
+		started := make(chan struct{})
+		go func() {
+			tasks.Go(func() {})
+			close(started)
+		}()
+
+		// Assert
+		select {
+		case <-started:
+			t.Fatal("second task started while the first was running")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		close(release)
+		<-started
+		assert.NoError(t, tasks.Wait(context.Background()))
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		// Setup
+		tasks := newBackgroundTasks(1)
+		release := make(chan struct{})
+		defer close(release)
+		tasks.Go(func() { <-release })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Execute
+		err := tasks.Wait(ctx)
+
+		// Assert
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/n-korel/social-api/internal/media"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+var (
+	ErrMediaNotFound          = errors.New("media not found")
+	ErrMediaTooLarge          = errors.New("media is too large")
+	ErrUnsupportedMediaType   = errors.New("unsupported media type, allowed are JPEG, PNG and GIF")
+	ErrInvalidImageDimensions = errors.New("image dimensions are too large")
+	ErrInvalidMedia           = errors.New("invalid media")
+)
+
+type MediaService struct {
+	store  store.Storage
+	cache  CacheStorage
+	blobs  media.BlobStore
+	config MediaServiceConfig
+}
+
+type MediaServiceConfig struct {
+	// Maximum size of an upload in bytes
+	MaxUploadSize int64
+	// Maximum width and height of an uploaded image in pixels
+	MaxDimension int
+	// Thumbnails fit in a square of this size
+	ThumbnailSize int
+}
+
+type MediaServiceInterface interface {
+	Upload(ctx context.Context, userID int64, body io.Reader) (*store.Media, error)
+	GetMedia(ctx context.Context, id string, viewerID int64) (*store.Media, error)
+	Open(ctx context.Context, m *store.Media, thumbnail bool) (io.ReadCloser, error)
+	DeleteMedia(ctx context.Context, id string, userID int64) error
+}
+
+func NewMediaService(store store.Storage, cache CacheStorage, blobs media.BlobStore, config MediaServiceConfig) *MediaService {
+	return &MediaService{
+		store:  store,
+		cache:  cache,
+		blobs:  blobs,
+		config: config,
+	}
+}
+
+// Upload stores an image and its thumbnail. The content type is sniffed from the data.
+func (s *MediaService) Upload(ctx context.Context, userID int64, body io.Reader) (*store.Media, error) {
+	data, err := io.ReadAll(io.LimitReader(body, s.config.MaxUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	if int64(len(data)) > s.config.MaxUploadSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	info, err := media.Inspect(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			return nil, ErrUnsupportedMediaType
+		default:
+			return nil, ErrInvalidMedia
+		}
+	}
+
+	// Checked before decoding, a small file can declare huge dimensions
+	if info.Width > s.config.MaxDimension || info.Height > s.config.MaxDimension {
+		return nil, ErrInvalidImageDimensions
+	}
+
+	thumbnail, thumbnailType, err := media.Thumbnail(data, s.config.ThumbnailSize)
+	if err != nil {
+		return nil, ErrInvalidMedia
+	}
+
+	id := uuid.New().String()
+	m := &store.Media{
+		ID:                   id,
+		UserID:               userID,
+		ContentType:          info.ContentType,
+		Size:                 int64(len(data)),
+		Width:                info.Width,
+		Height:               info.Height,
+		Key:                  "media/" + id + media.ImageTypes[info.ContentType],
+		ThumbnailKey:         "media/" + id + "_thumb" + media.ImageTypes[thumbnailType],
+		ThumbnailContentType: thumbnailType,
+	}
+
+	if err := s.blobs.Put(ctx, m.Key, bytes.NewReader(data), m.Size, m.ContentType); err != nil {
+		return nil, fmt.Errorf("failed to store media: %w", err)
+	}
+
+	if err := s.blobs.Put(ctx, m.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), thumbnailType); err != nil {
+		s.deleteBlobs(ctx, m)
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+
+	if err := s.store.Media.Create(ctx, m); err != nil {
+		s.deleteBlobs(ctx, m)
+		return nil, fmt.Errorf("failed to create media: %w", err)
+	}
+
+	return m, nil
+}
+
+// GetMedia returns media that viewerID may see: their own uploads, avatars and media of posts
+// they may see. A zero viewer only sees avatars and media of public posts. Other media is not found.
+func (s *MediaService) GetMedia(ctx context.Context, id string, viewerID int64) (*store.Media, error) {
+	m, err := s.store.Media.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+
+	if m.UserID == viewerID {
+		return m, nil
+	}
+
+	visible, err := s.store.Media.IsVisible(ctx, id, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check media visibility: %w", err)
+	}
+	if !visible {
+		return nil, ErrMediaNotFound
+	}
+
+	return m, nil
+}
+
+// Open returns the image or its thumbnail, the caller closes it
+func (s *MediaService) Open(ctx context.Context, m *store.Media, thumbnail bool) (io.ReadCloser, error) {
+	key := m.Key
+	if thumbnail {
+		key = m.ThumbnailKey
+	}
+
+	body, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, media.ErrBlobNotFound) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, fmt.Errorf("failed to open media: %w", err)
+	}
+
+	return body, nil
+}
+
+// DeleteMedia deletes media of the user, removing it from their posts and avatar
+func (s *MediaService) DeleteMedia(ctx context.Context, id string, userID int64) error {
+	m, err := s.GetMedia(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if m.UserID != userID {
+		return ErrMediaNotFound
+	}
+
+	if err := s.store.Media.Delete(ctx, id, userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrMediaNotFound
+		}
+		return fmt.Errorf("failed to delete media: %w", err)
+	}
+
+	// Cached users may still reference the avatar
+	if s.cache != nil {
+		s.cache.Users().Delete(ctx, userID)
+	}
+
+	// Orphaned blobs are harmless, the row is gone
+	s.deleteBlobs(ctx, m)
+
+	return nil
+}
+
+func (s *MediaService) deleteBlobs(ctx context.Context, m *store.Media) {
+	_ = s.blobs.Delete(ctx, m.Key)
+	_ = s.blobs.Delete(ctx, m.ThumbnailKey)
+}
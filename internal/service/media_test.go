@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/media"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockMediaStore struct {
+	mock.Mock
+}
+
+func (m *MockMediaStore) Create(ctx context.Context, media *store.Media) error {
+	args := m.Called(ctx, media)
+	return args.Error(0)
+}
+
+func (m *MockMediaStore) GetByID(ctx context.Context, id string) (*store.Media, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Media), args.Error(1)
+}
+
+func (m *MockMediaStore) GetByIDs(ctx context.Context, ids []string) ([]store.Media, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.Media), args.Error(1)
+}
+
+func (m *MockMediaStore) IsVisible(ctx context.Context, id string, viewerID int64) (bool, error) {
+	args := m.Called(ctx, id, viewerID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMediaStore) Delete(ctx context.Context, id string, userID int64) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))))
+	return buf.Bytes()
+}
+
+func readBlob(t *testing.T, blobs media.BlobStore, key string) ([]byte, error) {
+	t.Helper()
+
+	body, err := blobs.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+func TestMediaService_Upload(t *testing.T) {
+	ctx := context.Background()
+	config := MediaServiceConfig{MaxUploadSize: 1 << 20, MaxDimension: 1000, ThumbnailSize: 50}
+
+	newService := func(t *testing.T) (*MediaService, *MockMediaStore, media.BlobStore) {
+		blobs, err := media.NewLocalStore(t.TempDir())
+		require.NoError(t, err)
+
+		mockMediaStore := new(MockMediaStore)
+		return NewMediaService(store.Storage{Media: mockMediaStore}, nil, blobs, config), mockMediaStore, blobs
+	}
+
+	t.Run("stores the image and its thumbnail", func(t *testing.T) {
+		// Setup
+		service, mockMediaStore, blobs := newService(t)
+		data := testPNG(t, 200, 100)
+		mockMediaStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		// Execute
+		m, err := service.Upload(ctx, 1, bytes.NewReader(data))
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), m.UserID)
+		assert.Equal(t, "image/png", m.ContentType)
+		assert.Equal(t, 200, m.Width)
+		assert.Equal(t, 100, m.Height)
+		assert.Equal(t, "media/"+m.ID+".png", m.Key)
+
+		stored, err := readBlob(t, blobs, m.Key)
+		require.NoError(t, err)
+		assert.Equal(t, data, stored)
+
+		thumbnail, err := readBlob(t, blobs, m.ThumbnailKey)
+		require.NoError(t, err)
+		info, err := media.Inspect(thumbnail)
+		require.NoError(t, err)
+		assert.Equal(t, 50, info.Width)
+		assert.Equal(t, 25, info.Height)
+	})
+
+	t.Run("rejects uploads over the size limit", func(t *testing.T) {
+		service, _, _ := newService(t)
+		service.config.MaxUploadSize = 10
+
+		_, err := service.Upload(ctx, 1, bytes.NewReader(testPNG(t, 10, 10)))
+		assert.ErrorIs(t, err, ErrMediaTooLarge)
+	})
+
+	t.Run("rejects content that is not an image", func(t *testing.T) {
+		service, _, _ := newService(t)
+
+		_, err := service.Upload(ctx, 1, bytes.NewReader([]byte("%PDF-1.4 not an image")))
+		assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+	})
+
+	t.Run("rejects images over the maximum dimension", func(t *testing.T) {
+		service, _, _ := newService(t)
+
+		_, err := service.Upload(ctx, 1, bytes.NewReader(testPNG(t, 1001, 10)))
+		assert.ErrorIs(t, err, ErrInvalidImageDimensions)
+	})
+
+	t.Run("removes the blobs when saving fails", func(t *testing.T) {
+		// Setup
+		service, mockMediaStore, blobs := newService(t)
+		var created *store.Media
+		mockMediaStore.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			created = args.Get(1).(*store.Media)
+		}).Return(errors.New("db down"))
+
+		// Execute
+		_, err := service.Upload(ctx, 1, bytes.NewReader(testPNG(t, 10, 10)))
+
+		// Assert
+		require.Error(t, err)
+		_, err = readBlob(t, blobs, created.Key)
+		assert.ErrorIs(t, err, media.ErrBlobNotFound)
+		_, err = readBlob(t, blobs, created.ThumbnailKey)
+		assert.ErrorIs(t, err, media.ErrBlobNotFound)
+	})
+}
+
+func TestMediaService_GetMedia(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("owners see their media", func(t *testing.T) {
+		// Setup
+		mockMediaStore := new(MockMediaStore)
+		service := NewMediaService(store.Storage{Media: mockMediaStore}, nil, nil, MediaServiceConfig{})
+		mockMediaStore.On("GetByID", ctx, "m1").Return(&store.Media{ID: "m1", UserID: 1}, nil)
+
+		// Execute
+		m, err := service.GetMedia(ctx, "m1", 1)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "m1", m.ID)
+		mockMediaStore.AssertNotCalled(t, "IsVisible", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("media of posts others may not see is not found", func(t *testing.T) {
+		// Setup
+		mockMediaStore := new(MockMediaStore)
+		service := NewMediaService(store.Storage{Media: mockMediaStore}, nil, nil, MediaServiceConfig{})
+		mockMediaStore.On("GetByID", ctx, "m1").Return(&store.Media{ID: "m1", UserID: 1}, nil)
+		mockMediaStore.On("IsVisible", ctx, "m1", int64(0)).Return(false, nil)
+
+		// Execute
+		_, err := service.GetMedia(ctx, "m1", 0)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrMediaNotFound)
+	})
+
+	t.Run("media of visible posts is served to others", func(t *testing.T) {
+		// Setup
+		mockMediaStore := new(MockMediaStore)
+		service := NewMediaService(store.Storage{Media: mockMediaStore}, nil, nil, MediaServiceConfig{})
+		mockMediaStore.On("GetByID", ctx, "m1").Return(&store.Media{ID: "m1", UserID: 1}, nil)
+		mockMediaStore.On("IsVisible", ctx, "m1", int64(2)).Return(true, nil)
+
+		// Execute
+		_, err := service.GetMedia(ctx, "m1", 2)
+
+		// Assert
+		require.NoError(t, err)
+		mockMediaStore.AssertExpectations(t)
+	})
+}
+
+func TestMediaService_DeleteMedia(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("media of other users is not found", func(t *testing.T) {
+		// Setup
+		mockMediaStore := new(MockMediaStore)
+		service := NewMediaService(store.Storage{Media: mockMediaStore}, nil, nil, MediaServiceConfig{})
+		mockMediaStore.On("GetByID", ctx, "m1").Return(&store.Media{ID: "m1", UserID: 2}, nil)
+		mockMediaStore.On("IsVisible", ctx, "m1", int64(1)).Return(true, nil)
+
+		// Execute
+		err := service.DeleteMedia(ctx, "m1", 1)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrMediaNotFound)
+		mockMediaStore.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("deletes the row, blobs and cached user", func(t *testing.T) {
+		// Setup
+		blobs, err := media.NewLocalStore(t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, blobs.Put(ctx, "media/m1.png", bytes.NewReader([]byte("x")), 1, "image/png"))
+
+		mockMediaStore := new(MockMediaStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewMediaService(store.Storage{Media: mockMediaStore}, mockCacheStorage, blobs, MediaServiceConfig{})
+
+		m := &store.Media{ID: "m1", UserID: 1, Key: "media/m1.png", ThumbnailKey: "media/m1_thumb.png"}
+		mockMediaStore.On("GetByID", ctx, "m1").Return(m, nil)
+		mockMediaStore.On("Delete", ctx, "m1", int64(1)).Return(nil)
+		mockCacheStorage.userCache.On("Delete", ctx, int64(1)).Return()
+
+		// Execute
+		err = service.DeleteMedia(ctx, "m1", 1)
+
+		// Assert
+		require.NoError(t, err)
+		_, err = readBlob(t, blobs, "media/m1.png")
+		assert.ErrorIs(t, err, media.ErrBlobNotFound)
+		mockCacheStorage.userCache.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/n-korel/social-api/internal/auth"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+const recoveryCodeCount = 10
+
+// MFA challenge purposes, carried in the "mfa" claim
+const (
+	mfaPurposeVerify = "verify"
+	mfaPurposeEnroll = "enroll"
+)
+
+var (
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAEnforced       = errors.New("two-factor authentication is required for this account")
+)
+
+// MFAChallenge is returned by CreateToken instead of a token pair when a second factor is needed.
+// The token can only be exchanged through VerifyMFA (and StartMFAEnrollment when enrolling).
+type MFAChallenge struct {
+	Token              string
+	ExpiresAt          time.Time
+	EnrollmentRequired bool
+}
+
+// TOTPEnrollment is what the user scans into an authenticator app
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type mfaClaims struct {
+	UserID    int64
+	ID        string
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+// VerifyMFA exchanges an MFA challenge token and a TOTP or recovery code for a token pair.
+// When the challenge was an enrollment, it confirms the enrollment and returns the recovery codes.
+// Wrong codes are throttled per account like passwords, and the challenge is revoked once the
+// account gets locked out, so a stolen password does not allow guessing codes without limit.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code string) (*TokenPair, []string, error) {
+	claims, err := s.validateMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lockedOut, err := s.countAttempt(ctx, mfaLoginKey(claims.UserID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var recoveryCodes []string
+	switch claims.Purpose {
+	case mfaPurposeEnroll:
+		recoveryCodes, err = s.ConfirmTOTP(ctx, claims.UserID, code)
+	default:
+		err = s.verifyMFACode(ctx, claims.UserID, code)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) && lockedOut {
+			if err := s.revocationList().Revoke(ctx, claims.ID, claims.ExpiresAt); err != nil {
+				return nil, nil, fmt.Errorf("failed to revoke mfa token: %w", err)
+			}
+		}
+		return nil, nil, err
+	}
+
+	if err := s.resetAttempts(ctx, mfaLoginKey(claims.UserID)); err != nil {
+		return nil, nil, err
+	}
+
+	// Challenge tokens are single use
+	if err := s.revocationList().Revoke(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to revoke mfa token: %w", err)
+	}
+
+	tokens, err := s.newSession(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, recoveryCodes, nil
+}
+
+// StartMFAEnrollment lets a user who is forced into 2FA enroll before holding an access token
+func (s *AuthService) StartMFAEnrollment(ctx context.Context, mfaToken string) (*TOTPEnrollment, error) {
+	claims, err := s.validateMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != mfaPurposeEnroll {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.store.Users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.EnrollTOTP(ctx, user)
+}
+
+// EnrollTOTP creates a pending enrollment, which only takes effect once ConfirmTOTP accepts a code
+func (s *AuthService) EnrollTOTP(ctx context.Context, user *store.User) (*TOTPEnrollment, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	if err := s.store.MFA.CreatePending(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, fmt.Errorf("failed to create mfa enrollment: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, s.config.MFAIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmTOTP verifies the first code of a pending enrollment and returns fresh recovery codes
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	mfa, err := s.store.MFA.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, fmt.Errorf("failed to get mfa: %w", err)
+	}
+
+	if mfa.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := auth.ValidateTOTP(mfa.Secret, normalizeMFACode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	recoveryCodes, hashedCodes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+
+	if err := s.store.MFA.Confirm(ctx, userID, step, hashedCodes); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, fmt.Errorf("failed to confirm mfa: %w", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP removes 2FA after checking a current code, unless the user's role requires it
+func (s *AuthService) DisableTOTP(ctx context.Context, user *store.User, code string) error {
+	if s.mfaRequired(user) {
+		return ErrMFAEnforced
+	}
+
+	mfa, err := s.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrMFANotEnabled
+		}
+		return fmt.Errorf("failed to get mfa: %w", err)
+	}
+
+	if !mfa.Confirmed() {
+		return ErrMFANotEnabled
+	}
+
+	// A stolen session must not be able to guess its way out of 2FA either
+	if _, err := s.countAttempt(ctx, mfaLoginKey(user.ID)); err != nil {
+		return err
+	}
+
+	if err := s.checkMFACode(ctx, mfa, code); err != nil {
+		return err
+	}
+
+	if err := s.resetAttempts(ctx, mfaLoginKey(user.ID)); err != nil {
+		return err
+	}
+
+	if err := s.store.MFA.Delete(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to delete mfa: %w", err)
+	}
+
+	return nil
+}
+
+// mfaChallenge returns nil when the user can log in with the password alone
+func (s *AuthService) mfaChallenge(ctx context.Context, user *store.User) (*MFAChallenge, error) {
+	mfa, err := s.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get mfa: %w", err)
+	}
+
+	var purpose string
+	switch {
+	case mfa != nil && mfa.Confirmed():
+		purpose = mfaPurposeVerify
+	case s.mfaRequired(user):
+		purpose = mfaPurposeEnroll
+	default:
+		return nil, nil
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.config.MFAChallengeExpiration)
+
+	claims := jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": user.ID,
+		"mfa": purpose,
+		"exp": expiresAt.Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": s.config.TokenHost,
+		"aud": s.config.TokenHost,
+	}
+
+	token, err := s.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mfa token: %w", err)
+	}
+
+	return &MFAChallenge{
+		Token:              token,
+		ExpiresAt:          expiresAt,
+		EnrollmentRequired: purpose == mfaPurposeEnroll,
+	}, nil
+}
+
+func (s *AuthService) mfaRequired(user *store.User) bool {
+	return s.config.MFARequiredRoleLevel > 0 && user.Role.Level >= s.config.MFARequiredRoleLevel
+}
+
+func (s *AuthService) validateMFAToken(ctx context.Context, token string) (*mfaClaims, error) {
+	jwtToken, err := s.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	mapClaims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	purpose, ok := mapClaims["mfa"].(string)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	userID, ok := mapClaims["sub"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	jti, ok := mapClaims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, ErrInvalidToken
+	}
+
+	expiresAt, err := mapClaims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := s.revocationList().IsRevoked(ctx, jti)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+
+	return &mfaClaims{
+		UserID:    int64(userID),
+		ID:        jti,
+		Purpose:   purpose,
+		ExpiresAt: expiresAt.Time,
+	}, nil
+}
+
+// verifyMFACode checks a code against the confirmed second factor of the user
+func (s *AuthService) verifyMFACode(ctx context.Context, userID int64, code string) error {
+	mfa, err := s.store.MFA.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to get mfa: %w", err)
+	}
+
+	if !mfa.Confirmed() {
+		return ErrInvalidToken
+	}
+
+	return s.checkMFACode(ctx, mfa, code)
+}
+
+// checkMFACode accepts either a TOTP code or an unused recovery code
+func (s *AuthService) checkMFACode(ctx context.Context, mfa *store.UserMFA, code string) error {
+	code = normalizeMFACode(code)
+
+	if step, ok := auth.ValidateTOTP(mfa.Secret, code, time.Now()); ok {
+		if err := s.store.MFA.UseStep(ctx, mfa.UserID, step); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				return ErrInvalidMFACode
+			}
+			return fmt.Errorf("failed to record totp step: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.store.MFA.UseRecoveryCode(ctx, mfa.UserID, hashToken(code)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns the codes shown to the user and their hashes for storage
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeMFACode ignores the spaces and dashes users type codes with
+func normalizeMFACode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/auth"
+	"github.com/n-korel/social-api/internal/ratelimiter"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_MFALogin(t *testing.T) {
+	ctx := context.Background()
+
+	user := &store.User{ID: 1, Email: "test@example.com"}
+	require.NoError(t, user.Password.Set("password123"))
+
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	confirmedAt := time.Now()
+	mfa := &store.UserMFA{UserID: user.ID, Secret: secret, ConfirmedAt: &confirmedAt}
+
+	t.Run("password alone returns a challenge that must be exchanged with a code", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+
+		service := newTestAuthService(store.Storage{
+			Users:         mockUserStore,
+			MFA:           mockMFAStore,
+			RefreshTokens: mockRefreshTokenStore,
+			RevokedTokens: mockRevokedTokenStore,
+		})
+
+		code, err := auth.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockMFAStore.On("GetByUserID", ctx, user.ID).Return(mfa, nil)
+		mockMFAStore.On("UseStep", ctx, user.ID, mock.Anything).Return(nil)
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockRevokedTokenStore.On("Revoke", ctx, mock.Anything, mock.Anything).Return(nil)
+		mockRefreshTokenStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		// Execute
+		tokens, challenge, err := service.CreateToken(ctx, user.Email, "password123", "127.0.0.1")
+
+		// Assert
+		require.NoError(t, err)
+		assert.Nil(t, tokens)
+		require.NotNil(t, challenge)
+		assert.False(t, challenge.EnrollmentRequired)
+
+		_, err = service.ValidateToken(ctx, challenge.Token)
+		assert.Equal(t, ErrInvalidToken, err)
+
+		tokens, recoveryCodes, err := service.VerifyMFA(ctx, challenge.Token, code)
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.Empty(t, recoveryCodes)
+
+		mockMFAStore.AssertExpectations(t)
+		mockRevokedTokenStore.AssertCalled(t, "Revoke", ctx, mock.Anything, mock.Anything)
+	})
+
+	t.Run("wrong codes lock the account out and revoke the challenge", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+
+		service := newTestAuthService(store.Storage{
+			Users:         mockUserStore,
+			MFA:           mockMFAStore,
+			RevokedTokens: mockRevokedTokenStore,
+		})
+		// The clock stands still, so the lockout lasts exactly LockoutDuration
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		service.loginGuard = ratelimiter.NewMemoryLoginGuardWithClock(ratelimiter.LoginConfig{
+			MaxFailures:     3,
+			LockoutDuration: time.Minute,
+			Window:          time.Hour,
+		}, func() time.Time { return now })
+
+		mockUserStore.On("GetByEmail", ctx, user.Email).Return(user, nil)
+		mockMFAStore.On("GetByUserID", ctx, user.ID).Return(mfa, nil)
+		mockMFAStore.On("UseRecoveryCode", ctx, user.ID, mock.Anything).Return(store.ErrNotFound)
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil).Times(3)
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(true, nil).Once()
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+		mockRevokedTokenStore.On("Revoke", ctx, mock.Anything, mock.Anything).Return(nil).Once()
+
+		_, challenge, err := service.CreateToken(ctx, user.Email, "password123", "127.0.0.1")
+		require.NoError(t, err)
+
+		// Execute
+		for range 3 {
+			_, _, err := service.VerifyMFA(ctx, challenge.Token, "00000000")
+			assert.Equal(t, ErrInvalidMFACode, err)
+		}
+
+		// Assert the challenge is spent
+		_, _, err = service.VerifyMFA(ctx, challenge.Token, "00000000")
+		assert.Equal(t, ErrInvalidToken, err)
+
+		// A new challenge does not allow more guesses while the lockout lasts
+		_, challenge, err = service.CreateToken(ctx, user.Email, "password123", "127.0.0.1")
+		require.NoError(t, err)
+
+		_, _, err = service.VerifyMFA(ctx, challenge.Token, "00000000")
+		var throttled *LoginThrottledError
+		require.ErrorAs(t, err, &throttled)
+		assert.Equal(t, time.Minute, throttled.RetryAfter)
+
+		mockMFAStore.AssertNumberOfCalls(t, "UseRecoveryCode", 3)
+		mockRevokedTokenStore.AssertExpectations(t)
+	})
+
+	t.Run("replayed code is rejected", func(t *testing.T) {
+		// Setup
+		mockMFAStore := new(MockMFAStore)
+		service := newTestAuthService(store.Storage{
+			MFA: mockMFAStore,
+		})
+
+		code, err := auth.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		mockMFAStore.On("UseStep", ctx, user.ID, mock.Anything).Return(store.ErrConflict)
+
+		// Execute
+		err = service.checkMFACode(ctx, mfa, code)
+
+		// Assert
+		assert.Equal(t, ErrInvalidMFACode, err)
+	})
+
+	t.Run("recovery code is accepted once", func(t *testing.T) {
+		// Setup
+		mockMFAStore := new(MockMFAStore)
+		service := newTestAuthService(store.Storage{
+			MFA: mockMFAStore,
+		})
+
+		mockMFAStore.On("UseRecoveryCode", ctx, user.ID, hashToken("abcdefgh")).Return(nil).Once()
+		mockMFAStore.On("UseRecoveryCode", ctx, user.ID, hashToken("abcdefgh")).Return(store.ErrNotFound)
+
+		// Execute & Assert
+		assert.NoError(t, service.checkMFACode(ctx, mfa, "ABCD-EFGH"))
+		assert.Equal(t, ErrInvalidMFACode, service.checkMFACode(ctx, mfa, "abcd-efgh"))
+	})
+}
+
+func TestAuthService_MFAEnforcement(t *testing.T) {
+	ctx := context.Background()
+
+	moderator := &store.User{ID: 2, Email: "mod@example.com", Role: store.Role{Name: "moderator", Level: 2}}
+	require.NoError(t, moderator.Password.Set("password123"))
+
+	newEnforcingService := func(storage store.Storage) *AuthService {
+		service := newTestAuthService(storage)
+		service.config.MFARequiredRoleLevel = 2
+		return service
+	}
+
+	t.Run("privileged users without 2FA must enroll", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRevokedTokenStore := new(MockRevokedTokenStore)
+
+		service := newEnforcingService(store.Storage{
+			Users:         mockUserStore,
+			MFA:           mockMFAStore,
+			RevokedTokens: mockRevokedTokenStore,
+		})
+
+		var secret string
+		mockUserStore.On("GetByEmail", ctx, moderator.Email).Return(moderator, nil)
+		mockUserStore.On("GetByID", ctx, moderator.ID).Return(moderator, nil)
+		mockMFAStore.On("GetByUserID", ctx, moderator.ID).Return(nil, store.ErrNotFound).Once()
+		mockMFAStore.On("CreatePending", ctx, moderator.ID, mock.Anything).Run(func(args mock.Arguments) {
+			secret = args.String(2)
+		}).Return(nil)
+		mockRevokedTokenStore.On("IsRevoked", ctx, mock.Anything).Return(false, nil)
+
+		// Execute
+		tokens, challenge, err := service.CreateToken(ctx, moderator.Email, "password123", "127.0.0.1")
+
+		// Assert
+		require.NoError(t, err)
+		assert.Nil(t, tokens)
+		require.NotNil(t, challenge)
+		assert.True(t, challenge.EnrollmentRequired)
+
+		enrollment, err := service.StartMFAEnrollment(ctx, challenge.Token)
+		require.NoError(t, err)
+		assert.Equal(t, secret, enrollment.Secret)
+		assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	})
+
+	t.Run("privileged users cannot disable 2FA", func(t *testing.T) {
+		service := newEnforcingService(store.Storage{})
+
+		err := service.DisableTOTP(ctx, moderator, "123456")
+
+		assert.Equal(t, ErrMFAEnforced, err)
+	})
+}
+
+func TestAuthService_ConfirmTOTP(t *testing.T) {
+	ctx := context.Background()
+
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	// Setup
+	mockMFAStore := new(MockMFAStore)
+	service := newTestAuthService(store.Storage{
+		MFA: mockMFAStore,
+	})
+
+	code, err := auth.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+
+	mockMFAStore.On("GetByUserID", ctx, int64(1)).Return(&store.UserMFA{UserID: 1, Secret: secret}, nil)
+	mockMFAStore.On("Confirm", ctx, int64(1), mock.Anything, mock.MatchedBy(func(codes []string) bool {
+		return len(codes) == recoveryCodeCount
+	})).Return(nil)
+
+	// Execute
+	recoveryCodes, err := service.ConfirmTOTP(ctx, 1, code)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	mockMFAStore.AssertExpectations(t)
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/n-korel/social-api/internal/store"
 	"github.com/stretchr/testify/mock"
@@ -12,14 +14,93 @@ type MockAuthService struct {
 	mock.Mock
 }
 
-func (m *MockAuthService) CreateToken(ctx context.Context, email, password string) (string, error) {
-	args := m.Called(ctx, email, password)
-	return args.String(0), args.Error(1)
+func (m *MockAuthService) CreateToken(ctx context.Context, email, password, clientIP string) (*TokenPair, *MFAChallenge, error) {
+	args := m.Called(ctx, email, password, clientIP)
+	tokens, _ := args.Get(0).(*TokenPair)
+	challenge, _ := args.Get(1).(*MFAChallenge)
+	return tokens, challenge, args.Error(2)
+}
+
+func (m *MockAuthService) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	args := m.Called(ctx, refreshToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TokenPair), args.Error(1)
+}
+
+func (m *MockAuthService) ValidateToken(ctx context.Context, token string) (*TokenClaims, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TokenClaims), args.Error(1)
+}
+
+func (m *MockAuthService) Logout(ctx context.Context, claims *TokenClaims, refreshToken string) error {
+	args := m.Called(ctx, claims, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) LogoutAll(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ForgotPassword(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ResetPassword(ctx context.Context, token, password string) error {
+	args := m.Called(ctx, token, password)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) Shutdown(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
 }
 
-func (m *MockAuthService) ValidateToken(token string) (int64, error) {
-	args := m.Called(token)
-	return args.Get(0).(int64), args.Error(1)
+func (m *MockAuthService) VerifyMFA(ctx context.Context, mfaToken, code string) (*TokenPair, []string, error) {
+	args := m.Called(ctx, mfaToken, code)
+	tokens, _ := args.Get(0).(*TokenPair)
+	recoveryCodes, _ := args.Get(1).([]string)
+	return tokens, recoveryCodes, args.Error(2)
+}
+
+func (m *MockAuthService) StartMFAEnrollment(ctx context.Context, mfaToken string) (*TOTPEnrollment, error) {
+	args := m.Called(ctx, mfaToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TOTPEnrollment), args.Error(1)
+}
+
+func (m *MockAuthService) EnrollTOTP(ctx context.Context, user *store.User) (*TOTPEnrollment, error) {
+	args := m.Called(ctx, user)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TOTPEnrollment), args.Error(1)
+}
+
+func (m *MockAuthService) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	args := m.Called(ctx, userID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockAuthService) DisableTOTP(ctx context.Context, user *store.User, code string) error {
+	args := m.Called(ctx, user, code)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) UnlockUser(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
 }
 
 // Mock UserService
@@ -48,31 +129,131 @@ func (m *MockUserService) ActivateUser(ctx context.Context, token string) error
 	return args.Error(0)
 }
 
-func (m *MockUserService) FollowUser(ctx context.Context, followerID, followedID int64) error {
-	args := m.Called(ctx, followerID, followedID)
+func (m *MockUserService) Shutdown(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ResendActivation(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
 	return args.Error(0)
 }
 
+func (m *MockUserService) CleanupInvitations(ctx context.Context) (int64, int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockUserService) FollowUser(ctx context.Context, followerID, followedID int64) (bool, error) {
+	args := m.Called(ctx, followerID, followedID)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockUserService) UnfollowUser(ctx context.Context, followerID, followedID int64) error {
 	args := m.Called(ctx, followerID, followedID)
 	return args.Error(0)
 }
 
+func (m *MockUserService) GetFollowers(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error) {
+	args := m.Called(ctx, userID, viewerID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*FollowPage), args.Error(1)
+}
+
+func (m *MockUserService) GetFollowing(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error) {
+	args := m.Called(ctx, userID, viewerID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*FollowPage), args.Error(1)
+}
+
+func (m *MockUserService) GetFollowStats(ctx context.Context, userID, viewerID int64) (*store.FollowStats, error) {
+	args := m.Called(ctx, userID, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.FollowStats), args.Error(1)
+}
+
+func (m *MockUserService) GetFollowRequests(ctx context.Context, userID int64, query store.FollowListQuery) (*FollowPage, error) {
+	args := m.Called(ctx, userID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*FollowPage), args.Error(1)
+}
+
+func (m *MockUserService) AcceptFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	args := m.Called(ctx, userID, requesterID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	args := m.Called(ctx, userID, requesterID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) MuteUser(ctx context.Context, muterID, mutedID int64) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) UnmuteUser(ctx context.Context, muterID, mutedID int64) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) HasRole(ctx context.Context, user *store.User, role string) (bool, error) {
+	args := m.Called(ctx, user, role)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserService) UpdateProfile(ctx context.Context, userID int64, updates ProfileUpdateRequest) (*store.User, error) {
+	args := m.Called(ctx, userID, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.User), args.Error(1)
+}
+
+func (m *MockUserService) RequestEmailChange(ctx context.Context, userID int64, newEmail string) error {
+	args := m.Called(ctx, userID, newEmail)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ConfirmEmailChange(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
 // Mock PostService
 type MockPostService struct {
 	mock.Mock
 }
 
-func (m *MockPostService) CreatePost(ctx context.Context, userID int64, title, content string, tags []string) (*store.Post, error) {
-	args := m.Called(ctx, userID, title, content, tags)
+func (m *MockPostService) CreatePost(ctx context.Context, userID int64, title, content string, tags, mediaIDs []string, visibility string) (*store.Post, error) {
+	args := m.Called(ctx, userID, title, content, tags, mediaIDs, visibility)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*store.Post), args.Error(1)
 }
 
-func (m *MockPostService) GetPostByID(ctx context.Context, postID int64) (*store.Post, error) {
-	args := m.Called(ctx, postID)
+func (m *MockPostService) GetPostByID(ctx context.Context, postID, viewerID int64) (*store.Post, error) {
+	args := m.Called(ctx, postID, viewerID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -97,10 +278,174 @@ func (m *MockPostService) CanUserModifyPost(ctx context.Context, user *store.Use
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockPostService) GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+func (m *MockPostService) CreateComment(ctx context.Context, postID, userID, parentID int64, content string) (*store.Comment, error) {
+	args := m.Called(ctx, postID, userID, parentID, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Comment), args.Error(1)
+}
+
+func (m *MockPostService) GetComments(ctx context.Context, postID, viewerID int64, query store.CommentListQuery) (*CommentPage, error) {
+	args := m.Called(ctx, postID, viewerID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*CommentPage), args.Error(1)
+}
+
+func (m *MockPostService) GetComment(ctx context.Context, postID, commentID, viewerID int64) (*store.Comment, error) {
+	args := m.Called(ctx, postID, commentID, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Comment), args.Error(1)
+}
+
+func (m *MockPostService) UpdateComment(ctx context.Context, postID, commentID, userID int64, content string) (*store.Comment, error) {
+	args := m.Called(ctx, postID, commentID, userID, content)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Comment), args.Error(1)
+}
+
+func (m *MockPostService) DeleteComment(ctx context.Context, postID, commentID int64) error {
+	args := m.Called(ctx, postID, commentID)
+	return args.Error(0)
+}
+
+func (m *MockPostService) CanUserModifyComment(ctx context.Context, user *store.User, comment *store.Comment, requiredRole string) (bool, error) {
+	args := m.Called(ctx, user, comment, requiredRole)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostService) GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	args := m.Called(ctx, userID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.FeedPage), args.Error(1)
+}
+
+func (m *MockPostService) GetUserPosts(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
 	args := m.Called(ctx, userID, query)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+	return args.Get(0).(*store.FeedPage), args.Error(1)
+}
+
+func (m *MockPostService) GetExploreFeed(ctx context.Context, viewerID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	args := m.Called(ctx, viewerID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.FeedPage), args.Error(1)
+}
+
+func (m *MockPostService) GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]store.TagCount, error) {
+	args := m.Called(ctx, window, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.TagCount), args.Error(1)
+}
+
+// Mock APITokenService
+type MockAPITokenService struct {
+	mock.Mock
+}
+
+func (m *MockAPITokenService) CreateToken(ctx context.Context, userID int64, name string, scopes []string, expiresIn time.Duration) (*store.APIToken, string, error) {
+	args := m.Called(ctx, userID, name, scopes, expiresIn)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).(*store.APIToken), args.String(1), args.Error(2)
+}
+
+func (m *MockAPITokenService) ListTokens(ctx context.Context, userID int64) ([]store.APIToken, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenService) RevokeToken(ctx context.Context, userID, tokenID int64) error {
+	args := m.Called(ctx, userID, tokenID)
+	return args.Error(0)
+}
+
+func (m *MockAPITokenService) ValidateToken(ctx context.Context, token string) (*TokenClaims, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*TokenClaims), args.Error(1)
+}
+
+// Mock OIDCService
+type MockOIDCService struct {
+	mock.Mock
+}
+
+func (m *MockOIDCService) StartLogin(ctx context.Context, provider string) (string, error) {
+	args := m.Called(ctx, provider)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockOIDCService) CompleteLogin(ctx context.Context, provider, code, state string) (*TokenPair, *MFAChallenge, error) {
+	args := m.Called(ctx, provider, code, state)
+	tokens, _ := args.Get(0).(*TokenPair)
+	challenge, _ := args.Get(1).(*MFAChallenge)
+	return tokens, challenge, args.Error(2)
+}
+
+// Mock SearchService
+type MockSearchService struct {
+	mock.Mock
+}
+
+func (m *MockSearchService) Search(ctx context.Context, query store.SearchQuery) (*SearchResults, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*SearchResults), args.Error(1)
+}
+
+// Mock MediaService
+type MockMediaService struct {
+	mock.Mock
+}
+
+func (m *MockMediaService) Upload(ctx context.Context, userID int64, body io.Reader) (*store.Media, error) {
+	args := m.Called(ctx, userID, body)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Media), args.Error(1)
+}
+
+func (m *MockMediaService) GetMedia(ctx context.Context, id string, viewerID int64) (*store.Media, error) {
+	args := m.Called(ctx, id, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Media), args.Error(1)
+}
+
+func (m *MockMediaService) Open(ctx context.Context, media *store.Media, thumbnail bool) (io.ReadCloser, error) {
+	args := m.Called(ctx, media, thumbnail)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
+func (m *MockMediaService) DeleteMedia(ctx context.Context, id string, userID int64) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
 }
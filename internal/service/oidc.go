@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/n-korel/social-api/internal/oidc"
+	"github.com/n-korel/social-api/internal/store"
+)
+
+const maxUsernameAttempts = 5
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrInvalidOIDCState    = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed     = errors.New("identity provider login failed")
+	ErrOIDCAccountExists   = errors.New("an account with this email already exists, it is not linked to the identity provider")
+)
+
+// OIDCProvider is an OpenID provider running the authorization code flow with PKCE
+type OIDCProvider interface {
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	Exchange(ctx context.Context, code, codeVerifier string) (*oidc.Token, error)
+	VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*oidc.Claims, error)
+}
+
+type OIDCService struct {
+	store     store.Storage
+	auth      *AuthService
+	providers map[string]OIDCProvider
+	config    OIDCServiceConfig
+}
+
+type OIDCServiceConfig struct {
+	StateExpiration time.Duration
+	// TrustEmail lists the providers whose verified emails may link an existing account.
+	// Any other provider is refused when its email already belongs to an account.
+	TrustEmail map[string]bool
+}
+
+type OIDCServiceInterface interface {
+	StartLogin(ctx context.Context, provider string) (string, error)
+	CompleteLogin(ctx context.Context, provider, code, state string) (*TokenPair, *MFAChallenge, error)
+}
+
+func NewOIDCService(store store.Storage, auth *AuthService, providers map[string]OIDCProvider, config OIDCServiceConfig) *OIDCService {
+	return &OIDCService{
+		store:     store,
+		auth:      auth,
+		providers: providers,
+		config:    config,
+	}
+}
+
+// StartLogin returns the provider URL the user is redirected to
+func (s *OIDCService) StartLogin(ctx context.Context, provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	err = s.store.OIDCStates.Create(ctx, &store.OIDCState{
+		State:        hashToken(state),
+		Provider:     provider,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		Expiry:       time.Now().Add(s.config.StateExpiration),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return p.AuthCodeURL(state, nonce, oidc.S256Challenge(verifier)), nil
+}
+
+// CompleteLogin handles the provider callback. Like a password login it returns
+// either a token pair or an MFA challenge.
+func (s *OIDCService) CompleteLogin(ctx context.Context, provider, code, state string) (*TokenPair, *MFAChallenge, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, nil, ErrUnknownOIDCProvider
+	}
+
+	st, err := s.store.OIDCStates.Consume(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, ErrInvalidOIDCState
+		}
+		return nil, nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+
+	if st.Provider != provider || time.Now().After(st.Expiry) {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	token, err := p.Exchange(ctx, code, st.CodeVerifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrOIDCLoginFailed, err)
+	}
+
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, st.Nonce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrOIDCLoginFailed, err)
+	}
+
+	user, err := s.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	challenge, err := s.auth.mfaChallenge(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge != nil {
+		return nil, challenge, nil
+	}
+
+	tokens, err := s.auth.newSession(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, nil, nil
+}
+
+// resolveUser finds the user linked to the identity. Otherwise it links the account with
+// the same verified email if the provider is trusted, or creates a new active account on first login.
+func (s *OIDCService) resolveUser(ctx context.Context, provider string, claims *oidc.Claims) (*store.User, error) {
+	userID, err := s.store.Identities.GetUserID(ctx, provider, claims.Subject)
+	if err == nil {
+		user, err := s.store.Users.GetByID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, ErrUserNotFound
+			}
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	// Unverified emails could belong to somebody else, so they are never used to link or create accounts
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("%w: a verified email is required", ErrOIDCLoginFailed)
+	}
+
+	identity := &store.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err := s.store.Users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Anyone able to register the email with the provider would take over the account
+		if !s.config.TrustEmail[provider] {
+			return nil, ErrOIDCAccountExists
+		}
+		identity.UserID = user.ID
+		if err := s.store.Identities.Create(ctx, identity); err != nil {
+			return nil, fmt.Errorf("failed to link identity: %w", err)
+		}
+		return user, nil
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.createUser(ctx, claims, identity)
+}
+
+func (s *OIDCService) createUser(ctx context.Context, claims *oidc.Claims, identity *store.Identity) (*store.User, error) {
+	// Accounts created through a provider get a random password, which can be replaced with a password reset
+	password, err := randomPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	base := usernameFromClaims(claims)
+	for attempt := range maxUsernameAttempts {
+		user := &store.User{
+			Username: base,
+			Email:    claims.Email,
+			Role: store.Role{
+				Name: "user",
+			},
+		}
+		if attempt > 0 {
+			suffix, err := randomSuffix()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate username: %w", err)
+			}
+			user.Username = fmt.Sprintf("%s_%s", base, suffix)
+		}
+
+		if err := user.Password.Set(password); err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		err := s.store.Users.CreateWithIdentity(ctx, user, identity)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, store.ErrDuplicateUsername):
+			continue
+		case errors.Is(err, store.ErrDuplicateEmail):
+			// The email belongs to an account that was never activated
+			return nil, ErrEmailAlreadyExists
+		default:
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	return nil, ErrUsernameAlreadyExists
+}
+
+// usernameFromClaims picks the most readable username the claims offer
+func usernameFromClaims(claims *oidc.Claims) string {
+	candidates := []string{
+		claims.PreferredUsername,
+		claims.Name,
+		strings.Split(claims.Email, "@")[0],
+	}
+
+	for _, candidate := range candidates {
+		username := strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsLetter(r), unicode.IsDigit(r), r == '_', r == '.', r == '-':
+				return unicode.ToLower(r)
+			case unicode.IsSpace(r):
+				return '_'
+			default:
+				return -1
+			}
+		}, candidate)
+
+		if runes := []rune(username); len(runes) > 0 {
+			return string(runes[:min(len(runes), 50)])
+		}
+	}
+
+	return "user"
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/oidc"
+	"github.com/n-korel/social-api/internal/oidc/oidctest"
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockIdentityStore struct {
+	mock.Mock
+}
+
+func (m *MockIdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	args := m.Called(ctx, provider, subject)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockIdentityStore) Create(ctx context.Context, identity *store.Identity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+// memoryOIDCStateStore keeps states in a map, so the whole redirect round trip can run in a test
+type memoryOIDCStateStore struct {
+	states map[string]*store.OIDCState
+}
+
+func (s *memoryOIDCStateStore) Create(ctx context.Context, state *store.OIDCState) error {
+	s.states[state.State] = state
+	return nil
+}
+
+func (s *memoryOIDCStateStore) Consume(ctx context.Context, state string) (*store.OIDCState, error) {
+	st, ok := s.states[state]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(s.states, state)
+	return st, nil
+}
+
+func newTestOIDCService(t *testing.T, storage store.Storage, trustEmail bool) (*OIDCService, *oidctest.Provider) {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider("client", "secret")
+	require.NoError(t, err)
+	t.Cleanup(mock.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:    mock.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/v1/authentication/oidc/test/callback",
+	})
+	require.NoError(t, err)
+
+	storage.OIDCStates = &memoryOIDCStateStore{states: map[string]*store.OIDCState{}}
+
+	service := NewOIDCService(
+		storage,
+		newTestAuthService(storage),
+		map[string]OIDCProvider{"test": provider},
+		OIDCServiceConfig{
+			StateExpiration: 10 * time.Minute,
+			TrustEmail:      map[string]bool{"test": trustEmail},
+		},
+	)
+
+	return service, mock
+}
+
+// login runs the redirect to the provider and returns the code and state of its callback
+func login(t *testing.T, service *OIDCService, mock *oidctest.Provider) (string, string) {
+	t.Helper()
+
+	authURL, err := service.StartLogin(context.Background(), "test")
+	require.NoError(t, err)
+
+	code, state, err := mock.Authorize(authURL)
+	require.NoError(t, err)
+
+	return code, state
+}
+
+func TestOIDCService_CompleteLogin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("first login creates an active account linked to the identity", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockIdentityStore := new(MockIdentityStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+
+		service, provider := newTestOIDCService(t, store.Storage{
+			Users:         mockUserStore,
+			Identities:    mockIdentityStore,
+			MFA:           mockMFAStore,
+			RefreshTokens: mockRefreshTokenStore,
+		}, false)
+
+		mockIdentityStore.On("GetUserID", ctx, "test", provider.User.Subject).Return(int64(0), store.ErrNotFound)
+		mockUserStore.On("GetByEmail", ctx, provider.User.Email).Return(nil, store.ErrNotFound)
+		mockUserStore.On("CreateWithIdentity", ctx, mock.MatchedBy(func(u *store.User) bool {
+			return u.Username == "oidctest" && u.Email == provider.User.Email
+		}), mock.MatchedBy(func(i *store.Identity) bool {
+			return i.Provider == "test" && i.Subject == provider.User.Subject
+		})).Run(func(args mock.Arguments) {
+			args.Get(1).(*store.User).ID = 7
+		}).Return(nil)
+		mockMFAStore.On("GetByUserID", ctx, int64(7)).Return(nil, store.ErrNotFound)
+		mockRefreshTokenStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		code, state := login(t, service, provider)
+
+		// Execute
+		tokens, challenge, err := service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Nil(t, challenge)
+		assert.NotEmpty(t, tokens.AccessToken)
+		mockUserStore.AssertExpectations(t)
+	})
+
+	t.Run("linked identity logs into its account", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockIdentityStore := new(MockIdentityStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+
+		service, provider := newTestOIDCService(t, store.Storage{
+			Users:         mockUserStore,
+			Identities:    mockIdentityStore,
+			MFA:           mockMFAStore,
+			RefreshTokens: mockRefreshTokenStore,
+		}, false)
+
+		user := &store.User{ID: 3, Email: "other@example.com"}
+		mockIdentityStore.On("GetUserID", ctx, "test", provider.User.Subject).Return(user.ID, nil)
+		mockUserStore.On("GetByID", ctx, user.ID).Return(user, nil)
+		mockMFAStore.On("GetByUserID", ctx, user.ID).Return(nil, store.ErrNotFound)
+		mockRefreshTokenStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		code, state := login(t, service, provider)
+
+		// Execute
+		tokens, _, err := service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		mockUserStore.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unverified email is not linked", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockIdentityStore := new(MockIdentityStore)
+
+		service, provider := newTestOIDCService(t, store.Storage{
+			Users:      mockUserStore,
+			Identities: mockIdentityStore,
+		}, false)
+		provider.User.EmailVerified = false
+
+		mockIdentityStore.On("GetUserID", ctx, "test", provider.User.Subject).Return(int64(0), store.ErrNotFound)
+
+		code, state := login(t, service, provider)
+
+		// Execute
+		_, _, err := service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrOIDCLoginFailed)
+		mockUserStore.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("existing email is not linked by an untrusted provider", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockIdentityStore := new(MockIdentityStore)
+
+		service, provider := newTestOIDCService(t, store.Storage{
+			Users:      mockUserStore,
+			Identities: mockIdentityStore,
+		}, false)
+
+		mockIdentityStore.On("GetUserID", ctx, "test", provider.User.Subject).Return(int64(0), store.ErrNotFound)
+		mockUserStore.On("GetByEmail", ctx, provider.User.Email).Return(&store.User{ID: 3, Email: provider.User.Email}, nil)
+
+		code, state := login(t, service, provider)
+
+		// Execute
+		tokens, challenge, err := service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrOIDCAccountExists)
+		assert.Nil(t, tokens)
+		assert.Nil(t, challenge)
+		mockIdentityStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("existing email is linked by a trusted provider", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockIdentityStore := new(MockIdentityStore)
+		mockMFAStore := new(MockMFAStore)
+		mockRefreshTokenStore := new(MockRefreshTokenStore)
+
+		service, provider := newTestOIDCService(t, store.Storage{
+			Users:         mockUserStore,
+			Identities:    mockIdentityStore,
+			MFA:           mockMFAStore,
+			RefreshTokens: mockRefreshTokenStore,
+		}, true)
+
+		user := &store.User{ID: 3, Email: provider.User.Email}
+		mockIdentityStore.On("GetUserID", ctx, "test", provider.User.Subject).Return(int64(0), store.ErrNotFound)
+		mockUserStore.On("GetByEmail", ctx, provider.User.Email).Return(user, nil)
+		mockIdentityStore.On("Create", ctx, mock.MatchedBy(func(i *store.Identity) bool {
+			return i.UserID == user.ID && i.Subject == provider.User.Subject
+		})).Return(nil)
+		mockMFAStore.On("GetByUserID", ctx, user.ID).Return(nil, store.ErrNotFound)
+		mockRefreshTokenStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		code, state := login(t, service, provider)
+
+		// Execute
+		tokens, _, err := service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		mockIdentityStore.AssertExpectations(t)
+	})
+
+	t.Run("state can only be used once", func(t *testing.T) {
+		// Setup
+		service, provider := newTestOIDCService(t, store.Storage{}, false)
+
+		authURL, err := service.StartLogin(ctx, "test")
+		require.NoError(t, err)
+
+		parsed, err := url.Parse(authURL)
+		require.NoError(t, err)
+		state := parsed.Query().Get("state")
+
+		_, err = service.store.OIDCStates.Consume(ctx, hashToken(state))
+		require.NoError(t, err)
+
+		code, _, err := provider.Authorize(authURL)
+		require.NoError(t, err)
+
+		// Execute
+		_, _, err = service.CompleteLogin(ctx, "test", code, state)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		service, _ := newTestOIDCService(t, store.Storage{}, false)
+
+		_, err := service.StartLogin(ctx, "missing")
+		assert.ErrorIs(t, err, ErrUnknownOIDCProvider)
+	})
+}
@@ -4,54 +4,209 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/n-korel/social-api/internal/store"
 )
 
 var (
-	ErrPostNotFound = errors.New("post not found")
+	ErrPostNotFound         = errors.New("post not found")
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrInvalidParentComment = errors.New("parent comment not found")
+	ErrCommentTooDeep       = errors.New("comment thread is too deep")
 )
 
+// mentionPattern matches @username mentions, usernames with other characters cannot be mentioned
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
 type PostUpdateRequest struct {
-	Title   *string
-	Content *string
+	Title      *string
+	Content    *string
+	Visibility *string
 }
 
 type PostService struct {
-	store store.Storage
+	store  store.Storage
+	cache  CacheStorage
+	config PostServiceConfig
+}
+
+type PostServiceConfig struct {
+	// Posts kept in each cached home timeline
+	TimelineLength int
+	// Posts of authors with more followers are not pushed to timelines but merged in when a feed is read
+	FanoutMaxFollowers int
+	Ranking            store.FeedRanking
+	// Text search configuration new posts are indexed with
+	SearchLanguage string
+	// Deepest reply level below top level comments, 0 disables replies
+	MaxCommentDepth int
+}
+
+// CommentPage is a page of comments or replies
+type CommentPage struct {
+	Comments   []store.Comment
+	NextCursor string
+}
+
+// TimelineCache keeps the newest post IDs of each home timeline
+type TimelineCache interface {
+	Get(ctx context.Context, userID int64) ([]int64, error)
+	Replace(ctx context.Context, userID int64, postIDs []int64, maxLen int) error
+	Push(ctx context.Context, userIDs []int64, postID int64, maxLen int) error
+	Delete(ctx context.Context, userID int64)
+}
+
+// TagCounter keeps rolling counts of the tags of new posts
+type TagCounter interface {
+	Increment(ctx context.Context, postID int64, tags []string, at time.Time) error
+	Decrement(ctx context.Context, postID int64) error
+	Top(ctx context.Context, window time.Duration, limit int, now time.Time) ([]store.TagCount, error)
 }
 
 type PostServiceInterface interface {
-	CreatePost(ctx context.Context, userID int64, title, content string, tags []string) (*store.Post, error)
-	GetPostByID(ctx context.Context, postID int64) (*store.Post, error)
+	CreatePost(ctx context.Context, userID int64, title, content string, tags, mediaIDs []string, visibility string) (*store.Post, error)
+	GetPostByID(ctx context.Context, postID, viewerID int64) (*store.Post, error)
 	UpdatePost(ctx context.Context, postID int64, updates PostUpdateRequest) (*store.Post, error)
 	DeletePost(ctx context.Context, postID int64) error
 	CanUserModifyPost(ctx context.Context, user *store.User, post *store.Post, requiredRole string) (bool, error)
-	GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error)
+	CreateComment(ctx context.Context, postID, userID, parentID int64, content string) (*store.Comment, error)
+	GetComments(ctx context.Context, postID, viewerID int64, query store.CommentListQuery) (*CommentPage, error)
+	GetComment(ctx context.Context, postID, commentID, viewerID int64) (*store.Comment, error)
+	UpdateComment(ctx context.Context, postID, commentID, userID int64, content string) (*store.Comment, error)
+	DeleteComment(ctx context.Context, postID, commentID int64) error
+	CanUserModifyComment(ctx context.Context, user *store.User, comment *store.Comment, requiredRole string) (bool, error)
+	GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error)
+	GetUserPosts(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error)
+	GetExploreFeed(ctx context.Context, viewerID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error)
+	GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]store.TagCount, error)
 }
 
-func NewPostService(store store.Storage) *PostService {
+func NewPostService(store store.Storage, cache CacheStorage, config PostServiceConfig) *PostService {
 	return &PostService{
-		store: store,
+		store:  store,
+		cache:  cache,
+		config: config,
 	}
 }
 
-func (s *PostService) CreatePost(ctx context.Context, userID int64, title, content string, tags []string) (*store.Post, error) {
+// CreatePost creates a post with the given media attached, which must have been uploaded by the author.
+// An empty visibility makes the post public.
+func (s *PostService) CreatePost(ctx context.Context, userID int64, title, content string, tags, mediaIDs []string, visibility string) (*store.Post, error) {
+	if err := s.checkMediaOwner(ctx, userID, mediaIDs); err != nil {
+		return nil, err
+	}
+
+	if visibility == "" {
+		visibility = store.VisibilityPublic
+	}
+
 	post := &store.Post{
-		Title:   title,
-		Content: content,
-		Tags:    tags,
-		UserID:  userID,
+		Title:      title,
+		Content:    content,
+		Tags:       tags,
+		MediaIDs:   mediaIDs,
+		Visibility: visibility,
+		UserID:     userID,
+		Language:   s.config.SearchLanguage,
+		Mentions:   parseMentions(content),
 	}
 
 	if err := s.store.Posts.Create(ctx, post); err != nil {
 		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 
+	// Timelines are a cache: when the fan-out fails they are only missing the post until rebuilt
+	_ = s.fanout(ctx, post)
+
+	s.trendTags(ctx, post)
+
 	return post, nil
 }
 
-func (s *PostService) GetPostByID(ctx context.Context, postID int64) (*store.Post, error) {
+// checkMediaOwner returns ErrInvalidMedia unless every media ID is distinct and owned by the user
+func (s *PostService) checkMediaOwner(ctx context.Context, userID int64, mediaIDs []string) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+
+	found, err := s.store.Media.GetByIDs(ctx, mediaIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get media: %w", err)
+	}
+
+	owned := 0
+	for _, m := range found {
+		if m.UserID == userID {
+			owned++
+		}
+	}
+
+	if owned != len(mediaIDs) {
+		return ErrInvalidMedia
+	}
+
+	return nil
+}
+
+// fanout pushes a new post to the cached timelines of its author and their followers. Timelines
+// are filtered by visibility on read, drafts are not pushed at all.
+func (s *PostService) fanout(ctx context.Context, post *store.Post) error {
+	if s.cache == nil || post.Visibility == store.VisibilityPrivate {
+		return nil
+	}
+
+	followerIDs, err := s.store.Followers.GetFollowerIDs(ctx, post.UserID, s.config.FanoutMaxFollowers+1)
+	if err != nil {
+		return err
+	}
+
+	// Popular authors are merged in on read instead
+	if len(followerIDs) > s.config.FanoutMaxFollowers {
+		followerIDs = nil
+	}
+
+	return s.cache.Timelines().Push(ctx, append(followerIDs, post.UserID), post.ID, s.config.TimelineLength)
+}
+
+// trendTags counts the tags of a public post towards trending tags. Posts of private
+// accounts are not counted, their tags would leak to everyone.
+func (s *PostService) trendTags(ctx context.Context, post *store.Post) {
+	if s.cache == nil || post.Visibility != store.VisibilityPublic || len(post.Tags) == 0 {
+		return
+	}
+
+	// Trending tags are approximate, a lost increment is not worth failing the post for
+	author, err := s.store.Users.GetByID(ctx, post.UserID)
+	if err != nil || author.IsPrivate {
+		return
+	}
+
+	_ = s.cache.Tags().Increment(ctx, post.ID, post.Tags, time.Now())
+}
+
+// untrendTags takes back the tags of a post that is no longer public, so that trending tags
+// agree with what the database would count
+func (s *PostService) untrendTags(ctx context.Context, postID int64) {
+	if s.cache == nil {
+		return
+	}
+
+	_ = s.cache.Tags().Decrement(ctx, postID)
+}
+
+// GetPostByID returns the post as seen by viewerID. Posts the viewer may not see are not found,
+// so their existence does not leak. A zero viewer sees everything. Comments are paged separately
+// with GetComments.
+func (s *PostService) GetPostByID(ctx context.Context, postID, viewerID int64) (*store.Post, error) {
+	if viewerID != 0 {
+		if err := s.checkPostVisible(ctx, postID, viewerID); err != nil {
+			return nil, err
+		}
+	}
+
 	post, err := s.store.Posts.GetByID(ctx, postID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
@@ -60,13 +215,6 @@ func (s *PostService) GetPostByID(ctx context.Context, postID int64) (*store.Pos
 		return nil, fmt.Errorf("failed to get post: %w", err)
 	}
 
-	// Comments
-	comments, err := s.store.Comments.GetByPostID(ctx, postID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get comments: %w", err)
-	}
-	post.Comments = comments
-
 	return post, nil
 }
 
@@ -85,6 +233,11 @@ func (s *PostService) UpdatePost(ctx context.Context, postID int64, updates Post
 	if updates.Content != nil {
 		post.Content = *updates.Content
 	}
+	previousVisibility := post.Visibility
+	if updates.Visibility != nil {
+		post.Visibility = *updates.Visibility
+	}
+	post.Mentions = parseMentions(post.Content)
 
 	if err := s.store.Posts.Update(ctx, post); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
@@ -93,6 +246,17 @@ func (s *PostService) UpdatePost(ctx context.Context, postID int64, updates Post
 		return nil, fmt.Errorf("failed to update post: %w", err)
 	}
 
+	// A published draft reaches timelines and trending tags as if it was just posted
+	if previousVisibility == store.VisibilityPrivate {
+		_ = s.fanout(ctx, post)
+	}
+	if previousVisibility != store.VisibilityPublic {
+		s.trendTags(ctx, post)
+	}
+	if previousVisibility == store.VisibilityPublic && post.Visibility != store.VisibilityPublic {
+		s.untrendTags(ctx, post.ID)
+	}
+
 	return post, nil
 }
 
@@ -103,13 +267,167 @@ func (s *PostService) DeletePost(ctx context.Context, postID int64) error {
 		}
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
+
+	s.untrendTags(ctx, postID)
+
 	return nil
 }
 
 // Check if user can modify a post
 func (s *PostService) CanUserModifyPost(ctx context.Context, user *store.User, post *store.Post, requiredRole string) (bool, error) {
-	// Is the user the owner of this post?
-	if post.UserID == user.ID {
+	return s.canUserModify(ctx, user, post.UserID, requiredRole)
+}
+
+// CreateComment comments on a post, or replies to parentID when it is not 0. Posts the user
+// may not see, including posts of users blocked with them, are not found.
+func (s *PostService) CreateComment(ctx context.Context, postID, userID, parentID int64, content string) (*store.Comment, error) {
+	if err := s.checkPostVisible(ctx, postID, userID); err != nil {
+		return nil, err
+	}
+
+	comment := &store.Comment{
+		PostID:   postID,
+		UserID:   userID,
+		Content:  content,
+		Language: s.config.SearchLanguage,
+	}
+
+	if parentID != 0 {
+		parent, err := s.GetComment(ctx, postID, parentID, userID)
+		if err != nil {
+			if errors.Is(err, ErrCommentNotFound) {
+				return nil, ErrInvalidParentComment
+			}
+			return nil, err
+		}
+
+		// Comments of blocked users are hidden, so they cannot be replied to either
+		blocked, err := s.store.Blocks.IsBlocked(ctx, userID, parent.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check block: %w", err)
+		}
+		// Deleted comments only stay to keep their replies in the thread
+		if blocked || parent.DeletedAt != nil {
+			return nil, ErrInvalidParentComment
+		}
+
+		if parent.Depth+1 > s.config.MaxCommentDepth {
+			return nil, ErrCommentTooDeep
+		}
+
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	if err := s.store.Comments.Create(ctx, comment); err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// GetComments returns a page of the top level comments of a post, or of the replies to
+// query.ParentID, each with its number of direct replies
+func (s *PostService) GetComments(ctx context.Context, postID, viewerID int64, query store.CommentListQuery) (*CommentPage, error) {
+	if err := s.checkPostVisible(ctx, postID, viewerID); err != nil {
+		return nil, err
+	}
+
+	if query.ParentID != 0 {
+		if _, err := s.GetComment(ctx, postID, query.ParentID, viewerID); err != nil {
+			return nil, err
+		}
+	}
+
+	// One extra comment tells whether there is a next page
+	fetch := query
+	fetch.Limit++
+
+	comments, err := s.store.Comments.List(ctx, postID, viewerID, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+
+	page := &CommentPage{Comments: comments}
+	if len(comments) > query.Limit {
+		page.Comments = comments[:query.Limit]
+		page.NextCursor = query.NextCursor(page.Comments)
+	}
+
+	return page, nil
+}
+
+// checkPostVisible returns ErrPostNotFound unless the post exists and viewerID may see it
+func (s *PostService) checkPostVisible(ctx context.Context, postID, viewerID int64) error {
+	visible, err := s.store.Posts.IsVisible(ctx, postID, viewerID)
+	if err != nil {
+		return fmt.Errorf("failed to check post visibility: %w", err)
+	}
+	if !visible {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// GetComment returns a comment of the post, comments of other posts are not found. Its replies
+// are counted as viewerID sees them, a zero viewer counts all of them.
+func (s *PostService) GetComment(ctx context.Context, postID, commentID, viewerID int64) (*store.Comment, error) {
+	comment, err := s.store.Comments.GetByID(ctx, commentID, viewerID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	if comment.PostID != postID {
+		return nil, ErrCommentNotFound
+	}
+
+	return comment, nil
+}
+
+func (s *PostService) UpdateComment(ctx context.Context, postID, commentID, userID int64, content string) (*store.Comment, error) {
+	comment, err := s.GetComment(ctx, postID, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Content = content
+
+	if err := s.store.Comments.Update(ctx, comment); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// DeleteComment deletes a comment. Replies keep their place in the thread under the cleared comment.
+func (s *PostService) DeleteComment(ctx context.Context, postID, commentID int64) error {
+	if _, err := s.GetComment(ctx, postID, commentID, 0); err != nil {
+		return err
+	}
+
+	if err := s.store.Comments.Delete(ctx, commentID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrCommentNotFound
+		}
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	return nil
+}
+
+// Check if user can modify a comment, with the same role levels as posts
+func (s *PostService) CanUserModifyComment(ctx context.Context, user *store.User, comment *store.Comment, requiredRole string) (bool, error) {
+	return s.canUserModify(ctx, user, comment.UserID, requiredRole)
+}
+
+func (s *PostService) canUserModify(ctx context.Context, user *store.User, ownerID int64, requiredRole string) (bool, error) {
+	// Is the user the owner?
+	if ownerID == user.ID {
 		return true, nil
 	}
 
@@ -122,10 +440,152 @@ func (s *PostService) CanUserModifyPost(ctx context.Context, user *store.User, p
 	return user.Role.Level >= role.Level, nil
 }
 
-func (s *PostService) GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
-	feed, err := s.store.Posts.GetUserFeed(ctx, userID, query)
+func (s *PostService) GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	// One extra post tells whether there is a next page
+	fetch := query
+	fetch.Limit++
+
+	if query.Mode == store.FeedModeRanked {
+		feed, err := s.store.Posts.GetRankedFeed(ctx, userID, fetch, s.config.Ranking)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ranked feed: %w", err)
+		}
+		return store.NewFeedPage(feed, query), nil
+	}
+
+	if s.cache != nil && timelineQuery(query) {
+		page, err := s.timelineFeed(ctx, userID, query, fetch)
+		// The database serves the feed when the cache is unavailable or the page runs past the cached timeline
+		if err == nil && page != nil {
+			return page, nil
+		}
+	}
+
+	feed, err := s.store.Posts.GetUserFeed(ctx, userID, fetch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user feed: %w", err)
 	}
-	return feed, nil
+	return store.NewFeedPage(feed, query), nil
+}
+
+// timelineQuery reports whether the cached timeline can serve a feed query. Searches, tag
+// filters, oldest first and offset pages go to the database.
+func timelineQuery(query store.PaginatedFeedQuery) bool {
+	return query.Search == "" && len(query.Tags) == 0 && query.Sort == "desc" && query.Offset == 0
+}
+
+// timelineFeed reads a feed page from the cached timeline, building it on first use. It returns
+// no page when the page continues past the oldest post of a full timeline, as older posts were
+// trimmed from it.
+func (s *PostService) timelineFeed(ctx context.Context, userID int64, query, fetch store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	postIDs, err := s.cache.Timelines().Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if postIDs == nil {
+		postIDs, err = s.store.Posts.GetTimeline(ctx, userID, s.config.TimelineLength)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.cache.Timelines().Replace(ctx, userID, postIDs, s.config.TimelineLength); err != nil {
+			return nil, err
+		}
+	}
+
+	// Posts of popular authors older than a full timeline would crowd out the trimmed ones
+	full := len(postIDs) >= s.config.TimelineLength && len(postIDs) > 0
+	var minID int64
+	if full {
+		minID = slices.Min(postIDs)
+		if query.Cursor != nil && query.Cursor.ID < minID {
+			return nil, nil
+		}
+	}
+
+	authorIDs, err := s.store.Followers.GetPopularFollowed(ctx, userID, s.config.FanoutMaxFollowers)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := s.store.Posts.GetFeedByIDs(ctx, userID, postIDs, authorIDs, minID, fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	backward := query.Cursor != nil && query.Cursor.Backward
+	if full && len(feed) <= query.Limit && !backward {
+		return nil, nil
+	}
+
+	return store.NewFeedPage(feed, query), nil
+}
+
+// GetUserPosts returns the posts written by the user, newest first unless query says otherwise
+func (s *PostService) GetUserPosts(ctx context.Context, userID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	fetch := query
+	fetch.Limit++
+
+	posts, err := s.store.Posts.GetUserPosts(ctx, userID, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user posts: %w", err)
+	}
+
+	return store.NewFeedPage(posts, query), nil
+}
+
+// GetExploreFeed returns the public posts of all users that viewerID may see, a zero viewer sees
+// public accounts only. Ranked explore feeds are ordered by popularity only, they are the same
+// for every viewer.
+func (s *PostService) GetExploreFeed(ctx context.Context, viewerID int64, query store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	fetch := query
+	fetch.Limit++
+
+	ranking := s.config.Ranking
+	ranking.AffinityWeight = 0
+	ranking.TagsWeight = 0
+
+	feed, err := s.store.Posts.GetExploreFeed(ctx, viewerID, fetch, ranking)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get explore feed: %w", err)
+	}
+
+	return store.NewFeedPage(feed, query), nil
+}
+
+// GetTrendingTags returns the most used tags of posts created within window, from the
+// Redis counters when they cover the window and from Postgres otherwise
+func (s *PostService) GetTrendingTags(ctx context.Context, window time.Duration, limit int) ([]store.TagCount, error) {
+	now := time.Now()
+
+	if s.cache != nil {
+		tags, err := s.cache.Tags().Top(ctx, window, limit, now)
+		if err == nil {
+			return tags, nil
+		}
+	}
+
+	tags, err := s.store.Posts.GetTrendingTags(ctx, now.Add(-window), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trending tags: %w", err)
+	}
+
+	if tags == nil {
+		tags = []store.TagCount{}
+	}
+
+	return tags, nil
+}
+
+// parseMentions returns the distinct usernames mentioned in content
+func parseMentions(content string) []string {
+	var mentions []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(mentions, m[1]) {
+			mentions = append(mentions, m[1])
+		}
+	}
+
+	return mentions
 }
@@ -0,0 +1,945 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockPostStore struct {
+	mock.Mock
+}
+
+func (m *MockPostStore) Create(ctx context.Context, post *store.Post) error {
+	args := m.Called(ctx, post)
+	return args.Error(0)
+}
+
+func (m *MockPostStore) GetByID(ctx context.Context, id int64) (*store.Post, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Post), args.Error(1)
+}
+
+func (m *MockPostStore) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *store.Post) error {
+	args := m.Called(ctx, post)
+	return args.Error(0)
+}
+
+func (m *MockPostStore) GetUserPosts(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	args := m.Called(ctx, userID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+}
+
+func (m *MockPostStore) GetFeedByIDs(ctx context.Context, viewerID int64, postIDs, authorIDs []int64, minID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	args := m.Called(ctx, viewerID, postIDs, authorIDs, minID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+}
+
+func (m *MockPostStore) GetTimeline(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	args := m.Called(ctx, userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockPostStore) GetRankedFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery, ranking store.FeedRanking) ([]store.PostWithMetadata, error) {
+	args := m.Called(ctx, userID, query, ranking)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+}
+
+func (m *MockPostStore) IsVisible(ctx context.Context, postID, viewerID int64) (bool, error) {
+	args := m.Called(ctx, postID, viewerID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostStore) GetExploreFeed(ctx context.Context, viewerID int64, query store.PaginatedFeedQuery, ranking store.FeedRanking) ([]store.PostWithMetadata, error) {
+	args := m.Called(ctx, viewerID, query, ranking)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+}
+
+func (m *MockPostStore) GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]store.TagCount, error) {
+	args := m.Called(ctx, since, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.TagCount), args.Error(1)
+}
+
+func (m *MockPostStore) GetUserFeed(ctx context.Context, userID int64, query store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	args := m.Called(ctx, userID, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostWithMetadata), args.Error(1)
+}
+
+type MockCommentStore struct {
+	mock.Mock
+}
+
+func (m *MockCommentStore) Create(ctx context.Context, comment *store.Comment) error {
+	args := m.Called(ctx, comment)
+	return args.Error(0)
+}
+
+func (m *MockCommentStore) List(ctx context.Context, postID, viewerID int64, q store.CommentListQuery) ([]store.Comment, error) {
+	args := m.Called(ctx, postID, viewerID, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.Comment), args.Error(1)
+}
+
+func (m *MockCommentStore) GetByID(ctx context.Context, id, viewerID int64) (*store.Comment, error) {
+	args := m.Called(ctx, id, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.Comment), args.Error(1)
+}
+
+func (m *MockCommentStore) Update(ctx context.Context, comment *store.Comment) error {
+	args := m.Called(ctx, comment)
+	return args.Error(0)
+}
+
+func (m *MockCommentStore) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func feedPosts(ids ...int64) []store.PostWithMetadata {
+	posts := make([]store.PostWithMetadata, len(ids))
+	for i, id := range ids {
+		posts[i].ID = id
+		posts[i].CreatedAt = "2025-01-01T00:00:00.123456Z"
+	}
+	return posts
+}
+
+func TestPostService_GetUserFeed(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("first page links to the next page only", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc"}
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return q.Limit == 3
+		})).Return(feedPosts(5, 4, 3), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, page.Posts, 2)
+		assert.Empty(t, page.PrevCursor)
+
+		next, err := store.DecodeFeedCursor(page.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), next.ID)
+		assert.False(t, next.Backward)
+	})
+
+	t.Run("last page has no next cursor", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+		cursor := &store.FeedCursor{CreatedAt: "2025-01-01T00:00:00.123456Z", ID: 4}
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor}
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.Anything).Return(feedPosts(3), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, page.Posts, 1)
+		assert.Empty(t, page.NextCursor)
+
+		prev, err := store.DecodeFeedCursor(page.PrevCursor)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), prev.ID)
+		assert.True(t, prev.Backward)
+	})
+
+	t.Run("backward page drops the extra post at its start", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+		cursor := &store.FeedCursor{CreatedAt: "2025-01-01T00:00:00.123456Z", ID: 3, Backward: true}
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor}
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.Anything).Return(feedPosts(6, 5, 4), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(5, 4), page.Posts)
+		assert.NotEmpty(t, page.NextCursor)
+		assert.NotEmpty(t, page.PrevCursor)
+	})
+
+	t.Run("ranked pages link with offset cursors", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		ranking := store.FeedRanking{RecencyWeight: 1, HalfLife: time.Hour}
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, PostServiceConfig{Ranking: ranking})
+
+		query := store.PaginatedFeedQuery{Limit: 2, Offset: 2, Sort: "desc", Mode: store.FeedModeRanked}
+		mockPostStore.On("GetRankedFeed", ctx, int64(1), mock.MatchedBy(func(q store.PaginatedFeedQuery) bool {
+			return q.Limit == 3 && q.Offset == 2
+		}), ranking).Return(feedPosts(4, 9, 1), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(4, 9), page.Posts)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+
+		next, err := store.DecodeFeedCursor(page.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, 4, *next.Offset)
+
+		prev, err := store.DecodeFeedCursor(page.PrevCursor)
+		require.NoError(t, err)
+		assert.Equal(t, 0, *prev.Offset)
+	})
+}
+
+func TestPostService_Timeline(t *testing.T) {
+	ctx := context.Background()
+	config := PostServiceConfig{TimelineLength: 3, FanoutMaxFollowers: 2}
+
+	t.Run("new post is pushed to the author and followers", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockUserStore := new(MockUserStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore, Users: mockUserStore}, mockCacheStorage, config)
+
+		mockPostStore.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*store.Post).ID = 10
+		}).Return(nil)
+		mockFollowerStore.On("GetFollowerIDs", ctx, int64(1), 3).Return([]int64{2, 3}, nil)
+		mockCacheStorage.timelines.On("Push", ctx, []int64{2, 3, 1}, int64(10), 3).Return(nil)
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1}, nil)
+		mockCacheStorage.tags.On("Increment", ctx, int64(10), []string{"go"}, mock.Anything).Return(nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", []string{"go"}, nil, "")
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertExpectations(t)
+		mockCacheStorage.tags.AssertExpectations(t)
+	})
+
+	t.Run("popular author is not fanned out", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, config)
+
+		mockPostStore.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*store.Post).ID = 10
+		}).Return(nil)
+		mockFollowerStore.On("GetFollowerIDs", ctx, int64(1), 3).Return([]int64{2, 3, 4}, nil)
+		mockCacheStorage.timelines.On("Push", ctx, []int64{1}, int64(10), 3).Return(nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", nil, nil, "")
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertExpectations(t)
+	})
+
+	t.Run("tags of private accounts are not trending", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockUserStore := new(MockUserStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore, Users: mockUserStore}, mockCacheStorage, config)
+
+		mockPostStore.On("Create", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(1).(*store.Post).ID = 10
+		}).Return(nil)
+		mockFollowerStore.On("GetFollowerIDs", ctx, int64(1), 3).Return([]int64{2}, nil)
+		mockCacheStorage.timelines.On("Push", ctx, []int64{2, 1}, int64(10), 3).Return(nil)
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1, UserProfile: store.UserProfile{IsPrivate: true}}, nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", []string{"go"}, nil, "")
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertExpectations(t)
+		mockCacheStorage.tags.AssertNotCalled(t, "Increment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing timeline is built and merged with popular authors", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, config)
+
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc"}
+		mockCacheStorage.timelines.On("Get", ctx, int64(1)).Return(nil, nil)
+		mockPostStore.On("GetTimeline", ctx, int64(1), 3).Return([]int64{9, 8}, nil)
+		mockCacheStorage.timelines.On("Replace", ctx, int64(1), []int64{9, 8}, 3).Return(nil)
+		mockFollowerStore.On("GetPopularFollowed", ctx, int64(1), 2).Return([]int64{5}, nil)
+		mockPostStore.On("GetFeedByIDs", ctx, int64(1), []int64{9, 8}, []int64{5}, int64(0), mock.Anything).Return(feedPosts(11, 9, 8), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(11, 9), page.Posts)
+		mockPostStore.AssertNotCalled(t, "GetUserFeed", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("empty timeline is not rebuilt", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, config)
+
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc"}
+		mockCacheStorage.timelines.On("Get", ctx, int64(1)).Return([]int64{}, nil)
+		mockFollowerStore.On("GetPopularFollowed", ctx, int64(1), 2).Return([]int64{5}, nil)
+		mockPostStore.On("GetFeedByIDs", ctx, int64(1), []int64{}, []int64{5}, int64(0), mock.Anything).Return(feedPosts(11), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(11), page.Posts)
+		mockPostStore.AssertNotCalled(t, "GetTimeline", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Replace", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("page past a full timeline falls back to the database", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, config)
+
+		cursor := &store.FeedCursor{CreatedAt: "2025-01-01T00:00:00.123456Z", ID: 8}
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor}
+		mockCacheStorage.timelines.On("Get", ctx, int64(1)).Return([]int64{9, 8, 7}, nil)
+		mockFollowerStore.On("GetPopularFollowed", ctx, int64(1), 2).Return(nil, nil)
+		mockPostStore.On("GetFeedByIDs", ctx, int64(1), []int64{9, 8, 7}, []int64(nil), int64(7), mock.Anything).Return(feedPosts(7), nil)
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.Anything).Return(feedPosts(7, 6, 5), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(7, 6), page.Posts)
+		mockPostStore.AssertExpectations(t)
+	})
+
+	t.Run("cursor older than a full timeline goes to the database", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, config)
+
+		cursor := &store.FeedCursor{CreatedAt: "2025-01-01T00:00:00.123456Z", ID: 5}
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor}
+		mockCacheStorage.timelines.On("Get", ctx, int64(1)).Return([]int64{9, 8, 7}, nil)
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.Anything).Return(feedPosts(4, 3, 2), nil)
+
+		// Execute
+		page, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, feedPosts(4, 3), page.Posts)
+		mockPostStore.AssertNotCalled(t, "GetFeedByIDs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("search skips the timeline", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, config)
+
+		query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Search: "go"}
+		mockPostStore.On("GetUserFeed", ctx, int64(1), mock.Anything).Return(feedPosts(3), nil)
+
+		// Execute
+		_, err := service.GetUserFeed(ctx, 1, query)
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPostService_GetTrendingTags(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counters in redis", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, PostServiceConfig{})
+
+		expected := []store.TagCount{{Tag: "go", Count: 3}}
+		mockCacheStorage.tags.On("Top", ctx, time.Hour, 10, mock.Anything).Return(expected, nil)
+
+		// Execute
+		tags, err := service.GetTrendingTags(ctx, time.Hour, 10)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, expected, tags)
+		mockPostStore.AssertNotCalled(t, "GetTrendingTags", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("falls back to postgres when the counters do not cover the window", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, PostServiceConfig{})
+
+		expected := []store.TagCount{{Tag: "go", Count: 5}}
+		mockCacheStorage.tags.On("Top", ctx, 7*24*time.Hour, 10, mock.Anything).Return(nil, errors.New("tag counters do not cover the window"))
+		mockPostStore.On("GetTrendingTags", ctx, mock.Anything, 10).Return(expected, nil)
+
+		// Execute
+		tags, err := service.GetTrendingTags(ctx, 7*24*time.Hour, 10)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, expected, tags)
+	})
+
+	t.Run("falls back to postgres", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+		mockPostStore.On("GetTrendingTags", ctx, mock.MatchedBy(func(since time.Time) bool {
+			return time.Since(since) >= 24*time.Hour
+		}), 10).Return(nil, nil)
+
+		// Execute
+		tags, err := service.GetTrendingTags(ctx, 24*time.Hour, 10)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Empty(t, tags)
+		assert.NotNil(t, tags)
+	})
+}
+
+func TestPostService_GetExploreFeed(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockPostStore := new(MockPostStore)
+	ranking := store.FeedRanking{RecencyWeight: 1, AffinityWeight: 1, TagsWeight: 1}
+	service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{Ranking: ranking})
+
+	query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Mode: store.FeedModeRanked}
+	mockPostStore.On("GetExploreFeed", ctx, int64(1), mock.Anything, store.FeedRanking{RecencyWeight: 1}).Return(feedPosts(3, 2, 1), nil)
+
+	// Execute
+	page, err := service.GetExploreFeed(ctx, 1, query)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 2)
+	assert.NotEmpty(t, page.NextCursor)
+}
+
+func TestPostService_GetUserPosts(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockPostStore := new(MockPostStore)
+	service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+	query := store.PaginatedFeedQuery{Limit: 2, Sort: "desc"}
+	fetch := query
+	fetch.Limit = 3
+	mockPostStore.On("GetUserPosts", ctx, int64(1), fetch).Return(feedPosts(3, 2, 1), nil)
+
+	// Execute
+	page, err := service.GetUserPosts(ctx, 1, query)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 2)
+	assert.NotEmpty(t, page.NextCursor)
+	mockPostStore.AssertExpectations(t)
+}
+
+func TestPostService_GetPostByID(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockPostStore := new(MockPostStore)
+	service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+	mockPostStore.On("IsVisible", ctx, int64(1), int64(3)).Return(false, nil)
+
+	// Execute
+	_, err := service.GetPostByID(ctx, 1, 3)
+
+	// Assert
+	assert.Equal(t, ErrPostNotFound, err)
+	mockPostStore.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+}
+
+func TestPostService_CreatePostVisibility(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("defaults to public and saves mentions", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore}, nil, PostServiceConfig{})
+
+		mockPostStore.On("Create", ctx, mock.MatchedBy(func(p *store.Post) bool {
+			return p.Visibility == store.VisibilityPublic && assert.ObjectsAreEqual([]string{"alice", "bob"}, p.Mentions)
+		})).Return(nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "hi @alice and @bob, mail me at me@example.com @alice", nil, nil, "")
+
+		// Assert
+		require.NoError(t, err)
+		mockPostStore.AssertExpectations(t)
+	})
+
+	t.Run("drafts are not pushed to timelines", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore}, mockCacheStorage, PostServiceConfig{})
+
+		mockPostStore.On("Create", ctx, mock.Anything).Return(nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", []string{"go"}, nil, store.VisibilityPrivate)
+
+		// Assert
+		require.NoError(t, err)
+		mockFollowerStore.AssertNotCalled(t, "GetFollowerIDs", mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStorage.tags.AssertNotCalled(t, "Increment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestPostService_UpdatePostVisibility(t *testing.T) {
+	ctx := context.Background()
+	config := PostServiceConfig{TimelineLength: 3, FanoutMaxFollowers: 2}
+
+	t.Run("published draft is pushed to timelines and trending tags", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockUserStore := new(MockUserStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Followers: mockFollowerStore, Users: mockUserStore}, mockCacheStorage, config)
+
+		post := &store.Post{ID: 10, UserID: 1, Tags: []string{"go"}, Visibility: store.VisibilityPrivate}
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1}, nil)
+		mockPostStore.On("GetByID", ctx, post.ID).Return(post, nil)
+		mockPostStore.On("Update", ctx, mock.Anything).Return(nil)
+		mockFollowerStore.On("GetFollowerIDs", ctx, int64(1), 3).Return([]int64{2}, nil)
+		mockCacheStorage.timelines.On("Push", ctx, []int64{2, 1}, int64(10), 3).Return(nil)
+		mockCacheStorage.tags.On("Increment", ctx, int64(10), []string{"go"}, mock.Anything).Return(nil)
+
+		visibility := store.VisibilityPublic
+
+		// Execute
+		_, err := service.UpdatePost(ctx, post.ID, PostUpdateRequest{Visibility: &visibility})
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertExpectations(t)
+		mockCacheStorage.tags.AssertExpectations(t)
+	})
+
+	t.Run("followers-only post made public only counts its tags", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockUserStore := new(MockUserStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore, Users: mockUserStore}, mockCacheStorage, config)
+
+		post := &store.Post{ID: 10, UserID: 1, Tags: []string{"go"}, Visibility: store.VisibilityFollowers}
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1}, nil)
+		mockPostStore.On("GetByID", ctx, post.ID).Return(post, nil)
+		mockPostStore.On("Update", ctx, mock.Anything).Return(nil)
+		mockCacheStorage.tags.On("Increment", ctx, int64(10), []string{"go"}, mock.Anything).Return(nil)
+
+		visibility := store.VisibilityPublic
+
+		// Execute
+		_, err := service.UpdatePost(ctx, post.ID, PostUpdateRequest{Visibility: &visibility})
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.tags.AssertExpectations(t)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("edits of a published post are not pushed again", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, config)
+
+		post := &store.Post{ID: 10, UserID: 1, Tags: []string{"go"}, Visibility: store.VisibilityPublic}
+		mockPostStore.On("GetByID", ctx, post.ID).Return(post, nil)
+		mockPostStore.On("Update", ctx, mock.Anything).Return(nil)
+
+		title := "new title"
+
+		// Execute
+		_, err := service.UpdatePost(ctx, post.ID, PostUpdateRequest{Title: &title})
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStorage.tags.AssertNotCalled(t, "Increment", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockCacheStorage.tags.AssertNotCalled(t, "Decrement", mock.Anything, mock.Anything)
+	})
+
+	t.Run("public post made followers-only leaves trending tags", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, config)
+
+		post := &store.Post{ID: 10, UserID: 1, Tags: []string{"go"}, Visibility: store.VisibilityPublic}
+		mockPostStore.On("GetByID", ctx, post.ID).Return(post, nil)
+		mockPostStore.On("Update", ctx, mock.Anything).Return(nil)
+		mockCacheStorage.tags.On("Decrement", ctx, int64(10)).Return(nil)
+
+		visibility := store.VisibilityFollowers
+
+		// Execute
+		_, err := service.UpdatePost(ctx, post.ID, PostUpdateRequest{Visibility: &visibility})
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.tags.AssertExpectations(t)
+	})
+}
+
+func TestPostService_DeletePost(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockPostStore := new(MockPostStore)
+	mockCacheStorage := NewMockCacheStorage()
+	service := NewPostService(store.Storage{Posts: mockPostStore}, mockCacheStorage, PostServiceConfig{})
+
+	mockPostStore.On("Delete", ctx, int64(10)).Return(nil)
+	mockCacheStorage.tags.On("Decrement", ctx, int64(10)).Return(nil)
+
+	// Execute
+	err := service.DeletePost(ctx, 10)
+
+	// Assert
+	require.NoError(t, err)
+	mockCacheStorage.tags.AssertExpectations(t)
+}
+
+func TestPostService_CreatePostMedia(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("attaches media of the author", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockMediaStore := new(MockMediaStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Media: mockMediaStore}, nil, PostServiceConfig{})
+
+		mediaIDs := []string{"m1", "m2"}
+		mockMediaStore.On("GetByIDs", ctx, mediaIDs).Return([]store.Media{{ID: "m1", UserID: 1}, {ID: "m2", UserID: 1}}, nil)
+		mockPostStore.On("Create", ctx, mock.MatchedBy(func(p *store.Post) bool {
+			return assert.ObjectsAreEqual(mediaIDs, p.MediaIDs)
+		})).Return(nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", nil, mediaIDs, "")
+
+		// Assert
+		require.NoError(t, err)
+		mockPostStore.AssertExpectations(t)
+	})
+
+	t.Run("rejects media of other users and unknown media", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockMediaStore := new(MockMediaStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Media: mockMediaStore}, nil, PostServiceConfig{})
+
+		mediaIDs := []string{"m1", "m2", "m3"}
+		mockMediaStore.On("GetByIDs", ctx, mediaIDs).Return([]store.Media{{ID: "m1", UserID: 1}, {ID: "m2", UserID: 2}}, nil)
+
+		// Execute
+		_, err := service.CreatePost(ctx, 1, "title", "content", nil, mediaIDs, "")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		mockPostStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPostService_Comments(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("comments on a post the user may see", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore}, nil, PostServiceConfig{SearchLanguage: "simple"})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("Create", ctx, mock.MatchedBy(func(c *store.Comment) bool {
+			return c.PostID == 1 && c.UserID == 2 && c.Content == "nice" && c.Language == "simple"
+		})).Return(nil)
+
+		// Execute
+		comment, err := service.CreateComment(ctx, 1, 2, 0, "nice")
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "nice", comment.Content)
+		mockCommentStore.AssertExpectations(t)
+	})
+
+	t.Run("posts the user may not see are not found", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore}, nil, PostServiceConfig{})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(false, nil)
+
+		// Execute
+		_, err := service.CreateComment(ctx, 1, 2, 0, "nice")
+
+		// Assert
+		assert.Equal(t, ErrPostNotFound, err)
+		mockCommentStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("replies below the maximum depth", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		mockBlockStore := new(MockBlockStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore, Blocks: mockBlockStore}, nil, PostServiceConfig{MaxCommentDepth: 2})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(2)).Return(&store.Comment{ID: 3, PostID: 1, UserID: 4, Depth: 1}, nil)
+		mockBlockStore.On("IsBlocked", ctx, int64(2), int64(4)).Return(false, nil)
+		mockCommentStore.On("Create", ctx, mock.MatchedBy(func(c *store.Comment) bool {
+			return c.ParentID != nil && *c.ParentID == 3 && c.Depth == 2
+		})).Return(nil)
+
+		// Execute
+		_, err := service.CreateComment(ctx, 1, 2, 3, "nice")
+
+		// Assert
+		require.NoError(t, err)
+		mockCommentStore.AssertExpectations(t)
+	})
+
+	t.Run("replies beyond the maximum depth are rejected", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		mockBlockStore := new(MockBlockStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore, Blocks: mockBlockStore}, nil, PostServiceConfig{MaxCommentDepth: 2})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(2)).Return(&store.Comment{ID: 3, PostID: 1, UserID: 4, Depth: 2}, nil)
+		mockBlockStore.On("IsBlocked", ctx, int64(2), int64(4)).Return(false, nil)
+
+		// Execute
+		_, err := service.CreateComment(ctx, 1, 2, 3, "nice")
+
+		// Assert
+		assert.Equal(t, ErrCommentTooDeep, err)
+		mockCommentStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("comments of blocked users cannot be replied to", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		mockBlockStore := new(MockBlockStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore, Blocks: mockBlockStore}, nil, PostServiceConfig{MaxCommentDepth: 2})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(2)).Return(&store.Comment{ID: 3, PostID: 1, UserID: 4}, nil)
+		mockBlockStore.On("IsBlocked", ctx, int64(2), int64(4)).Return(true, nil)
+
+		// Execute
+		_, err := service.CreateComment(ctx, 1, 2, 3, "nice")
+
+		// Assert
+		assert.Equal(t, ErrInvalidParentComment, err)
+		mockCommentStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("deleted comments cannot be replied to", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		mockBlockStore := new(MockBlockStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore, Blocks: mockBlockStore}, nil, PostServiceConfig{MaxCommentDepth: 2})
+
+		deletedAt := "2025-01-01T00:00:00Z"
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(2)).Return(&store.Comment{ID: 3, PostID: 1, UserID: 4, DeletedAt: &deletedAt}, nil)
+		mockBlockStore.On("IsBlocked", ctx, int64(2), int64(4)).Return(false, nil)
+
+		// Execute
+		_, err := service.CreateComment(ctx, 1, 2, 3, "nice")
+
+		// Assert
+		assert.Equal(t, ErrInvalidParentComment, err)
+		mockCommentStore.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("comments of other posts are not found", func(t *testing.T) {
+		// Setup
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Comments: mockCommentStore}, nil, PostServiceConfig{})
+
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(0)).Return(&store.Comment{ID: 3, PostID: 9}, nil)
+
+		// Execute
+		err := service.DeleteComment(ctx, 1, 3)
+
+		// Assert
+		assert.Equal(t, ErrCommentNotFound, err)
+		mockCommentStore.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPostService_GetComments(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("pages with one extra comment", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore}, nil, PostServiceConfig{})
+
+		query := store.CommentListQuery{Limit: 2, Sort: store.CommentSortNewest}
+		comments := []store.Comment{
+			{ID: 3, CreatedAt: "2025-01-03T00:00:00Z"},
+			{ID: 2, CreatedAt: "2025-01-02T00:00:00Z"},
+			{ID: 1, CreatedAt: "2025-01-01T00:00:00Z"},
+		}
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("List", ctx, int64(1), int64(2), store.CommentListQuery{Limit: 3, Sort: store.CommentSortNewest}).Return(comments, nil)
+
+		// Execute
+		page, err := service.GetComments(ctx, 1, 2, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, page.Comments, 2)
+		cursor, err := store.DecodeFeedCursor(page.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), cursor.ID)
+	})
+
+	t.Run("top comments page by offset", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore}, nil, PostServiceConfig{})
+
+		query := store.CommentListQuery{Limit: 1, Sort: store.CommentSortTop, Offset: 4}
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("List", ctx, int64(1), int64(2), mock.Anything).Return([]store.Comment{{ID: 5}, {ID: 6}}, nil)
+
+		// Execute
+		page, err := service.GetComments(ctx, 1, 2, query)
+
+		// Assert
+		require.NoError(t, err)
+		cursor, err := store.DecodeFeedCursor(page.NextCursor)
+		require.NoError(t, err)
+		require.NotNil(t, cursor.Offset)
+		assert.Equal(t, 5, *cursor.Offset)
+	})
+
+	t.Run("replies to comments of other posts are not found", func(t *testing.T) {
+		// Setup
+		mockPostStore := new(MockPostStore)
+		mockCommentStore := new(MockCommentStore)
+		service := NewPostService(store.Storage{Posts: mockPostStore, Comments: mockCommentStore}, nil, PostServiceConfig{})
+
+		mockPostStore.On("IsVisible", ctx, int64(1), int64(2)).Return(true, nil)
+		mockCommentStore.On("GetByID", ctx, int64(3), int64(2)).Return(&store.Comment{ID: 3, PostID: 9}, nil)
+
+		// Execute
+		_, err := service.GetComments(ctx, 1, 2, store.CommentListQuery{Limit: 20, Sort: store.CommentSortNewest, ParentID: 3})
+
+		// Assert
+		assert.Equal(t, ErrCommentNotFound, err)
+		mockCommentStore.AssertNotCalled(t, "List", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/n-korel/social-api/internal/store"
+)
+
+// SearchResults holds the matches of each searched type, best first. Types that were not
+// searched are empty.
+type SearchResults struct {
+	Posts    []store.PostSearchResult    `json:"posts"`
+	Comments []store.CommentSearchResult `json:"comments"`
+	Users    []store.UserSearchResult    `json:"users"`
+}
+
+type SearchService struct {
+	store  store.Storage
+	config SearchServiceConfig
+}
+
+type SearchServiceConfig struct {
+	// Text search configuration queries are parsed with, english when empty
+	Language string
+}
+
+type SearchServiceInterface interface {
+	Search(ctx context.Context, query store.SearchQuery) (*SearchResults, error)
+}
+
+func NewSearchService(store store.Storage, config SearchServiceConfig) *SearchService {
+	if config.Language == "" {
+		config.Language = "english"
+	}
+
+	return &SearchService{
+		store:  store,
+		config: config,
+	}
+}
+
+func (s *SearchService) Search(ctx context.Context, query store.SearchQuery) (*SearchResults, error) {
+	query.Language = s.config.Language
+
+	results := &SearchResults{
+		Posts:    []store.PostSearchResult{},
+		Comments: []store.CommentSearchResult{},
+		Users:    []store.UserSearchResult{},
+	}
+
+	if slices.Contains(query.Types, store.SearchTypePosts) {
+		posts, err := s.store.Search.SearchPosts(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search posts: %w", err)
+		}
+		results.Posts = posts
+	}
+
+	if slices.Contains(query.Types, store.SearchTypeComments) {
+		comments, err := s.store.Search.SearchComments(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search comments: %w", err)
+		}
+		results.Comments = comments
+	}
+
+	if slices.Contains(query.Types, store.SearchTypeUsers) {
+		users, err := s.store.Search.SearchUsers(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search users: %w", err)
+		}
+		results.Users = users
+	}
+
+	return results, nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockSearchStore struct {
+	mock.Mock
+}
+
+func (m *MockSearchStore) SearchPosts(ctx context.Context, query store.SearchQuery) ([]store.PostSearchResult, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.PostSearchResult), args.Error(1)
+}
+
+func (m *MockSearchStore) SearchComments(ctx context.Context, query store.SearchQuery) ([]store.CommentSearchResult, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.CommentSearchResult), args.Error(1)
+}
+
+func (m *MockSearchStore) SearchUsers(ctx context.Context, query store.SearchQuery) ([]store.UserSearchResult, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.UserSearchResult), args.Error(1)
+}
+
+func TestSearchService_Search(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("searches only the requested types with the configured language", func(t *testing.T) {
+		// Setup
+		mockSearchStore := new(MockSearchStore)
+		service := NewSearchService(store.Storage{Search: mockSearchStore}, SearchServiceConfig{Language: "russian"})
+
+		query := store.SearchQuery{Query: "go", Types: []string{store.SearchTypePosts, store.SearchTypeUsers}, Limit: 10}
+		expected := query
+		expected.Language = "russian"
+
+		mockSearchStore.On("SearchPosts", ctx, expected).Return([]store.PostSearchResult{{Rank: 0.5}}, nil)
+		mockSearchStore.On("SearchUsers", ctx, expected).Return([]store.UserSearchResult{{ID: 1, Username: "gopher"}}, nil)
+
+		// Execute
+		results, err := service.Search(ctx, query)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, results.Posts, 1)
+		assert.Len(t, results.Users, 1)
+		assert.NotNil(t, results.Comments)
+		assert.Empty(t, results.Comments)
+		mockSearchStore.AssertExpectations(t)
+		mockSearchStore.AssertNotCalled(t, "SearchComments", mock.Anything, mock.Anything)
+	})
+
+	t.Run("defaults to english", func(t *testing.T) {
+		// Setup
+		mockSearchStore := new(MockSearchStore)
+		service := NewSearchService(store.Storage{Search: mockSearchStore}, SearchServiceConfig{})
+
+		mockSearchStore.On("SearchComments", ctx, mock.MatchedBy(func(q store.SearchQuery) bool {
+			return q.Language == "english"
+		})).Return([]store.CommentSearchResult{}, nil)
+
+		// Execute
+		_, err := service.Search(ctx, store.SearchQuery{Query: "go", Types: []string{store.SearchTypeComments}})
+
+		// Assert
+		require.NoError(t, err)
+		mockSearchStore.AssertExpectations(t)
+	})
+
+	t.Run("returns store errors", func(t *testing.T) {
+		// Setup
+		mockSearchStore := new(MockSearchStore)
+		service := NewSearchService(store.Storage{Search: mockSearchStore}, SearchServiceConfig{})
+
+		mockSearchStore.On("SearchPosts", ctx, mock.Anything).Return(nil, errors.New("db down"))
+
+		// Execute
+		results, err := service.Search(ctx, store.SearchQuery{Query: "go", Types: []string{store.SearchTypePosts}})
+
+		// Assert
+		require.Error(t, err)
+		assert.Nil(t, results)
+	})
+}
@@ -1,15 +1,23 @@
 package service
 
 import (
+	"context"
+	"errors"
+
 	"github.com/n-korel/social-api/internal/auth"
 	"github.com/n-korel/social-api/internal/mailer"
+	"github.com/n-korel/social-api/internal/media"
 	"github.com/n-korel/social-api/internal/store"
 )
 
 type Services struct {
-	Users UserServiceInterface
-	Posts PostServiceInterface
-	Auth  AuthServiceInterface
+	Users     UserServiceInterface
+	Posts     PostServiceInterface
+	Auth      AuthServiceInterface
+	APITokens APITokenServiceInterface
+	OIDC      OIDCServiceInterface
+	Search    SearchServiceInterface
+	Media     MediaServiceInterface
 }
 
 func NewServices(
@@ -17,12 +25,30 @@ func NewServices(
 	cache CacheStorage,
 	mailer mailer.Client,
 	authenticator auth.Authenticator,
+	loginGuard LoginGuard,
+	oidcProviders map[string]OIDCProvider,
+	blobs media.BlobStore,
 	userConfig UserServiceConfig,
+	postConfig PostServiceConfig,
 	authConfig AuthServiceConfig,
+	oidcConfig OIDCServiceConfig,
+	searchConfig SearchServiceConfig,
+	mediaConfig MediaServiceConfig,
 ) *Services {
+	authService := NewAuthService(store, cache, mailer, authenticator, loginGuard, authConfig)
+
 	return &Services{
-		Users: NewUserService(store, cache, mailer, userConfig),
-		Posts: NewPostService(store),
-		Auth:  NewAuthService(store, authenticator, authConfig),
+		Users:     NewUserService(store, cache, mailer, userConfig),
+		Posts:     NewPostService(store, cache, postConfig),
+		Auth:      authService,
+		APITokens: NewAPITokenService(store),
+		OIDC:      NewOIDCService(store, authService, oidcProviders, oidcConfig),
+		Search:    NewSearchService(store, searchConfig),
+		Media:     NewMediaService(store, cache, blobs, mediaConfig),
 	}
 }
+
+// Shutdown waits for the work the services still run after their requests, until ctx is done
+func (s *Services) Shutdown(ctx context.Context) error {
+	return errors.Join(s.Auth.Shutdown(ctx), s.Users.Shutdown(ctx))
+}
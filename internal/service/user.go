@@ -2,45 +2,109 @@ package service
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/n-korel/social-api/internal/mailer"
 	"github.com/n-korel/social-api/internal/store"
+	"go.uber.org/zap"
 )
 
 var (
-	ErrUserNotFound           = errors.New("user not found")
-	ErrEmailAlreadyExists     = errors.New("email already exists")
-	ErrUsernameAlreadyExists  = errors.New("username already exists")
-	ErrInvalidActivationToken = errors.New("invalid or expired activation token")
-	ErrCannotFollowSelf       = errors.New("cannot follow yourself")
-	ErrAlreadyFollowing       = errors.New("already following this user")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrEmailAlreadyExists      = errors.New("email already exists")
+	ErrUsernameAlreadyExists   = errors.New("username already exists")
+	ErrInvalidActivationToken  = errors.New("invalid or expired activation token")
+	ErrCannotFollowSelf        = errors.New("cannot follow yourself")
+	ErrAlreadyFollowing        = errors.New("already following this user")
+	ErrUsernameChangeCooldown  = errors.New("username was changed recently")
+	ErrEmailUnchanged          = errors.New("new email is the current email")
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+	ErrCannotBlockSelf         = errors.New("cannot block or mute yourself")
+	ErrFollowRequestNotFound   = errors.New("follow request not found")
+	ErrUserBlocked             = errors.New("user is blocked")
 )
 
+// UsernameChangeCooldownError tells how long the user has to wait before changing their username again
+type UsernameChangeCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UsernameChangeCooldownError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrUsernameChangeCooldown, e.RetryAfter)
+}
+
+func (e *UsernameChangeCooldownError) Unwrap() error {
+	return ErrUsernameChangeCooldown
+}
+
+// ProfileUpdateRequest holds the profile fields to change, nil fields are kept
+type ProfileUpdateRequest struct {
+	Username    *string
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+	AvatarURL   *string
+	// ID of the uploaded image behind AvatarURL, cleared when AvatarURL is set without it
+	AvatarMediaID *string
+	IsPrivate     *bool
+}
+
+// FollowPage is a page of a followers or following list
+type FollowPage struct {
+	Users      []store.FollowEntry
+	NextCursor string
+}
+
 type UserService struct {
 	store  store.Storage
 	cache  CacheStorage
 	mailer mailer.Client
 	config UserServiceConfig
+	// Work finishing after the request, like resent invitations
+	background *backgroundTasks
 }
 
 type UserServiceConfig struct {
 	FrontendURL     string
 	MailExpiration  time.Duration
 	IsProductionEnv bool
+	// Never activated accounts older than this are purged once their invitation expired
+	UnactivatedUserGracePeriod time.Duration
+	// Minimum time between two username changes
+	UsernameChangeCooldown time.Duration
+	EmailChangeExpiration  time.Duration
+	// Logger reports failures that do not fail the request, they are discarded when nil
+	Logger *zap.SugaredLogger
 }
 
 type UserServiceInterface interface {
 	RegisterUser(ctx context.Context, username, email, password string) (*store.User, string, error)
 	GetUserByID(ctx context.Context, userID int64, useCache bool) (*store.User, error)
 	ActivateUser(ctx context.Context, token string) error
-	FollowUser(ctx context.Context, followerID, followedID int64) error
+	ResendActivation(ctx context.Context, email string) error
+	CleanupInvitations(ctx context.Context) (invitations int64, users int64, err error)
+	FollowUser(ctx context.Context, followerID, followedID int64) (requested bool, err error)
 	UnfollowUser(ctx context.Context, followerID, followedID int64) error
+	GetFollowers(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error)
+	GetFollowing(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error)
+	GetFollowStats(ctx context.Context, userID, viewerID int64) (*store.FollowStats, error)
+	GetFollowRequests(ctx context.Context, userID int64, query store.FollowListQuery) (*FollowPage, error)
+	AcceptFollowRequest(ctx context.Context, userID, requesterID int64) error
+	RejectFollowRequest(ctx context.Context, userID, requesterID int64) error
+	BlockUser(ctx context.Context, blockerID, blockedID int64) error
+	UnblockUser(ctx context.Context, blockerID, blockedID int64) error
+	MuteUser(ctx context.Context, muterID, mutedID int64) error
+	UnmuteUser(ctx context.Context, muterID, mutedID int64) error
+	HasRole(ctx context.Context, user *store.User, role string) (bool, error)
+	UpdateProfile(ctx context.Context, userID int64, updates ProfileUpdateRequest) (*store.User, error)
+	RequestEmailChange(ctx context.Context, userID int64, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	Shutdown(ctx context.Context) error
 }
 
 type UserCache interface {
@@ -51,17 +115,31 @@ type UserCache interface {
 
 type CacheStorage interface {
 	Users() UserCache
+	RevokedTokens() TokenRevocationList
+	Timelines() TimelineCache
+	Tags() TagCounter
 }
 
 func NewUserService(store store.Storage, cache CacheStorage, mailer mailer.Client, config UserServiceConfig) *UserService {
+	if config.Logger == nil {
+		config.Logger = zap.NewNop().Sugar()
+	}
+
 	return &UserService{
-		store:  store,
-		cache:  cache,
-		mailer: mailer,
-		config: config,
+		store:      store,
+		cache:      cache,
+		mailer:     mailer,
+		config:     config,
+		background: newBackgroundTasks(backgroundTaskLimit),
 	}
 }
 
+// Shutdown waits for the work still running after its request, like resent invitations,
+// until ctx is done
+func (s *UserService) Shutdown(ctx context.Context) error {
+	return s.background.Wait(ctx)
+}
+
 func (s *UserService) RegisterUser(ctx context.Context, username, email, password string) (*store.User, string, error) {
 	user := &store.User{
 		Username: username,
@@ -78,11 +156,9 @@ func (s *UserService) RegisterUser(ctx context.Context, username, email, passwor
 
 	// Hash token for storage but keep plain token for email
 	plainToken := uuid.New().String()
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
 
 	// Store user with invitation
-	err := s.store.Users.CreateAndInvite(ctx, user, hashToken, s.config.MailExpiration)
+	err := s.store.Users.CreateAndInvite(ctx, user, hashToken(plainToken), s.config.MailExpiration)
 	if err != nil {
 		return nil, "", s.handleUserCreationError(err)
 	}
@@ -110,6 +186,56 @@ func (s *UserService) ActivateUser(ctx context.Context, token string) error {
 	return nil
 }
 
+// ResendActivation issues a fresh invitation for an inactive account. Unknown or already active
+// emails are silently ignored, and the invitation is created and sent after returning, so neither
+// the result nor the response time tells the caller which accounts wait for activation.
+func (s *UserService) ResendActivation(ctx context.Context, email string) error {
+	// The request is done before the email is sent
+	ctx = context.WithoutCancel(ctx)
+
+	s.background.Go(func() {
+		if err := s.reinvite(ctx, email); err != nil {
+			s.config.Logger.Errorw("failed to resend activation", "error", err)
+		}
+	})
+
+	return nil
+}
+
+func (s *UserService) reinvite(ctx context.Context, email string) error {
+	// Hash token for storage but keep plain token for email
+	plainToken := uuid.New().String()
+
+	user, err := s.store.Users.Reinvite(ctx, email, hashToken(plainToken), s.config.MailExpiration)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	if err := s.sendActivationEmail(user, plainToken); err != nil {
+		return fmt.Errorf("failed to send activation email: %w", err)
+	}
+
+	return nil
+}
+
+// CleanupInvitations purges expired invitations and accounts that were never activated
+func (s *UserService) CleanupInvitations(ctx context.Context) (int64, int64, error) {
+	invitations, err := s.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete expired invitations: %w", err)
+	}
+
+	users, err := s.store.Users.DeleteUnactivated(ctx, time.Now().Add(-s.config.UnactivatedUserGracePeriod))
+	if err != nil {
+		return invitations, 0, fmt.Errorf("failed to delete unactivated users: %w", err)
+	}
+
+	return invitations, users, nil
+}
+
 func (s *UserService) GetUserByID(ctx context.Context, userID int64, useCache bool) (*store.User, error) {
 	if !useCache || s.cache == nil {
 		return s.getUserFromDB(ctx, userID)
@@ -136,41 +262,383 @@ func (s *UserService) GetUserByID(ctx context.Context, userID int64, useCache bo
 	return user, nil
 }
 
-func (s *UserService) FollowUser(ctx context.Context, followerID, followedID int64) error {
+// FollowUser follows followedID. Following a private user only sends a follow request, which
+// is reported by requested.
+func (s *UserService) FollowUser(ctx context.Context, followerID, followedID int64) (requested bool, err error) {
 	// Validate that follower user exist
 	if _, err := s.getUserFromDB(ctx, followerID); err != nil {
-		return fmt.Errorf("follower not found: %w", err)
+		return false, fmt.Errorf("follower not found: %w", err)
 	}
 
 	// Validate that followed user exist
-	if _, err := s.getUserFromDB(ctx, followedID); err != nil {
-		return fmt.Errorf("followed user not found: %w", err)
+	followed, err := s.getUserFromDB(ctx, followedID)
+	if err != nil {
+		return false, fmt.Errorf("followed user not found: %w", err)
 	}
 
 	// Self-following
 	if followerID == followedID {
-		return ErrCannotFollowSelf
+		return false, ErrCannotFollowSelf
+	}
+
+	if err := s.checkNotBlocked(ctx, followerID, followedID); err != nil {
+		return false, err
+	}
+
+	if followed.IsPrivate {
+		if err := s.store.Followers.Request(ctx, followerID, followedID); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				return false, ErrAlreadyFollowing
+			}
+			return false, fmt.Errorf("failed to request follow: %w", err)
+		}
+
+		return true, nil
 	}
 
-	err := s.store.Followers.Follow(ctx, followerID, followedID)
+	err = s.store.Followers.Follow(ctx, followerID, followedID)
 	if err != nil {
 		if errors.Is(err, store.ErrConflict) {
-			return ErrAlreadyFollowing
+			return false, ErrAlreadyFollowing
 		}
-		return fmt.Errorf("failed to follow user: %w", err)
+		return false, fmt.Errorf("failed to follow user: %w", err)
 	}
 
-	return nil
+	s.invalidateTimeline(ctx, followerID)
+
+	return false, nil
 }
 
+// UnfollowUser unfollows followedID and withdraws a pending follow request
 func (s *UserService) UnfollowUser(ctx context.Context, followerID, followedID int64) error {
 	err := s.store.Followers.Unfollow(ctx, followerID, followedID)
 	if err != nil {
 		return fmt.Errorf("failed to unfollow user: %w", err)
 	}
+
+	err = s.store.Followers.DeleteRequest(ctx, followedID, followerID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to withdraw follow request: %w", err)
+	}
+
+	s.invalidateTimeline(ctx, followerID)
+
 	return nil
 }
 
+// BlockUser separates the users both ways: their follows are removed, they cannot follow each
+// other again and their posts and comments are hidden from each other
+func (s *UserService) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	if _, err := s.getUserFromDB(ctx, blockedID); err != nil {
+		return err
+	}
+
+	if err := s.store.Blocks.Block(ctx, blockerID, blockedID); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	// Both timelines were built from the removed follows
+	s.invalidateTimeline(ctx, blockerID)
+	s.invalidateTimeline(ctx, blockedID)
+
+	return nil
+}
+
+// UnblockUser lifts a block of blockerID, follows removed by the block are not restored
+func (s *UserService) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	if err := s.store.Blocks.Unblock(ctx, blockerID, blockedID); err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	return nil
+}
+
+// MuteUser hides the posts of mutedID from the home feed of muterID. The muted user is not told
+// and can still follow and comment.
+func (s *UserService) MuteUser(ctx context.Context, muterID, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrCannotBlockSelf
+	}
+
+	if _, err := s.getUserFromDB(ctx, mutedID); err != nil {
+		return err
+	}
+
+	if err := s.store.Blocks.Mute(ctx, muterID, mutedID); err != nil {
+		return fmt.Errorf("failed to mute user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserService) UnmuteUser(ctx context.Context, muterID, mutedID int64) error {
+	if err := s.store.Blocks.Unmute(ctx, muterID, mutedID); err != nil {
+		return fmt.Errorf("failed to unmute user: %w", err)
+	}
+
+	return nil
+}
+
+// checkNotBlocked returns ErrUserBlocked when either user has blocked the other
+func (s *UserService) checkNotBlocked(ctx context.Context, userID, otherID int64) error {
+	blocked, err := s.store.Blocks.IsBlocked(ctx, userID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to check block: %w", err)
+	}
+
+	if blocked {
+		return ErrUserBlocked
+	}
+
+	return nil
+}
+
+// GetFollowers returns a page of the users following userID, newest follows first
+func (s *UserService) GetFollowers(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error) {
+	if _, err := s.GetUserByID(ctx, userID, true); err != nil {
+		return nil, err
+	}
+
+	fetch := query
+	fetch.Limit++
+
+	users, err := s.store.Followers.GetFollowers(ctx, userID, viewerID, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get followers: %w", err)
+	}
+
+	return newFollowPage(users, query.Limit), nil
+}
+
+// GetFollowing returns a page of the users userID follows, newest follows first
+func (s *UserService) GetFollowing(ctx context.Context, userID, viewerID int64, query store.FollowListQuery) (*FollowPage, error) {
+	if _, err := s.GetUserByID(ctx, userID, true); err != nil {
+		return nil, err
+	}
+
+	fetch := query
+	fetch.Limit++
+
+	users, err := s.store.Followers.GetFollowing(ctx, userID, viewerID, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get following: %w", err)
+	}
+
+	return newFollowPage(users, query.Limit), nil
+}
+
+// GetFollowStats counts the followers and follows of userID. The counts are not cached, so they
+// are current right after a follow.
+func (s *UserService) GetFollowStats(ctx context.Context, userID, viewerID int64) (*store.FollowStats, error) {
+	stats, err := s.store.Followers.GetStats(ctx, userID, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get follow stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetFollowRequests returns a page of the users waiting for userID to approve them, newest first
+func (s *UserService) GetFollowRequests(ctx context.Context, userID int64, query store.FollowListQuery) (*FollowPage, error) {
+	fetch := query
+	fetch.Limit++
+
+	users, err := s.store.Followers.GetRequests(ctx, userID, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get follow requests: %w", err)
+	}
+
+	return newFollowPage(users, query.Limit), nil
+}
+
+// AcceptFollowRequest makes requesterID a follower of userID
+func (s *UserService) AcceptFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	if err := s.store.Followers.AcceptRequest(ctx, userID, requesterID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrFollowRequestNotFound
+		}
+		return fmt.Errorf("failed to accept follow request: %w", err)
+	}
+
+	s.invalidateTimeline(ctx, requesterID)
+
+	return nil
+}
+
+// RejectFollowRequest drops the request, requesterID may ask again
+func (s *UserService) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	if err := s.store.Followers.DeleteRequest(ctx, userID, requesterID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrFollowRequestNotFound
+		}
+		return fmt.Errorf("failed to reject follow request: %w", err)
+	}
+
+	return nil
+}
+
+// newFollowPage trims users fetched with a limit one above limit, the extra user tells
+// whether there is a next page
+func newFollowPage(users []store.FollowEntry, limit int) *FollowPage {
+	page := &FollowPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = store.FeedCursor{CreatedAt: last.FollowedAt, ID: last.ID}.Encode()
+	}
+
+	return page
+}
+
+// UpdateProfile changes the username and profile of the user. Usernames can be changed
+// once per UsernameChangeCooldown. Pending follow requests are accepted when the account
+// is made public.
+func (s *UserService) UpdateProfile(ctx context.Context, userID int64, updates ProfileUpdateRequest) (*store.User, error) {
+	user, err := s.getUserFromDB(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updates.Username != nil && *updates.Username != user.Username {
+		now := time.Now()
+		if user.UsernameChangedAt != nil {
+			if wait := user.UsernameChangedAt.Add(s.config.UsernameChangeCooldown).Sub(now); wait > 0 {
+				return nil, &UsernameChangeCooldownError{RetryAfter: wait}
+			}
+		}
+
+		user.Username = *updates.Username
+		user.UsernameChangedAt = &now
+	}
+	if updates.DisplayName != nil {
+		user.DisplayName = *updates.DisplayName
+	}
+	if updates.Bio != nil {
+		user.Bio = *updates.Bio
+	}
+	if updates.Location != nil {
+		user.Location = *updates.Location
+	}
+	if updates.Website != nil {
+		user.Website = *updates.Website
+	}
+	if updates.AvatarURL != nil {
+		user.AvatarURL = *updates.AvatarURL
+		user.AvatarMediaID = updates.AvatarMediaID
+	}
+	madePublic := false
+	if updates.IsPrivate != nil {
+		madePublic = user.IsPrivate && !*updates.IsPrivate
+		user.IsPrivate = *updates.IsPrivate
+	}
+
+	if err := s.store.Users.UpdateProfile(ctx, user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername):
+			return nil, ErrUsernameAlreadyExists
+		case errors.Is(err, store.ErrNotFound):
+			return nil, ErrUserNotFound
+		default:
+			return nil, fmt.Errorf("failed to update profile: %w", err)
+		}
+	}
+
+	s.invalidateUser(ctx, userID)
+
+	if madePublic {
+		followers, err := s.store.Followers.AcceptAllRequests(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to accept follow requests: %w", err)
+		}
+
+		for _, id := range followers {
+			s.invalidateTimeline(ctx, id)
+		}
+	}
+
+	return user, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new address. The email is only
+// switched once the link is followed.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID int64, newEmail string) error {
+	user, err := s.getUserFromDB(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailUnchanged
+	}
+
+	if _, err := s.store.Users.GetByEmail(ctx, newEmail); err == nil {
+		return ErrEmailAlreadyExists
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Hash token for storage but keep plain token for email
+	plainToken := uuid.New().String()
+
+	err = s.store.Users.CreateEmailChange(ctx, userID, newEmail, hashToken(plainToken), s.config.EmailChangeExpiration)
+	if err != nil {
+		return fmt.Errorf("failed to create email change: %w", err)
+	}
+
+	if err := s.sendEmailChangeEmail(user, newEmail, plainToken); err != nil {
+		return fmt.Errorf("failed to send email change email: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the user's email to the address the token was sent to
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token string) error {
+	userID, err := s.store.Users.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return ErrInvalidEmailChangeToken
+		case errors.Is(err, store.ErrDuplicateEmail):
+			return ErrEmailAlreadyExists
+		default:
+			return fmt.Errorf("failed to confirm email change: %w", err)
+		}
+	}
+
+	s.invalidateUser(ctx, userID)
+
+	return nil
+}
+
+// invalidateUser drops the cached user, so the next read sees the update
+func (s *UserService) invalidateUser(ctx context.Context, userID int64) {
+	if s.cache != nil {
+		s.cache.Users().Delete(ctx, userID)
+	}
+}
+
+// invalidateTimeline drops the cached home timeline, so it is rebuilt with the new follows on the next read
+func (s *UserService) invalidateTimeline(ctx context.Context, userID int64) {
+	if s.cache != nil {
+		s.cache.Timelines().Delete(ctx, userID)
+	}
+}
+
+// HasRole reports whether the user's role is at least as privileged as role
+func (s *UserService) HasRole(ctx context.Context, user *store.User, role string) (bool, error) {
+	required, err := s.store.Roles.GetByName(ctx, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return user.Role.Level >= required.Level, nil
+}
+
 func (s *UserService) getUserFromDB(ctx context.Context, userID int64) (*store.User, error) {
 	user, err := s.store.Users.GetByID(ctx, userID)
 	if err != nil {
@@ -204,6 +672,30 @@ func (s *UserService) sendActivationEmail(user *store.User, token string) error
 	return err
 }
 
+func (s *UserService) sendEmailChangeEmail(user *store.User, newEmail, token string) error {
+	confirmURL := fmt.Sprintf("%s/confirm-email/%s", s.config.FrontendURL, token)
+
+	vars := struct {
+		Username   string
+		ConfirmURL string
+		ExpiresIn  string
+	}{
+		Username:   user.Username,
+		ConfirmURL: confirmURL,
+		ExpiresIn:  s.config.EmailChangeExpiration.String(),
+	}
+
+	_, err := s.mailer.Send(
+		mailer.EmailChangeTemplate,
+		user.Username,
+		newEmail,
+		vars,
+		!s.config.IsProductionEnv,
+	)
+
+	return err
+}
+
 func (s *UserService) handleUserCreationError(err error) error {
 	switch err {
 	case store.ErrDuplicateEmail:
@@ -10,6 +10,7 @@ import (
 	"github.com/n-korel/social-api/internal/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockUserStore struct {
@@ -52,6 +53,83 @@ func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 	return args.Error(0)
 }
 
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	args := m.Called(ctx, userID, token, exp)
+	return args.Error(0)
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, user *store.User) error {
+	args := m.Called(ctx, token, user)
+	return args.Error(0)
+}
+
+func (m *MockUserStore) Reinvite(ctx context.Context, email, token string, exp time.Duration) (*store.User, error) {
+	args := m.Called(ctx, email, token, exp)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.User), args.Error(1)
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserStore) DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error) {
+	args := m.Called(ctx, createdBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserStore) CreateWithIdentity(ctx context.Context, user *store.User, identity *store.Identity) error {
+	args := m.Called(ctx, user, identity)
+	return args.Error(0)
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, user *store.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockUserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration) error {
+	args := m.Called(ctx, userID, newEmail, token, exp)
+	return args.Error(0)
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockBlockStore struct {
+	mock.Mock
+}
+
+func (m *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockBlockStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockBlockStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	args := m.Called(ctx, userID, otherID)
+	return args.Bool(0), args.Error(1)
+}
+
 type MockFollowerStore struct {
 	mock.Mock
 }
@@ -66,6 +144,77 @@ func (m *MockFollowerStore) Unfollow(ctx context.Context, followerID, userID int
 	return args.Error(0)
 }
 
+func (m *MockFollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	args := m.Called(ctx, userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockFollowerStore) GetPopularFollowed(ctx context.Context, followerID int64, minFollowers int) ([]int64, error) {
+	args := m.Called(ctx, followerID, minFollowers)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockFollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, q store.FollowListQuery) ([]store.FollowEntry, error) {
+	args := m.Called(ctx, userID, viewerID, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.FollowEntry), args.Error(1)
+}
+
+func (m *MockFollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, q store.FollowListQuery) ([]store.FollowEntry, error) {
+	args := m.Called(ctx, userID, viewerID, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.FollowEntry), args.Error(1)
+}
+
+func (m *MockFollowerStore) GetStats(ctx context.Context, userID, viewerID int64) (*store.FollowStats, error) {
+	args := m.Called(ctx, userID, viewerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*store.FollowStats), args.Error(1)
+}
+
+func (m *MockFollowerStore) Request(ctx context.Context, followerID, userID int64) error {
+	args := m.Called(ctx, followerID, userID)
+	return args.Error(0)
+}
+
+func (m *MockFollowerStore) AcceptRequest(ctx context.Context, userID, requesterID int64) error {
+	args := m.Called(ctx, userID, requesterID)
+	return args.Error(0)
+}
+
+func (m *MockFollowerStore) AcceptAllRequests(ctx context.Context, userID int64) ([]int64, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockFollowerStore) DeleteRequest(ctx context.Context, userID, requesterID int64) error {
+	args := m.Called(ctx, userID, requesterID)
+	return args.Error(0)
+}
+
+func (m *MockFollowerStore) GetRequests(ctx context.Context, userID int64, q store.FollowListQuery) ([]store.FollowEntry, error) {
+	args := m.Called(ctx, userID, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.FollowEntry), args.Error(1)
+}
+
 type MockMailer struct {
 	mock.Mock
 }
@@ -93,19 +242,86 @@ func (m *MockUserCache) Set(ctx context.Context, user *store.User) error {
 }
 
 func (m *MockUserCache) Delete(ctx context.Context, id int64) {
+	m.Called(ctx, id)
+}
+
+type MockTimelineCache struct {
+	mock.Mock
+}
+
+func (m *MockTimelineCache) Get(ctx context.Context, userID int64) ([]int64, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockTimelineCache) Replace(ctx context.Context, userID int64, postIDs []int64, maxLen int) error {
+	args := m.Called(ctx, userID, postIDs, maxLen)
+	return args.Error(0)
+}
+
+func (m *MockTimelineCache) Push(ctx context.Context, userIDs []int64, postID int64, maxLen int) error {
+	args := m.Called(ctx, userIDs, postID, maxLen)
+	return args.Error(0)
+}
+
+func (m *MockTimelineCache) Delete(ctx context.Context, userID int64) {
+	m.Called(ctx, userID)
+}
+
+type MockTagCounter struct {
+	mock.Mock
+}
+
+func (m *MockTagCounter) Increment(ctx context.Context, postID int64, tags []string, at time.Time) error {
+	args := m.Called(ctx, postID, tags, at)
+	return args.Error(0)
+}
+
+func (m *MockTagCounter) Decrement(ctx context.Context, postID int64) error {
+	args := m.Called(ctx, postID)
+	return args.Error(0)
+}
+
+func (m *MockTagCounter) Top(ctx context.Context, window time.Duration, limit int, now time.Time) ([]store.TagCount, error) {
+	args := m.Called(ctx, window, limit, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]store.TagCount), args.Error(1)
 }
 
 type MockCacheStorage struct {
-	userCache *MockUserCache
+	userCache     *MockUserCache
+	revokedTokens *MockRevokedTokenStore
+	timelines     *MockTimelineCache
+	tags          *MockTagCounter
 }
 
 func (m *MockCacheStorage) Users() UserCache {
 	return m.userCache
 }
 
+func (m *MockCacheStorage) RevokedTokens() TokenRevocationList {
+	return m.revokedTokens
+}
+
+func (m *MockCacheStorage) Timelines() TimelineCache {
+	return m.timelines
+}
+
+func (m *MockCacheStorage) Tags() TagCounter {
+	return m.tags
+}
+
 func NewMockCacheStorage() *MockCacheStorage {
 	return &MockCacheStorage{
-		userCache: new(MockUserCache),
+		userCache:     new(MockUserCache),
+		revokedTokens: new(MockRevokedTokenStore),
+		timelines:     new(MockTimelineCache),
+		tags:          new(MockTagCounter),
 	}
 }
 
@@ -293,10 +509,12 @@ func TestUserService_FollowUser(t *testing.T) {
 		// Setup
 		mockUserStore := new(MockUserStore)
 		mockFollowerStore := new(MockFollowerStore)
+		mockBlockStore := new(MockBlockStore)
 		
 		mockStorage := store.Storage{
 			Users:     mockUserStore,
 			Followers: mockFollowerStore,
+			Blocks:    mockBlockStore,
 		}
 		
 		service := NewUserService(mockStorage, nil, nil, UserServiceConfig{})
@@ -304,13 +522,15 @@ func TestUserService_FollowUser(t *testing.T) {
 		// Setup mocks
 		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
 		mockUserStore.On("GetByID", ctx, followedID).Return(followed, nil)
+		mockBlockStore.On("IsBlocked", ctx, followerID, followedID).Return(false, nil)
 		mockFollowerStore.On("Follow", ctx, followerID, followedID).Return(nil)
 
 		// Execute
-		err := service.FollowUser(ctx, followerID, followedID)
+		requested, err := service.FollowUser(ctx, followerID, followedID)
 
 		// Assert
 		assert.NoError(t, err)
+		assert.False(t, requested)
 		mockUserStore.AssertExpectations(t)
 		mockFollowerStore.AssertExpectations(t)
 	})
@@ -329,7 +549,7 @@ func TestUserService_FollowUser(t *testing.T) {
 		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
 
 		// Execute
-		err := service.FollowUser(ctx, followerID, followerID)
+		_, err := service.FollowUser(ctx, followerID, followerID)
 
 		// Assert
 		assert.Error(t, err)
@@ -341,10 +561,12 @@ func TestUserService_FollowUser(t *testing.T) {
 		// Setup
 		mockUserStore := new(MockUserStore)
 		mockFollowerStore := new(MockFollowerStore)
+		mockBlockStore := new(MockBlockStore)
 		
 		mockStorage := store.Storage{
 			Users:     mockUserStore,
 			Followers: mockFollowerStore,
+			Blocks:    mockBlockStore,
 		}
 		
 		service := NewUserService(mockStorage, nil, nil, UserServiceConfig{})
@@ -352,10 +574,11 @@ func TestUserService_FollowUser(t *testing.T) {
 		// Setup mocks
 		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
 		mockUserStore.On("GetByID", ctx, followedID).Return(followed, nil)
+		mockBlockStore.On("IsBlocked", ctx, followerID, followedID).Return(false, nil)
 		mockFollowerStore.On("Follow", ctx, followerID, followedID).Return(store.ErrConflict)
 
 		// Execute
-		err := service.FollowUser(ctx, followerID, followedID)
+		_, err := service.FollowUser(ctx, followerID, followedID)
 
 		// Assert
 		assert.Error(t, err)
@@ -363,4 +586,544 @@ func TestUserService_FollowUser(t *testing.T) {
 		mockUserStore.AssertExpectations(t)
 		mockFollowerStore.AssertExpectations(t)
 	})
-}
\ No newline at end of file
+
+	t.Run("follow drops the cached timeline", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockBlockStore := new(MockBlockStore)
+		mockCacheStorage := NewMockCacheStorage()
+
+		mockStorage := store.Storage{
+			Users:     mockUserStore,
+			Followers: mockFollowerStore,
+			Blocks:    mockBlockStore,
+		}
+
+		service := NewUserService(mockStorage, mockCacheStorage, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
+		mockUserStore.On("GetByID", ctx, followedID).Return(followed, nil)
+		mockBlockStore.On("IsBlocked", ctx, followerID, followedID).Return(false, nil)
+		mockFollowerStore.On("Follow", ctx, followerID, followedID).Return(nil)
+		mockCacheStorage.timelines.On("Delete", ctx, followerID).Return()
+
+		// Execute
+		requested, err := service.FollowUser(ctx, followerID, followedID)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.False(t, requested)
+		mockCacheStorage.timelines.AssertExpectations(t)
+	})
+
+	t.Run("blocked users cannot follow", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockBlockStore := new(MockBlockStore)
+
+		mockStorage := store.Storage{
+			Users:     mockUserStore,
+			Followers: mockFollowerStore,
+			Blocks:    mockBlockStore,
+		}
+
+		service := NewUserService(mockStorage, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
+		mockUserStore.On("GetByID", ctx, followedID).Return(followed, nil)
+		mockBlockStore.On("IsBlocked", ctx, followerID, followedID).Return(true, nil)
+
+		// Execute
+		_, err := service.FollowUser(ctx, followerID, followedID)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrUserBlocked)
+		mockFollowerStore.AssertNotCalled(t, "Follow", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("following a private user sends a request", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockBlockStore := new(MockBlockStore)
+
+		mockStorage := store.Storage{
+			Users:     mockUserStore,
+			Followers: mockFollowerStore,
+			Blocks:    mockBlockStore,
+		}
+
+		service := NewUserService(mockStorage, nil, nil, UserServiceConfig{})
+
+		private := &store.User{ID: followedID, Username: "private", UserProfile: store.UserProfile{IsPrivate: true}}
+		mockUserStore.On("GetByID", ctx, followerID).Return(follower, nil)
+		mockUserStore.On("GetByID", ctx, followedID).Return(private, nil)
+		mockBlockStore.On("IsBlocked", ctx, followerID, followedID).Return(false, nil)
+		mockFollowerStore.On("Request", ctx, followerID, followedID).Return(nil)
+
+		// Execute
+		requested, err := service.FollowUser(ctx, followerID, followedID)
+
+		// Assert
+		require.NoError(t, err)
+		assert.True(t, requested)
+		mockFollowerStore.AssertNotCalled(t, "Follow", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserService_FollowRequests(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("accept drops the requester's timeline", func(t *testing.T) {
+		// Setup
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewUserService(store.Storage{Followers: mockFollowerStore}, mockCacheStorage, nil, UserServiceConfig{})
+
+		mockFollowerStore.On("AcceptRequest", ctx, int64(1), int64(2)).Return(nil)
+		mockCacheStorage.timelines.On("Delete", ctx, int64(2)).Return()
+
+		// Execute
+		err := service.AcceptFollowRequest(ctx, 1, 2)
+
+		// Assert
+		require.NoError(t, err)
+		mockCacheStorage.timelines.AssertExpectations(t)
+	})
+
+	t.Run("reject unknown request", func(t *testing.T) {
+		// Setup
+		mockFollowerStore := new(MockFollowerStore)
+		service := NewUserService(store.Storage{Followers: mockFollowerStore}, nil, nil, UserServiceConfig{})
+
+		mockFollowerStore.On("DeleteRequest", ctx, int64(1), int64(2)).Return(store.ErrNotFound)
+
+		// Execute
+		err := service.RejectFollowRequest(ctx, 1, 2)
+
+		// Assert
+		assert.Equal(t, ErrFollowRequestNotFound, err)
+	})
+
+	t.Run("going public accepts pending requests", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		mockCacheStorage := NewMockCacheStorage()
+		service := NewUserService(store.Storage{Users: mockUserStore, Followers: mockFollowerStore}, mockCacheStorage, nil, UserServiceConfig{})
+
+		user := &store.User{ID: 1, UserProfile: store.UserProfile{IsPrivate: true}}
+		public := false
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(user, nil)
+		mockUserStore.On("UpdateProfile", ctx, mock.Anything).Return(nil)
+		mockCacheStorage.userCache.On("Delete", ctx, int64(1)).Return()
+		mockFollowerStore.On("AcceptAllRequests", ctx, int64(1)).Return([]int64{2, 3}, nil)
+		mockCacheStorage.timelines.On("Delete", ctx, int64(2)).Return()
+		mockCacheStorage.timelines.On("Delete", ctx, int64(3)).Return()
+
+		// Execute
+		updated, err := service.UpdateProfile(ctx, 1, ProfileUpdateRequest{IsPrivate: &public})
+
+		// Assert
+		require.NoError(t, err)
+		assert.False(t, updated.IsPrivate)
+		mockFollowerStore.AssertExpectations(t)
+		mockCacheStorage.timelines.AssertExpectations(t)
+	})
+}
+
+func TestUserService_BlockUser(t *testing.T) {
+	ctx := context.Background()
+	blocked := &store.User{ID: 2, Username: "blocked"}
+
+	t.Run("block drops both timelines", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockBlockStore := new(MockBlockStore)
+		mockCacheStorage := NewMockCacheStorage()
+
+		service := NewUserService(store.Storage{Users: mockUserStore, Blocks: mockBlockStore}, mockCacheStorage, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, int64(2)).Return(blocked, nil)
+		mockBlockStore.On("Block", ctx, int64(1), int64(2)).Return(nil)
+		mockCacheStorage.timelines.On("Delete", ctx, int64(1)).Return()
+		mockCacheStorage.timelines.On("Delete", ctx, int64(2)).Return()
+
+		// Execute
+		err := service.BlockUser(ctx, 1, 2)
+
+		// Assert
+		require.NoError(t, err)
+		mockBlockStore.AssertExpectations(t)
+		mockCacheStorage.timelines.AssertExpectations(t)
+	})
+
+	t.Run("cannot block self", func(t *testing.T) {
+		service := NewUserService(store.Storage{}, nil, nil, UserServiceConfig{})
+
+		err := service.BlockUser(ctx, 1, 1)
+
+		assert.Equal(t, ErrCannotBlockSelf, err)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockBlockStore := new(MockBlockStore)
+
+		service := NewUserService(store.Storage{Users: mockUserStore, Blocks: mockBlockStore}, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, int64(2)).Return(nil, store.ErrNotFound)
+
+		// Execute
+		err := service.MuteUser(ctx, 1, 2)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		mockBlockStore.AssertNotCalled(t, "Mute", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserService_ResendActivation(t *testing.T) {
+	ctx := context.Background()
+	config := UserServiceConfig{
+		FrontendURL:    "http://localhost:3000",
+		MailExpiration: 24 * time.Hour,
+	}
+
+	t.Run("sends new invitation to inactive user", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, mockMailer, config)
+
+		user := &store.User{ID: 1, Username: "testuser", Email: "test@example.com"}
+		mockUserStore.On("Reinvite", mock.Anything, user.Email, mock.Anything, config.MailExpiration).Return(user, nil)
+		mockMailer.On("Send", "user_invitation.tmpl", user.Username, user.Email, mock.Anything, true).Return(200, nil)
+
+		// Execute
+		err := service.ResendActivation(ctx, user.Email)
+		assert.NoError(t, service.Shutdown(ctx))
+
+		// Assert
+		assert.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+	})
+
+	t.Run("unknown or active email is ignored", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, mockMailer, config)
+
+		mockUserStore.On("Reinvite", mock.Anything, "active@example.com", mock.Anything, config.MailExpiration).
+			Return(nil, store.ErrNotFound)
+
+		// Execute
+		err := service.ResendActivation(ctx, "active@example.com")
+		assert.NoError(t, service.Shutdown(ctx))
+
+		// Assert
+		assert.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+		mockMailer.AssertNotCalled(t, "Send")
+	})
+
+	t.Run("inactive email answers like an unknown one before the email is sent", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, mockMailer, config)
+
+		user := &store.User{ID: 1, Username: "testuser", Email: "test@example.com"}
+		sending := make(chan struct{})
+
+		mockUserStore.On("Reinvite", mock.Anything, "unknown@example.com", mock.Anything, config.MailExpiration).
+			Return(nil, store.ErrNotFound)
+		mockUserStore.On("Reinvite", mock.Anything, user.Email, mock.Anything, config.MailExpiration).Return(user, nil)
+		mockMailer.On("Send", "user_invitation.tmpl", user.Username, user.Email, mock.Anything, true).
+			Run(func(mock.Arguments) { <-sending }).
+			Return(200, nil)
+
+		// Execute
+		unknownErr := service.ResendActivation(ctx, "unknown@example.com")
+		inactiveErr := service.ResendActivation(ctx, user.Email)
+
+		// Assert
+		assert.NoError(t, unknownErr)
+		assert.Equal(t, unknownErr, inactiveErr)
+
+		close(sending)
+		assert.NoError(t, service.Shutdown(ctx))
+		mockMailer.AssertExpectations(t)
+	})
+}
+
+func TestUserService_CleanupInvitations(t *testing.T) {
+	ctx := context.Background()
+
+	// Setup
+	mockUserStore := new(MockUserStore)
+	service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, UserServiceConfig{
+		UnactivatedUserGracePeriod: 7 * 24 * time.Hour,
+	})
+
+	mockUserStore.On("DeleteExpiredInvitations", ctx).Return(int64(3), nil)
+	mockUserStore.On("DeleteUnactivated", ctx, mock.MatchedBy(func(createdBefore time.Time) bool {
+		return createdBefore.Before(time.Now().Add(-7*24*time.Hour + time.Minute))
+	})).Return(int64(2), nil)
+
+	// Execute
+	invitations, users, err := service.CleanupInvitations(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), invitations)
+	assert.Equal(t, int64(2), users)
+	mockUserStore.AssertExpectations(t)
+}
+
+func TestUserService_UpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	config := UserServiceConfig{UsernameChangeCooldown: 30 * 24 * time.Hour}
+
+	strPtr := func(s string) *string { return &s }
+
+	t.Run("updates the profile and invalidates the cache", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockCache := NewMockCacheStorage()
+		service := NewUserService(store.Storage{Users: mockUserStore}, mockCache, nil, config)
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1, Username: "gopher"}, nil)
+		mockUserStore.On("UpdateProfile", ctx, mock.MatchedBy(func(u *store.User) bool {
+			return u.Username == "gopher2" && u.UsernameChangedAt != nil && u.Bio == "Hi" && u.Website == ""
+		})).Return(nil)
+		mockCache.userCache.On("Delete", ctx, int64(1)).Return()
+
+		// Execute
+		user, err := service.UpdateProfile(ctx, 1, ProfileUpdateRequest{
+			Username: strPtr("gopher2"),
+			Bio:      strPtr("Hi"),
+		})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "gopher2", user.Username)
+		mockUserStore.AssertExpectations(t)
+		mockCache.userCache.AssertExpectations(t)
+	})
+
+	t.Run("rejects a username change during the cooldown", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, config)
+
+		changedAt := time.Now().Add(-24 * time.Hour)
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1, Username: "gopher", UsernameChangedAt: &changedAt}, nil)
+
+		// Execute
+		_, err := service.UpdateProfile(ctx, 1, ProfileUpdateRequest{Username: strPtr("gopher2")})
+
+		// Assert
+		var cooldown *UsernameChangeCooldownError
+		require.ErrorAs(t, err, &cooldown)
+		assert.ErrorIs(t, err, ErrUsernameChangeCooldown)
+		assert.Greater(t, cooldown.RetryAfter, 28*24*time.Hour)
+		mockUserStore.AssertNotCalled(t, "UpdateProfile", mock.Anything, mock.Anything)
+	})
+
+	t.Run("keeps the cooldown when the username is unchanged", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, config)
+
+		changedAt := time.Now().Add(-24 * time.Hour)
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1, Username: "gopher", UsernameChangedAt: &changedAt}, nil)
+		mockUserStore.On("UpdateProfile", ctx, mock.MatchedBy(func(u *store.User) bool {
+			return u.UsernameChangedAt.Equal(changedAt) && u.Location == "Berlin"
+		})).Return(nil)
+
+		// Execute
+		_, err := service.UpdateProfile(ctx, 1, ProfileUpdateRequest{Username: strPtr("gopher"), Location: strPtr("Berlin")})
+
+		// Assert
+		require.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+	})
+
+	t.Run("maps a taken username", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, config)
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1, Username: "gopher"}, nil)
+		mockUserStore.On("UpdateProfile", ctx, mock.Anything).Return(store.ErrDuplicateUsername)
+
+		// Execute
+		_, err := service.UpdateProfile(ctx, 1, ProfileUpdateRequest{Username: strPtr("taken")})
+
+		// Assert
+		assert.ErrorIs(t, err, ErrUsernameAlreadyExists)
+	})
+}
+
+func TestUserService_RequestEmailChange(t *testing.T) {
+	ctx := context.Background()
+	config := UserServiceConfig{EmailChangeExpiration: 24 * time.Hour}
+	user := &store.User{ID: 1, Username: "gopher", Email: "old@example.com"}
+
+	t.Run("sends a confirmation to the new email", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, mockMailer, config)
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(user, nil)
+		mockUserStore.On("GetByEmail", ctx, "new@example.com").Return(nil, store.ErrNotFound)
+		mockUserStore.On("CreateEmailChange", ctx, int64(1), "new@example.com", mock.Anything, 24*time.Hour).Return(nil)
+		mockMailer.On("Send", "email_change.tmpl", "gopher", "new@example.com", mock.Anything, true).Return(200, nil)
+
+		// Execute
+		err := service.RequestEmailChange(ctx, 1, "new@example.com")
+
+		// Assert
+		require.NoError(t, err)
+		mockUserStore.AssertExpectations(t)
+		mockMailer.AssertExpectations(t)
+	})
+
+	t.Run("rejects a taken email", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockMailer := new(MockMailer)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, mockMailer, config)
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(user, nil)
+		mockUserStore.On("GetByEmail", ctx, "taken@example.com").Return(&store.User{ID: 2}, nil)
+
+		// Execute
+		err := service.RequestEmailChange(ctx, 1, "taken@example.com")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrEmailAlreadyExists)
+		mockMailer.AssertNotCalled(t, "Send")
+	})
+
+	t.Run("rejects the current email", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, config)
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(user, nil)
+
+		// Execute
+		err := service.RequestEmailChange(ctx, 1, "OLD@example.com")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrEmailUnchanged)
+	})
+}
+
+func TestUserService_ConfirmEmailChange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("switches the email and invalidates the cache", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockCache := NewMockCacheStorage()
+		service := NewUserService(store.Storage{Users: mockUserStore}, mockCache, nil, UserServiceConfig{})
+
+		mockUserStore.On("ConfirmEmailChange", ctx, "token").Return(int64(1), nil)
+		mockCache.userCache.On("Delete", ctx, int64(1)).Return()
+
+		// Execute
+		err := service.ConfirmEmailChange(ctx, "token")
+
+		// Assert
+		require.NoError(t, err)
+		mockCache.userCache.AssertExpectations(t)
+	})
+
+	t.Run("rejects an unknown token", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("ConfirmEmailChange", ctx, "bad").Return(int64(0), store.ErrNotFound)
+
+		// Execute
+		err := service.ConfirmEmailChange(ctx, "bad")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidEmailChangeToken)
+	})
+}
+
+func TestUserService_GetFollowers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("links to the next page when there are more followers", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		service := NewUserService(store.Storage{Users: mockUserStore, Followers: mockFollowerStore}, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1}, nil)
+		mockFollowerStore.On("GetFollowers", ctx, int64(1), int64(2), store.FollowListQuery{Limit: 3}).Return([]store.FollowEntry{
+			{ID: 5, FollowedAt: "2025-01-03T00:00:00Z"},
+			{ID: 4, FollowedAt: "2025-01-02T00:00:00Z"},
+			{ID: 3, FollowedAt: "2025-01-01T00:00:00Z"},
+		}, nil)
+
+		// Execute
+		page, err := service.GetFollowers(ctx, 1, 2, store.FollowListQuery{Limit: 2})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, page.Users, 2)
+
+		cursor, err := store.DecodeFeedCursor(page.NextCursor)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), cursor.ID)
+		assert.Equal(t, "2025-01-02T00:00:00Z", cursor.CreatedAt)
+	})
+
+	t.Run("last page has no next cursor", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		mockFollowerStore := new(MockFollowerStore)
+		service := NewUserService(store.Storage{Users: mockUserStore, Followers: mockFollowerStore}, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, int64(1)).Return(&store.User{ID: 1}, nil)
+		mockFollowerStore.On("GetFollowing", ctx, int64(1), int64(0), store.FollowListQuery{Limit: 3}).Return([]store.FollowEntry{{ID: 5}}, nil)
+
+		// Execute
+		page, err := service.GetFollowing(ctx, 1, 0, store.FollowListQuery{Limit: 2})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Len(t, page.Users, 1)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("unknown user is not found", func(t *testing.T) {
+		// Setup
+		mockUserStore := new(MockUserStore)
+		service := NewUserService(store.Storage{Users: mockUserStore}, nil, nil, UserServiceConfig{})
+
+		mockUserStore.On("GetByID", ctx, int64(9)).Return(nil, store.ErrNotFound)
+
+		// Execute
+		_, err := service.GetFollowers(ctx, 9, 2, store.FollowListQuery{Limit: 2})
+
+		// Assert
+		assert.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
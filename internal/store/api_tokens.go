@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+type APITokenStore struct {
+	db *sql.DB
+}
+
+func (s *APITokenStore) Create(ctx context.Context, token *APIToken) error {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		token.UserID,
+		token.Name,
+		token.Token,
+		pq.Array(token.Scopes),
+		token.Expiry,
+	).Scan(
+		&token.ID,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *APITokenStore) GetByUserID(ctx context.Context, userID int64) ([]APIToken, error) {
+	query := `
+		SELECT id, user_id, name, scopes, expiry, last_used_at, created_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var expiry, lastUsedAt sql.NullTime
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Name,
+			pq.Array(&t.Scopes),
+			&expiry,
+			&lastUsedAt,
+			&t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Expiry = nullTimePtr(expiry)
+		t.LastUsedAt = nullTimePtr(lastUsedAt)
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (s *APITokenStore) GetByToken(ctx context.Context, token string) (*APIToken, error) {
+	query := `
+		SELECT id, user_id, name, scopes, expiry, last_used_at, created_at
+		FROM api_tokens
+		WHERE token = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	t := &APIToken{}
+	var expiry, lastUsedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, token).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		pq.Array(&t.Scopes),
+		&expiry,
+		&lastUsedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	t.Expiry = nullTimePtr(expiry)
+	t.LastUsedAt = nullTimePtr(lastUsedAt)
+
+	return t, nil
+}
+
+// Touch records token usage, at most once per minute to keep writes cheap
+func (s *APITokenStore) Touch(ctx context.Context, id int64) error {
+	query := `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *APITokenStore) Delete(ctx context.Context, id, userID int64) error {
+	query := `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *APITokenStore) DeleteByUserID(ctx context.Context, userID int64) error {
+	query := `DELETE FROM api_tokens WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
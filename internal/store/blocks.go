@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// BlockStore keeps blocks, which separate two users both ways, and mutes, which only hide
+// the muted user from the muter's feed
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block blocks blockedID for blockerID and removes the follows and follow requests between them
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+		_, err := tx.ExecContext(ctx, query, blockerID, blockedID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+func (s *BlockStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	return err
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	query := `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (s *BlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	query := `SELECT NOT ` + notBlocked("$1", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// notBlocked is a condition that holds unless the users viewer and author, placeholders or
+// columns, have blocked each other. A zero viewer blocks nobody.
+func notBlocked(viewer, author string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_blocks blk
+		WHERE (blk.blocker_id = ` + viewer + ` AND blk.blocked_id = ` + author + `)
+			OR (blk.blocker_id = ` + author + ` AND blk.blocked_id = ` + viewer + `)
+	)`
+}
+
+// notMuted is a condition that holds unless viewer muted author
+func notMuted(viewer, author string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM user_mutes mt WHERE mt.muter_id = ` + viewer + ` AND mt.muted_id = ` + author + `
+	)`
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/n-korel/social-api/internal/ratelimiter"
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttemptStore tracks failed logins in Redis, so throttling is shared between instances
+type LoginAttemptStore struct {
+	rdb    *redis.Client
+	config ratelimiter.LoginConfig
+}
+
+func NewLoginAttemptStore(rdb *redis.Client, config ratelimiter.LoginConfig) *LoginAttemptStore {
+	return &LoginAttemptStore{
+		rdb:    rdb,
+		config: config,
+	}
+}
+
+func (s *LoginAttemptStore) Check(ctx context.Context, key string) (time.Duration, error) {
+	cacheKey := fmt.Sprintf("login-blocked-%s", key)
+
+	ttl, err := s.rdb.PTTL(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// Negative TTLs mean the key does not exist
+	return max(ttl, 0), nil
+}
+
+// Checks the block and counts the failure in one step, so parallel attempts cannot get past it.
+// ARGV[1] is the window in milliseconds, ARGV[n+1] the backoff after n failures, the last one
+// being the lockout. Returns the remaining block, or 0 and the failure count.
+const failLoginScript = `
+local blocked = redis.call('PTTL', KEYS[2])
+if blocked > 0 then
+	return {blocked, 0}
+end
+local failures = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+local delay = tonumber(ARGV[math.min(failures, #ARGV - 1) + 1])
+if delay > 0 then
+	redis.call('SET', KEYS[2], 1, 'PX', delay)
+end
+return {0, failures}
+`
+
+// Fail records a failed attempt and reports whether it locked key out. While key is blocked
+// the attempt is not counted and Fail returns how long the block lasts instead.
+func (s *LoginAttemptStore) Fail(ctx context.Context, key string) (time.Duration, bool, error) {
+	keys := []string{
+		fmt.Sprintf("login-failures-%s", key),
+		fmt.Sprintf("login-blocked-%s", key),
+	}
+
+	args := []any{s.config.Window.Milliseconds()}
+	for failures := 1; failures <= max(s.config.MaxFailures, 1); failures++ {
+		args = append(args, s.config.Backoff(failures).Milliseconds())
+	}
+
+	res, err := s.rdb.Eval(ctx, failLoginScript, keys, args...).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if res[0] > 0 {
+		return time.Duration(res[0]) * time.Millisecond, false, nil
+	}
+
+	return 0, s.config.LockedOut(int(res[1])), nil
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.rdb.Del(
+		ctx,
+		fmt.Sprintf("login-failures-%s", key),
+		fmt.Sprintf("login-blocked-%s", key),
+	).Err()
+}
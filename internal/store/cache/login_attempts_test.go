@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/ratelimiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLoginConfig = ratelimiter.LoginConfig{
+	MaxFailures:     3,
+	BaseDelay:       time.Second,
+	MaxDelay:        2 * time.Second,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+func TestLoginAttemptStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("backs off and locks out", func(t *testing.T) {
+		s := NewLoginAttemptStore(newTestRedis(t), testLoginConfig)
+
+		blockedFor, lockedOut, err := s.Fail(ctx, "key")
+		require.NoError(t, err)
+		assert.Zero(t, blockedFor)
+		assert.False(t, lockedOut)
+
+		remaining, err := s.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.InDelta(t, time.Second, remaining, float64(100*time.Millisecond))
+
+		// Blocked attempts are rejected with the remaining block and not counted
+		blockedFor, _, err = s.Fail(ctx, "key")
+		require.NoError(t, err)
+		assert.Positive(t, blockedFor)
+
+		failures, err := s.rdb.Get(ctx, "login-failures-key").Int()
+		require.NoError(t, err)
+		assert.Equal(t, 1, failures)
+
+		// Skip the backoff by dropping the block, the count stays
+		for range 2 {
+			require.NoError(t, s.rdb.Del(ctx, "login-blocked-key").Err())
+			_, lockedOut, err = s.Fail(ctx, "key")
+			require.NoError(t, err)
+		}
+		assert.True(t, lockedOut)
+
+		remaining, err = s.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.InDelta(t, time.Minute, remaining, float64(100*time.Millisecond))
+	})
+
+	t.Run("parallel failures are counted once per block", func(t *testing.T) {
+		s := NewLoginAttemptStore(newTestRedis(t), testLoginConfig)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		counted := 0
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				blockedFor, _, err := s.Fail(ctx, "key")
+				assert.NoError(t, err)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if blockedFor == 0 {
+					counted++
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, counted)
+	})
+
+	t.Run("reset lifts a lockout", func(t *testing.T) {
+		s := NewLoginAttemptStore(newTestRedis(t), testLoginConfig)
+
+		_, _, err := s.Fail(ctx, "key")
+		require.NoError(t, err)
+		require.NoError(t, s.Reset(ctx, "key"))
+
+		remaining, err := s.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.Zero(t, remaining)
+
+		n, err := s.rdb.Exists(ctx, "login-failures-key").Result()
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+}
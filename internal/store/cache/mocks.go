@@ -2,13 +2,17 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/n-korel/social-api/internal/store"
 )
 
 func NewMockStore() *Storage {
 	return &Storage{
-		users: &MockUserStore{},
+		users:         &MockUserStore{},
+		revokedTokens: &MockRevokedTokenStore{},
+		timelines:     &MockTimelineStore{},
+		tags:          &MockTagCounterStore{},
 	}
 }
 
@@ -25,3 +29,55 @@ func (m *MockUserStore) Set(ctx context.Context, user *store.User) error {
 
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 }
+
+type MockRevokedTokenStore struct {
+}
+
+func (m *MockRevokedTokenStore) Revoke(ctx context.Context, jti string, expiry time.Time) error {
+	return nil
+}
+
+func (m *MockRevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockRevokedTokenStore) RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	return nil
+}
+
+func (m *MockRevokedTokenStore) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+type MockTimelineStore struct {
+}
+
+func (m *MockTimelineStore) Get(ctx context.Context, userID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *MockTimelineStore) Replace(ctx context.Context, userID int64, postIDs []int64, maxLen int) error {
+	return nil
+}
+
+func (m *MockTimelineStore) Push(ctx context.Context, userIDs []int64, postID int64, maxLen int) error {
+	return nil
+}
+
+func (m *MockTimelineStore) Delete(ctx context.Context, userID int64) {
+}
+
+type MockTagCounterStore struct {
+}
+
+func (m *MockTagCounterStore) Increment(ctx context.Context, postID int64, tags []string, at time.Time) error {
+	return nil
+}
+
+func (m *MockTagCounterStore) Decrement(ctx context.Context, postID int64) error {
+	return nil
+}
+
+func (m *MockTagCounterStore) Top(ctx context.Context, window time.Duration, limit int, now time.Time) ([]store.TagCount, error) {
+	return nil, nil
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis connects to the Redis at REDIS_TEST_ADDR, e.g. the one from docker-compose, and
+// empties its last database for the test. Tests are skipped when it is not set.
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR is not set")
+	}
+
+	rdb := NewRedisClient(addr, "", 15)
+	t.Cleanup(func() { rdb.Close() })
+
+	if err := rdb.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return rdb
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RevokedTokenStore keeps revoked access tokens only until they would have expired anyway
+type RevokedTokenStore struct {
+	rdb *redis.Client
+}
+
+func (s *RevokedTokenStore) Revoke(ctx context.Context, jti string, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return nil
+	}
+
+	cacheKey := fmt.Sprintf("revoked-token-%s", jti)
+
+	return s.rdb.SetEx(ctx, cacheKey, 1, ttl).Err()
+}
+
+func (s *RevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	cacheKey := fmt.Sprintf("revoked-token-%s", jti)
+
+	n, err := s.rdb.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (s *RevokedTokenStore) RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return nil
+	}
+
+	cacheKey := fmt.Sprintf("user-tokens-revoked-%d", userID)
+
+	return s.rdb.SetEx(ctx, cacheKey, issuedBefore.Format(time.RFC3339Nano), ttl).Err()
+}
+
+func (s *RevokedTokenStore) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	cacheKey := fmt.Sprintf("user-tokens-revoked-%d", userID)
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	if revokedAt, err := time.Parse(time.RFC3339Nano, data); err == nil {
+		return revokedAt, nil
+	}
+
+	// Written before sub-second precision, as Unix seconds
+	unix, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0), nil
+}
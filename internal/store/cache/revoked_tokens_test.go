@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokedTokenStore_UserTokensRevokedAt(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("keeps sub-second precision", func(t *testing.T) {
+		s := &RevokedTokenStore{rdb: newTestRedis(t)}
+
+		issuedBefore := time.Now().Truncate(time.Millisecond)
+		require.NoError(t, s.RevokeUserTokens(ctx, 1, issuedBefore, issuedBefore.Add(time.Minute)))
+
+		revokedAt, err := s.UserTokensRevokedAt(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, revokedAt.Equal(issuedBefore))
+	})
+
+	t.Run("reads revocations stored in seconds", func(t *testing.T) {
+		s := &RevokedTokenStore{rdb: newTestRedis(t)}
+
+		issuedBefore := time.Now().Truncate(time.Second)
+		require.NoError(t, s.rdb.Set(ctx, "user-tokens-revoked-1", strconv.FormatInt(issuedBefore.Unix(), 10), time.Minute).Err())
+
+		revokedAt, err := s.UserTokensRevokedAt(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, revokedAt.Equal(issuedBefore))
+	})
+}
@@ -6,17 +6,41 @@ import (
 )
 
 type Storage struct {
-	users service.UserCache
+	users         service.UserCache
+	revokedTokens service.TokenRevocationList
+	timelines     service.TimelineCache
+	tags          service.TagCounter
 }
 
 func (s *Storage) Users() service.UserCache {
 	return s.users
 }
 
+func (s *Storage) RevokedTokens() service.TokenRevocationList {
+	return s.revokedTokens
+}
+
+func (s *Storage) Timelines() service.TimelineCache {
+	return s.timelines
+}
+
+func (s *Storage) Tags() service.TagCounter {
+	return s.tags
+}
+
 func NewRedisStorage(rdb *redis.Client) *Storage {
 	return &Storage{
 		users: &UserStore{
 			rdb: rdb,
 		},
+		revokedTokens: &RevokedTokenStore{
+			rdb: rdb,
+		},
+		timelines: &TimelineStore{
+			rdb: rdb,
+		},
+		tags: &TagCounterStore{
+			rdb: rdb,
+		},
 	}
 }
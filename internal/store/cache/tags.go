@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// Tags are counted in 5 minute buckets for windows up to an hour and in hourly buckets otherwise
+const (
+	fineTagBucket   = time.Minute * 5
+	coarseTagBucket = time.Hour
+	// Buckets outlive the longest window
+	TagBucketExpTime = time.Hour * 24 * 8
+)
+
+// tagsSinceKey holds the Unix time of the first counted post. Counts of posts before it,
+// e.g. while Redis was disabled or after it lost its data, are missing.
+const tagsSinceKey = "tags-since"
+
+var ErrTagWindowNotCovered = errors.New("tag counters do not cover the window")
+
+// TagCounterStore keeps rolling tag counters as sorted sets, one per time bucket
+type TagCounterStore struct {
+	rdb *redis.Client
+}
+
+func tagBucketKey(size time.Duration, at time.Time) string {
+	return fmt.Sprintf("tags-%d-%d", int64(size.Seconds()), at.Unix()/int64(size.Seconds()))
+}
+
+// countedPostKey remembers which tags of a post were counted and when, as long as its buckets live
+func countedPostKey(postID int64) string {
+	return fmt.Sprintf("tags-post-%d", postID)
+}
+
+type countedPost struct {
+	At   int64    `json:"at"`
+	Tags []string `json:"tags"`
+}
+
+// Increment counts the tags of a post in the buckets of at
+func (s *TagCounterStore) Increment(ctx context.Context, postID int64, tags []string, at time.Time) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	counted, err := json.Marshal(countedPost{At: at.Unix(), Tags: tags})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, tagsSinceKey, at.Unix(), 0)
+		pipe.Set(ctx, countedPostKey(postID), counted, TagBucketExpTime)
+		for _, size := range []time.Duration{fineTagBucket, coarseTagBucket} {
+			key := tagBucketKey(size, at)
+			for _, tag := range tags {
+				pipe.ZIncrBy(ctx, key, 1, tag)
+			}
+			pipe.Expire(ctx, key, TagBucketExpTime)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Decrement takes back the tags Increment counted for a post, once. Posts that were never
+// counted, or whose buckets expired, are ignored.
+func (s *TagCounterStore) Decrement(ctx context.Context, postID int64) error {
+	data, err := s.rdb.GetDel(ctx, countedPostKey(postID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
+
+	var counted countedPost
+	if err := json.Unmarshal([]byte(data), &counted); err != nil {
+		return err
+	}
+
+	at := time.Unix(counted.At, 0)
+	_, err = s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, size := range []time.Duration{fineTagBucket, coarseTagBucket} {
+			key := tagBucketKey(size, at)
+			for _, tag := range counted.Tags {
+				pipe.ZIncrBy(ctx, key, -1, tag)
+			}
+			pipe.ZRemRangeByScore(ctx, key, "-inf", "0")
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Top sums the buckets covering window up to now. The oldest bucket is only partly inside
+// the window, so counts are approximate. It returns ErrTagWindowNotCovered when counting
+// started within the window.
+func (s *TagCounterStore) Top(ctx context.Context, window time.Duration, limit int, now time.Time) ([]store.TagCount, error) {
+	since, err := s.rdb.Get(ctx, tagsSinceKey).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrTagWindowNotCovered
+		}
+		return nil, err
+	}
+	if time.Unix(since, 0).After(now.Add(-window)) {
+		return nil, ErrTagWindowNotCovered
+	}
+
+	size := coarseTagBucket
+	if window <= time.Hour {
+		size = fineTagBucket
+	}
+
+	var keys []string
+	for at := now; at.After(now.Add(-window)); at = at.Add(-size) {
+		keys = append(keys, tagBucketKey(size, at))
+	}
+
+	members, err := s.rdb.ZUnionWithScores(ctx, redis.ZStore{Keys: keys, Aggregate: "SUM"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// ZUNION orders by ascending score
+	tags := make([]store.TagCount, 0, min(limit, len(members)))
+	for i := len(members) - 1; i >= 0 && len(tags) < limit; i-- {
+		tags = append(tags, store.TagCount{
+			Tag:   members[i].Member.(string),
+			Count: int64(members[i].Score),
+		})
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/n-korel/social-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagCounterStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("windows before the first count are not covered", func(t *testing.T) {
+		s := &TagCounterStore{rdb: newTestRedis(t)}
+
+		_, err := s.Top(ctx, time.Hour, 10, now)
+		assert.ErrorIs(t, err, ErrTagWindowNotCovered)
+
+		require.NoError(t, s.Increment(ctx, 1, []string{"go"}, now.Add(-time.Minute)))
+
+		_, err = s.Top(ctx, time.Hour, 10, now)
+		assert.ErrorIs(t, err, ErrTagWindowNotCovered)
+	})
+
+	t.Run("sums the buckets of the window", func(t *testing.T) {
+		s := &TagCounterStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.rdb.Set(ctx, tagsSinceKey, now.Add(-48*time.Hour).Unix(), 0).Err())
+		require.NoError(t, s.Increment(ctx, 1, []string{"go", "redis"}, now.Add(-10*time.Minute)))
+		require.NoError(t, s.Increment(ctx, 2, []string{"go"}, now))
+		require.NoError(t, s.Increment(ctx, 3, []string{"old"}, now.Add(-3*time.Hour)))
+
+		tags, err := s.Top(ctx, time.Hour, 10, now)
+		require.NoError(t, err)
+		assert.Equal(t, []store.TagCount{{Tag: "go", Count: 2}, {Tag: "redis", Count: 1}}, tags)
+	})
+
+	t.Run("the first count is kept", func(t *testing.T) {
+		s := &TagCounterStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.Increment(ctx, 1, []string{"go"}, now.Add(-2*time.Hour)))
+		require.NoError(t, s.Increment(ctx, 2, []string{"go"}, now))
+
+		tags, err := s.Top(ctx, time.Hour, 10, now)
+		require.NoError(t, err)
+		assert.Equal(t, []store.TagCount{{Tag: "go", Count: 1}}, tags)
+	})
+	t.Run("decrement takes back the counts of a post once", func(t *testing.T) {
+		s := &TagCounterStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.rdb.Set(ctx, tagsSinceKey, now.Add(-48*time.Hour).Unix(), 0).Err())
+		require.NoError(t, s.Increment(ctx, 1, []string{"go", "redis"}, now.Add(-10*time.Minute)))
+		require.NoError(t, s.Increment(ctx, 2, []string{"go"}, now))
+
+		require.NoError(t, s.Decrement(ctx, 1))
+		require.NoError(t, s.Decrement(ctx, 1))
+		require.NoError(t, s.Decrement(ctx, 3))
+
+		tags, err := s.Top(ctx, time.Hour, 10, now)
+		require.NoError(t, err)
+		assert.Equal(t, []store.TagCount{{Tag: "go", Count: 1}}, tags)
+	})
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rebuilt timelines expire after a day, which also bounds how long a post pushed
+// while a timeline was being rebuilt can be missing from it
+const TimelineExpTime = time.Hour * 24
+
+// Push only adds to timelines that exist: a missing timeline is rebuilt from the database on its next read.
+// The marker sorts first, so trimming starts after it when the timeline has one.
+const pushTimelineScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1])
+	local first = 0
+	if redis.call('ZSCORE', KEYS[1], '0') then
+		first = 1
+	end
+	redis.call('ZREMRANGEBYRANK', KEYS[1], first, -(tonumber(ARGV[2]) + 1))
+end
+return 0
+`
+
+// timelineMarker is a member of every built timeline, so that a timeline without posts is
+// still told apart from one that was never built. Post IDs start at 1.
+const timelineMarker = 0
+
+// TimelineStore keeps home timelines as sorted sets of post IDs. Post IDs grow over time,
+// so they double as scores.
+type TimelineStore struct {
+	rdb *redis.Client
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d", userID)
+}
+
+// Get returns the post IDs of a timeline, newest first. A timeline that was never built is nil,
+// a built timeline without posts is empty.
+func (s *TimelineStore) Get(ctx context.Context, userID int64) ([]int64, error) {
+	members, err := s.rdb.ZRevRange(ctx, timelineKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if id != timelineMarker {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s *TimelineStore) Replace(ctx context.Context, userID int64, postIDs []int64, maxLen int) error {
+	key := timelineKey(userID)
+
+	members := make([]redis.Z, 0, len(postIDs)+1)
+	members = append(members, redis.Z{Score: timelineMarker, Member: timelineMarker})
+	for _, id := range postIDs {
+		members = append(members, redis.Z{Score: float64(id), Member: id})
+	}
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.ZRemRangeByRank(ctx, key, 1, int64(-(maxLen + 1)))
+		pipe.Expire(ctx, key, TimelineExpTime)
+		return nil
+	})
+
+	return err
+}
+
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, postID int64, maxLen int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range userIDs {
+			pipe.Eval(ctx, pushTimelineScript, []string{timelineKey(userID)}, postID, maxLen)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) {
+	s.rdb.Del(ctx, timelineKey(userID))
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("a timeline that was never built is nil", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.Nil(t, ids)
+	})
+
+	t.Run("a built timeline without posts is empty", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.Replace(ctx, 1, nil, 3))
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.NotNil(t, ids)
+		assert.Empty(t, ids)
+
+		ttl, err := s.rdb.TTL(ctx, timelineKey(1)).Result()
+		require.NoError(t, err)
+		assert.Positive(t, ttl)
+	})
+
+	t.Run("replace keeps the newest posts", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.Replace(ctx, 1, []int64{5, 4, 3, 2, 1}, 3))
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{5, 4, 3}, ids)
+	})
+
+	t.Run("push adds to built timelines and trims them", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.Replace(ctx, 1, nil, 2))
+		require.NoError(t, s.Replace(ctx, 2, []int64{2, 1}, 2))
+
+		require.NoError(t, s.Push(ctx, []int64{1, 2}, 3, 2))
+		require.NoError(t, s.Push(ctx, []int64{1, 2}, 4, 2))
+		require.NoError(t, s.Push(ctx, []int64{1, 2}, 5, 2))
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{5, 4}, ids)
+
+		ids, err = s.Get(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{5, 4}, ids)
+	})
+
+	t.Run("push skips timelines that were never built", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.Push(ctx, []int64{1}, 3, 2))
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.Nil(t, ids)
+	})
+
+	t.Run("push trims timelines built without the marker", func(t *testing.T) {
+		s := &TimelineStore{rdb: newTestRedis(t)}
+
+		require.NoError(t, s.rdb.ZAdd(ctx, timelineKey(1), redis.Z{Score: 1, Member: 1}, redis.Z{Score: 2, Member: 2}).Err())
+		require.NoError(t, s.Push(ctx, []int64{1}, 3, 2))
+
+		ids, err := s.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{3, 2}, ids)
+	})
+}
@@ -3,33 +3,158 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	CommentSortNewest = "newest"
+	CommentSortOldest = "oldest"
+	// Most direct replies first
+	CommentSortTop = "top"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID     int64 `json:"id"`
+	PostID int64 `json:"post_id"`
+	// Comment this one replies to, nil for top level comments
+	ParentID *int64 `json:"parent_id"`
+	// Number of replies above the top level, 0 for top level comments
+	Depth int `json:"depth"`
+	// Direct replies, without those of users blocked with the viewer
+	ReplyCount int    `json:"reply_count"`
+	UserID     int64  `json:"user_id"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+	// Time of the last edit, nil for comments that were never edited
+	EditedAt *string `json:"edited_at"`
+	// Time the comment was deleted. Deleted comments with replies stay in their thread
+	// with the content cleared.
+	DeletedAt *string `json:"deleted_at"`
+	User      User    `json:"user"`
+	// Text search configuration of the comment, the database default when empty
+	Language string `json:"-"`
+}
+
+// CommentListQuery pages the top level comments of a post or the replies to ParentID. Top
+// comments reorder as replies arrive, so their cursors hold an offset like ranked feeds.
+type CommentListQuery struct {
+	Limit    int         `json:"limit" validate:"gte=1,lte=100"`
+	Sort     string      `json:"sort" validate:"oneof=newest oldest top"`
+	ParentID int64       `json:"parent_id" validate:"gte=0"`
+	Offset   int         `json:"-"`
+	Cursor   *FeedCursor `json:"-"`
+}
+
+func (q CommentListQuery) Parse(r *http.Request) (CommentListQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, errors.New("invalid limit")
+		}
+
+		q.Limit = l
+	}
+
+	sort := qs.Get("sort")
+	if sort != "" {
+		q.Sort = sort
+	}
+
+	parentID := qs.Get("parent_id")
+	if parentID != "" {
+		id, err := strconv.ParseInt(parentID, 10, 64)
+		if err != nil {
+			return q, errors.New("invalid parent_id")
+		}
+
+		q.ParentID = id
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeFeedCursor(cursor)
+		if err != nil || c.Backward || (c.Offset != nil) != (q.Sort == CommentSortTop) || (c.Offset == nil && c.Sort != q.Sort) {
+			return q, ErrInvalidCursor
+		}
+
+		if c.Offset != nil {
+			q.Offset = *c.Offset
+		} else {
+			q.Cursor = c
+		}
+	}
+
+	return q, nil
+}
+
+// NextCursor returns the cursor of the page after comments, a page read with q
+func (q CommentListQuery) NextCursor(comments []Comment) string {
+	if q.Sort == CommentSortTop {
+		return offsetCursor(q.Offset + len(comments))
+	}
+
+	last := comments[len(comments)-1]
+	return FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID, Sort: q.Sort}.Encode()
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// List returns a page of the top level comments of a post, or of the replies to q.ParentID,
+// without comments of users that viewerID blocked or was blocked by
+func (s *CommentStore) List(ctx context.Context, postID, viewerID int64, q CommentListQuery) ([]Comment, error) {
+	args := []any{postID, viewerID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	parent := "c.parent_id IS NULL"
+	if q.ParentID != 0 {
+		parent = "c.parent_id = " + arg(q.ParentID)
+	}
+
+	keyset := ""
+	order := "c.created_at DESC, c.id DESC"
+	switch q.Sort {
+	case CommentSortOldest:
+		order = "c.created_at ASC, c.id ASC"
+		if q.Cursor != nil {
+			keyset = `AND (c.created_at, c.id) > (` + arg(q.Cursor.CreatedAt) + `, ` + arg(q.Cursor.ID) + `)`
+		}
+	case CommentSortTop:
+		order = "reply_count DESC, c.created_at DESC, c.id DESC"
+	default:
+		if q.Cursor != nil {
+			keyset = `AND (c.created_at, c.id) < (` + arg(q.Cursor.CreatedAt) + `, ` + arg(q.Cursor.ID) + `)`
+		}
+	}
+
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c
-		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
-	`
+	SELECT
+		c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.edited_at, c.deleted_at, u.username, u.id,
+		(
+			SELECT COUNT(*) FROM comments r
+			WHERE r.parent_id = c.id AND ` + notBlocked("$2", "r.user_id") + `
+		) AS reply_count
+	FROM comments c
+	JOIN users u ON u.id = c.user_id
+	WHERE
+		c.post_id = $1 AND ` + parent + ` AND ` + notBlocked("$2", "c.user_id") + `
+		` + keyset + `
+	ORDER BY ` + order + `
+	LIMIT ` + arg(q.Limit) + ` OFFSET ` + arg(q.Offset)
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -38,20 +163,34 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 	comments := []Comment{}
 	for rows.Next() {
 		var c Comment
-		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.ParentID,
+			&c.Depth,
+			&c.UserID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.EditedAt,
+			&c.DeletedAt,
+			&c.User.Username,
+			&c.User.ID,
+			&c.ReplyCount,
+		)
 		if err != nil {
 			return nil, err
 		}
+
 		comments = append(comments, c)
 	}
-	return comments, nil
+
+	return comments, rows.Err()
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3) 
+		INSERT INTO comments (post_id, parent_id, depth, user_id, content, language)
+		VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, '')::regconfig, 'english'))
 		RETURNING id, created_at
 	`
 
@@ -62,8 +201,11 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 		ctx,
 		query,
 		comment.PostID,
+		comment.ParentID,
+		comment.Depth,
 		comment.UserID,
 		comment.Content,
+		comment.Language,
 	).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
@@ -74,3 +216,148 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 
 	return nil
 }
+
+// GetByID returns a comment with its number of replies, like List counting only replies
+// of users that viewerID did not block and was not blocked by. A zero viewer counts all replies.
+func (s *CommentStore) GetByID(ctx context.Context, id, viewerID int64) (*Comment, error) {
+	query := `
+		SELECT c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.edited_at, c.deleted_at, users.username, users.id,
+			(
+				SELECT COUNT(*) FROM comments r
+				WHERE r.parent_id = c.id AND ` + notBlocked("$2", "r.user_id") + `
+			) AS reply_count
+		FROM comments c
+		JOIN users on users.id = c.user_id
+		WHERE c.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Depth,
+		&c.UserID,
+		&c.Content,
+		&c.CreatedAt,
+		&c.EditedAt,
+		&c.DeletedAt,
+		&c.User.Username,
+		&c.User.ID,
+		&c.ReplyCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// Update saves the content of comment and marks it edited. Deleted comments are not found.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments
+		SET content = $1, edited_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING edited_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.EditedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a comment. A comment with replies is kept with its content cleared, so the
+// replies of other users stay in their thread. Deleted ancestors left without replies are
+// removed along with it.
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		parentID, err := s.deleteUnreplied(ctx, tx, id, false)
+		if errors.Is(err, ErrNotFound) {
+			return s.clear(ctx, tx, id)
+		}
+
+		for err == nil && parentID != nil {
+			parentID, err = s.deleteUnreplied(ctx, tx, *parentID, true)
+		}
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+// deleteUnreplied removes the comment unless it has replies, and returns its parent. Only
+// comments that were already deleted, or only those that were not, are matched.
+func (s *CommentStore) deleteUnreplied(ctx context.Context, tx *sql.Tx, id int64, deleted bool) (*int64, error) {
+	query := `
+		DELETE FROM comments c
+		WHERE c.id = $1 AND (c.deleted_at IS NOT NULL) = $2
+			AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+		RETURNING c.parent_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var parentID *int64
+	err := tx.QueryRowContext(ctx, query, id, deleted).Scan(&parentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return parentID, nil
+}
+
+// clear marks a comment with replies deleted and drops its content
+func (s *CommentStore) clear(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `
+		UPDATE comments
+		SET content = '', deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
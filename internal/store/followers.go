@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
 
 	"github.com/lib/pq"
 )
@@ -13,6 +16,61 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowEntry is a user in a followers or following list, with their relation to the viewer
+type FollowEntry struct {
+	ID               int64  `json:"id"`
+	Username         string `json:"username"`
+	DisplayName      string `json:"display_name"`
+	AvatarURL        string `json:"avatar_url"`
+	FollowedAt       string `json:"followed_at"`
+	FollowedByViewer bool   `json:"followed_by_viewer"`
+	FollowsViewer    bool   `json:"follows_viewer"`
+}
+
+// FollowStats counts the followers of a user and the users they follow, and tells how the
+// viewer is related to them
+type FollowStats struct {
+	FollowersCount   int64 `json:"followers_count"`
+	FollowingCount   int64 `json:"following_count"`
+	FollowedByViewer bool  `json:"followed_by_viewer"`
+	FollowsViewer    bool  `json:"follows_viewer"`
+	// The viewer asked to follow this private user and waits for approval
+	RequestedByViewer bool `json:"requested_by_viewer"`
+}
+
+// FollowListQuery pages a followers or following list, newest follows first. The cursor
+// points at the last entry of the previous page.
+type FollowListQuery struct {
+	Limit  int         `json:"limit" validate:"gte=1,lte=100"`
+	Cursor *FeedCursor `json:"-"`
+}
+
+func (q FollowListQuery) Parse(r *http.Request) (FollowListQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, errors.New("invalid limit")
+		}
+
+		q.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		c, err := DecodeFeedCursor(cursor)
+		if err != nil || c.Offset != nil || c.Backward {
+			return q, ErrInvalidCursor
+		}
+
+		q.Cursor = c
+	}
+
+	return q, nil
+}
+
 type FollowerStore struct {
 	db *sql.DB
 }
@@ -50,3 +108,288 @@ func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64)
 
 	return nil
 }
+
+// Request asks userID to approve followerID as a follower. Returns ErrConflict when the
+// request is pending already or followerID follows userID.
+func (s *FollowerStore) Request(ctx context.Context, followerID, userID int64) error {
+	query := `
+		INSERT INTO follow_requests (user_id, requester_id)
+		SELECT $1, $2
+		WHERE NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// AcceptRequest turns the pending request of requesterID into a follow of userID
+func (s *FollowerStore) AcceptRequest(ctx context.Context, userID, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`, userID, requesterID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		_, err = tx.ExecContext(ctx, query, userID, requesterID)
+		return err
+	})
+}
+
+// AcceptAllRequests approves every pending request of userID and returns the new followers
+func (s *FollowerStore) AcceptAllRequests(ctx context.Context, userID int64) ([]int64, error) {
+	var ids []int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, `DELETE FROM follow_requests WHERE user_id = $1 RETURNING requester_id`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO followers (user_id, follower_id)
+			SELECT $1, unnest($2::bigint[])
+			ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, userID, pq.Array(ids))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// DeleteRequest rejects or withdraws the request of requesterID to follow userID
+func (s *FollowerStore) DeleteRequest(ctx context.Context, userID, requesterID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetRequests returns the users waiting for userID to approve their follow request
+func (s *FollowerStore) GetRequests(ctx context.Context, userID int64, q FollowListQuery) ([]FollowEntry, error) {
+	return s.queryFollowList(ctx, "follow_requests", "user_id", "requester_id", userID, userID, q)
+}
+
+// GetFollowerIDs returns up to limit IDs of the users following userID
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `SELECT follower_id FROM followers WHERE user_id = $1 LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetPopularFollowed returns the users followerID follows that have more than minFollowers followers
+func (s *FollowerStore) GetPopularFollowed(ctx context.Context, followerID int64, minFollowers int) ([]int64, error) {
+	// The OFFSET subquery stops counting once minFollowers is passed
+	query := `
+		SELECT f.user_id FROM followers f
+		WHERE f.follower_id = $1 AND EXISTS (
+			SELECT 1 FROM followers c WHERE c.user_id = f.user_id OFFSET $2
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, followerID, minFollowers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetFollowers returns the users following userID
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, q FollowListQuery) ([]FollowEntry, error) {
+	return s.queryFollowList(ctx, "followers", "user_id", "follower_id", userID, viewerID, q)
+}
+
+// GetFollowing returns the users userID follows
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, q FollowListQuery) ([]FollowEntry, error) {
+	return s.queryFollowList(ctx, "followers", "follower_id", "user_id", userID, viewerID, q)
+}
+
+// queryFollowList lists the users in column other of the rows of table, followers or
+// follow_requests, where column self is userID, without users blocked with viewerID
+func (s *FollowerStore) queryFollowList(ctx context.Context, table, self, other string, userID, viewerID int64, q FollowListQuery) ([]FollowEntry, error) {
+	args := []any{userID, viewerID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	keyset := ""
+	if q.Cursor != nil {
+		keyset = `AND (f.created_at, f.` + other + `) < (` + arg(q.Cursor.CreatedAt) + `, ` + arg(q.Cursor.ID) + `)`
+	}
+
+	query := `
+	SELECT
+		u.id, u.username, u.display_name, u.avatar_url, f.created_at,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = u.id AND v.follower_id = $2) AS followed_by_viewer,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = $2 AND v.follower_id = u.id) AS follows_viewer
+	FROM ` + table + ` f
+	JOIN users u ON u.id = f.` + other + `
+	WHERE
+		f.` + self + ` = $1 AND u.is_active = true AND ` + notBlocked("$2", "u.id") + `
+		` + keyset + `
+	ORDER BY f.created_at DESC, f.` + other + ` DESC
+	LIMIT ` + arg(q.Limit)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FollowEntry{}
+	for rows.Next() {
+		var e FollowEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.Username,
+			&e.DisplayName,
+			&e.AvatarURL,
+			&e.FollowedAt,
+			&e.FollowedByViewer,
+			&e.FollowsViewer,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetStats counts the follows of userID and checks whether they and viewerID follow each other
+func (s *FollowerStore) GetStats(ctx context.Context, userID, viewerID int64) (*FollowStats, error) {
+	query := `
+	SELECT
+		(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.follower_id WHERE f.user_id = $1 AND u.is_active = true),
+		(SELECT COUNT(*) FROM followers f JOIN users u ON u.id = f.user_id WHERE f.follower_id = $1 AND u.is_active = true),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1),
+		EXISTS (SELECT 1 FROM follow_requests WHERE user_id = $1 AND requester_id = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var stats FollowStats
+	err := s.db.QueryRowContext(ctx, query, userID, viewerID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.FollowedByViewer,
+		&stats.FollowsViewer,
+		&stats.RequestedByViewer,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// authorVisible is a condition that holds when viewer may see the posts of author, an alias
+// of users: the account is public, or viewer is the author or one of their followers
+func authorVisible(viewer, author string) string {
+	return `(NOT ` + author + `.is_private OR ` + author + `.id = ` + viewer + ` OR EXISTS (
+		SELECT 1 FROM followers vis WHERE vis.user_id = ` + author + `.id AND vis.follower_id = ` + viewer + `
+	))`
+}
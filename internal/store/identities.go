@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Identity links a user to an account at an external OpenID provider
+type Identity struct {
+	ID        int64
+	UserID    int64
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt string
+}
+
+// OIDCState keeps what a login needs between the redirect to the provider and its callback
+type OIDCState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	Expiry       time.Time
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+func (s *IdentityStore) Create(ctx context.Context, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return createIdentity(ctx, tx, identity)
+	})
+}
+
+func createIdentity(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+type OIDCStateStore struct {
+	db *sql.DB
+}
+
+func (s *OIDCStateStore) Create(ctx context.Context, state *OIDCState) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// Abandoned logins are cleaned up as new ones start
+		if _, err := tx.ExecContext(ctx, `DELETE FROM oidc_states WHERE expiry < NOW()`); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO oidc_states (state, provider, code_verifier, nonce, expiry)
+			VALUES ($1, $2, $3, $4, $5)
+		`
+
+		_, err := tx.ExecContext(ctx, query, state.State, state.Provider, state.CodeVerifier, state.Nonce, state.Expiry)
+		return err
+	})
+}
+
+// Consume returns and deletes a state, so every state completes at most one login
+func (s *OIDCStateStore) Consume(ctx context.Context, state string) (*OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE state = $1
+		RETURNING state, provider, code_verifier, nonce, expiry
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	st := &OIDCState{}
+	err := s.db.QueryRowContext(ctx, query, state).Scan(
+		&st.State,
+		&st.Provider,
+		&st.CodeVerifier,
+		&st.Nonce,
+		&st.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
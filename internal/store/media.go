@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Media is an uploaded image. The blobs live in a media.BlobStore under the storage keys.
+type Media struct {
+	ID                   string `json:"id"`
+	UserID               int64  `json:"user_id"`
+	ContentType          string `json:"content_type"`
+	Size                 int64  `json:"size"`
+	Width                int    `json:"width"`
+	Height               int    `json:"height"`
+	Key                  string `json:"-"`
+	ThumbnailKey         string `json:"-"`
+	ThumbnailContentType string `json:"-"`
+	CreatedAt            string `json:"created_at"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+		INSERT INTO media (id, user_id, content_type, size, width, height, storage_key, thumbnail_key, thumbnail_content_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		m.ID,
+		m.UserID,
+		m.ContentType,
+		m.Size,
+		m.Width,
+		m.Height,
+		m.Key,
+		m.ThumbnailKey,
+		m.ThumbnailContentType,
+	).Scan(&m.CreatedAt)
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id string) (*Media, error) {
+	media, err := s.GetByIDs(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(media) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &media[0], nil
+}
+
+// GetByIDs returns the media with the given IDs, skipping unknown ones
+func (s *MediaStore) GetByIDs(ctx context.Context, ids []string) ([]Media, error) {
+	query := `
+		SELECT id, user_id, content_type, size, width, height, storage_key, thumbnail_key, thumbnail_content_type, created_at
+		FROM media
+		WHERE id = ANY($1::uuid[])
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		// IDs that are not UUIDs match nothing
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "22P02" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var media []Media
+	for rows.Next() {
+		var m Media
+		err := rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.ContentType,
+			&m.Size,
+			&m.Width,
+			&m.Height,
+			&m.Key,
+			&m.ThumbnailKey,
+			&m.ThumbnailContentType,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		media = append(media, m)
+	}
+
+	return media, rows.Err()
+}
+
+// IsVisible reports whether viewerID may see media of another user: it is an avatar or attached
+// to a post the viewer may see. A zero viewer only sees avatars and media of public posts.
+func (s *MediaStore) IsVisible(ctx context.Context, id string, viewerID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE avatar_media_id = $1::uuid
+		) OR EXISTS (
+			SELECT 1 FROM posts p JOIN users u ON u.id = p.user_id
+			WHERE $1::uuid = ANY(p.media_ids) AND ` + postVisible("$2", "u") + `
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(&visible)
+	if err != nil {
+		// IDs that are not UUIDs match nothing
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "22P02" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return visible, nil
+}
+
+// Delete removes the user's media, detaching it from their posts and avatar
+func (s *MediaStore) Delete(ctx context.Context, id string, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// The foreign key only clears avatar_media_id, the URL would point at a deleted image
+		_, err := tx.ExecContext(ctx, `UPDATE users SET avatar_url = '' WHERE id = $1 AND avatar_media_id = $2`, userID, id)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM media WHERE id = $1 AND user_id = $2`, id, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		query := `UPDATE posts SET media_ids = array_remove(media_ids, $1::uuid) WHERE user_id = $2 AND $1::uuid = ANY(media_ids)`
+		_, err = tx.ExecContext(ctx, query, id, userID)
+		return err
+	})
+}
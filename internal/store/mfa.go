@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserMFA is a TOTP enrollment, pending until the first code is confirmed
+type UserMFA struct {
+	UserID       int64
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+	CreatedAt    string
+}
+
+func (m *UserMFA) Confirmed() bool {
+	return m.ConfirmedAt != nil
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+func (s *MFAStore) GetByUserID(ctx context.Context, userID int64) (*UserMFA, error) {
+	query := `
+		SELECT user_id, secret, last_used_step, confirmed_at, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	mfa := &UserMFA{}
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.LastUsedStep,
+		&confirmedAt,
+		&mfa.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	mfa.ConfirmedAt = nullTimePtr(confirmedAt)
+
+	return mfa, nil
+}
+
+// CreatePending starts an enrollment, replacing a previous unconfirmed one.
+// It returns ErrConflict when the user already has a confirmed enrollment.
+func (s *MFAStore) CreatePending(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.confirmed_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Confirm activates a pending enrollment and replaces the user's recovery codes
+func (s *MFAStore) Confirm(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $2
+			WHERE user_id = $1 AND confirmed_at IS NULL
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrConflict
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			_, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2)`, userID, code)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseStep records the time step of an accepted code. It returns ErrConflict
+// when a code of the same or a later step was already used, so codes are never replayed.
+func (s *MFAStore) UseStep(ctx context.Context, userID, step int64) error {
+	query := `
+		UPDATE user_mfa SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes a hashed recovery code, returning ErrNotFound if it is unknown or used
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MFAStore) Delete(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -37,3 +37,39 @@ func (m *MockUserStore) Activate(ctx context.Context, t string) error {
 func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) Reinvite(ctx context.Context, email, token string, exp time.Duration) (*User, error) {
+	return &User{Email: email}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return nil
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	return 0, nil
+}
@@ -1,19 +1,159 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	FeedModeChronological = "chronological"
+	FeedModeRanked        = "ranked"
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit  int         `json:"limit" validate:"gte=1,lte=20"`
+	Offset int         `json:"offset" validate:"gte=0"`
+	Sort   string      `json:"sort" validate:"oneof=asc desc"`
+	Tags   []string    `json:"tags" validate:"max=5"`
+	Search string      `json:"search" validate:"max=100"`
+	Since  *time.Time  `json:"since"`
+	Until  *time.Time  `json:"until"`
+	Mode   string      `json:"mode" validate:"oneof=chronological ranked"`
+	Cursor *FeedCursor `json:"-"`
+}
+
+// FeedRanking weighs the signals a ranked feed is ordered by. A post scores
+//
+//	(recency + comments + affinity + tags) / (1 + AuthorRepeatPenalty * (n - 1))
+//
+// where recency halves every HalfLife, comments and affinity (the viewer's comments on the
+// author's posts) grow logarithmically, tags is the share of the post's tags the viewer wrote
+// or commented on, and n numbers the author's posts from their newest. Only posts newer than
+// Window are ranked.
+type FeedRanking struct {
+	RecencyWeight       float64
+	CommentsWeight      float64
+	AffinityWeight      float64
+	TagsWeight          float64
+	AuthorRepeatPenalty float64
+	HalfLife            time.Duration
+	Window              time.Duration
+}
+
+// FeedCursor points at the post a page continues from in the Sort order it was read with.
+// Backward cursors page towards the start of the feed. Ranked feeds reorder between requests,
+// so their cursors hold an offset instead.
+type FeedCursor struct {
+	CreatedAt string `json:"t,omitempty"`
+	ID        int64  `json:"id,omitempty"`
+	Sort      string `json:"s,omitempty"`
+	Backward  bool   `json:"b,omitempty"`
+	Offset    *int   `json:"o,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL safe string
+func (c FeedCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeFeedCursor(s string) (*FeedCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c FeedCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Offset != nil {
+		if *c.Offset < 0 {
+			return nil, ErrInvalidCursor
+		}
+		return &c, nil
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, c.CreatedAt); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// FeedPage is a page of the feed with the cursors of its neighbouring pages
+type FeedPage struct {
+	Posts      []PostWithMetadata
+	NextCursor string
+	PrevCursor string
+}
+
+// NewFeedPage trims posts fetched with a limit one above the query limit to a page. The extra
+// post tells whether there is another page in the fetch direction.
+func NewFeedPage(posts []PostWithMetadata, fq PaginatedFeedQuery) *FeedPage {
+	hasMore := len(posts) > fq.Limit
+	if hasMore {
+		// Backward pages are already in feed order, so the extra post comes first
+		if fq.Cursor != nil && fq.Cursor.Backward {
+			posts = posts[len(posts)-fq.Limit:]
+		} else {
+			posts = posts[:fq.Limit]
+		}
+	}
+
+	page := &FeedPage{Posts: posts}
+	if len(posts) == 0 {
+		return page
+	}
+
+	if fq.Mode == FeedModeRanked {
+		if hasMore {
+			page.NextCursor = offsetCursor(fq.Offset + fq.Limit)
+		}
+		if fq.Offset > 0 {
+			page.PrevCursor = offsetCursor(max(fq.Offset-fq.Limit, 0))
+		}
+		return page
+	}
+
+	first, last := posts[0], posts[len(posts)-1]
+	next := FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID, Sort: fq.Sort}
+	prev := FeedCursor{CreatedAt: first.CreatedAt, ID: first.ID, Sort: fq.Sort, Backward: true}
+
+	switch {
+	case fq.Cursor == nil:
+		if hasMore {
+			page.NextCursor = next.Encode()
+		}
+		if fq.Offset > 0 {
+			page.PrevCursor = prev.Encode()
+		}
+	case fq.Cursor.Backward:
+		page.NextCursor = next.Encode()
+		if hasMore {
+			page.PrevCursor = prev.Encode()
+		}
+	default:
+		if hasMore {
+			page.NextCursor = next.Encode()
+		}
+		page.PrevCursor = prev.Encode()
+	}
+
+	return page
+}
+
+func offsetCursor(offset int) string {
+	return FeedCursor{Offset: &offset}.Encode()
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -54,5 +194,86 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Search = search
 	}
 
+	mode := qs.Get("mode")
+	if mode != "" {
+		fq.Mode = mode
+	}
+
+	now := time.Now()
+
+	since := qs.Get("since")
+	if since != "" {
+		t, err := parseFeedTime(since, now)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since: %w", err)
+		}
+
+		fq.Since = &t
+	}
+
+	until := qs.Get("until")
+	if until != "" {
+		t, err := parseFeedTime(until, now)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until: %w", err)
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && !fq.Since.Before(*fq.Until) {
+		return fq, errors.New("since must be before until")
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if offset != "" {
+			return fq, errors.New("cursor and offset cannot be combined")
+		}
+
+		c, err := DecodeFeedCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+
+		switch {
+		case c.Offset != nil:
+			fq.Offset = *c.Offset
+		// The position of a cursor means nothing in another order
+		case fq.Mode == FeedModeRanked, c.Sort != fq.Sort:
+			return fq, ErrInvalidCursor
+		default:
+			fq.Cursor = c
+		}
+	}
+
 	return fq, nil
 }
+
+// parseFeedTime accepts an RFC 3339 timestamp or a duration back from now like "90m", "24h" or "7d"
+func parseFeedTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, errors.New("expected an RFC 3339 time or a duration like 24h or 7d")
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil {
+			return time.Time{}, errors.New("expected an RFC 3339 time or a duration like 24h or 7d")
+		}
+	}
+
+	if d <= 0 {
+		return time.Time{}, errors.New("duration must be positive")
+	}
+
+	return now.Add(-d), nil
+}
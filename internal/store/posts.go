@@ -4,63 +4,124 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+// Post visibility levels. Authors always see their posts, blocked users never do.
+const (
+	// Everyone who may see the author's posts, only approved followers for private accounts
+	VisibilityPublic = "public"
+	// Followers of the author
+	VisibilityFollowers = "followers"
+	// Users mentioned in the content
+	VisibilityMentioned = "mentioned"
+	// Nobody but the author, used for drafts
+	VisibilityPrivate = "private"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID         int64    `json:"id"`
+	Content    string   `json:"content"`
+	Title      string   `json:"title"`
+	UserID     int64    `json:"user_id"`
+	Tags       []string `json:"tags"`
+	MediaIDs   []string `json:"media_ids"`
+	Visibility string   `json:"visibility"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+	Version    int      `json:"version"`
+	User       User     `json:"user"`
+	// Text search configuration of the post, the database default when empty
+	Language string `json:"-"`
+	// Usernames mentioned in the content, saved with the post. Unknown and blocked users are skipped.
+	Mentions []string `json:"-"`
 }
 
 type PostWithMetadata struct {
 	Post
 	CommentCount int `json:"comments_count"`
+	// Only set in ranked feeds
+	Score float64 `json:"score,omitempty"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
 }
 
 type PostStore struct {
 	db *sql.DB
 }
 
+// homeFeedSource matches the posts of user $1 and the users they follow that $1 may see.
+// Follows end with a block, the visibility check covers posts of the user that was blocked
+// after a follow was read.
+var homeFeedSource = `(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
+		` + postVisible("$1", "u") + ` AND ` + notMuted("$1", "p.user_id")
+
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+		INSERT INTO posts (content, title, user_id, tags, language, media_ids, visibility)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, '')::regconfig, 'english'), COALESCE($6::uuid[], '{}'), COALESCE(NULLIF($7, ''), 'public'))
+		RETURNING id, visibility, created_at, updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Language,
+			pq.Array(post.MediaIDs),
+			post.Visibility,
+		).Scan(
+			&post.ID,
+			&post.Visibility,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
+		return s.saveMentions(ctx, tx, post)
+	})
+}
+
+// saveMentions replaces the mentions of post with the active users named in post.Mentions,
+// skipping the author and users blocked with them
+func (s *PostStore) saveMentions(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, post.ID); err != nil {
 		return err
 	}
 
-	return nil
+	if len(post.Mentions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, u.id FROM users u
+		WHERE u.username = ANY($2) AND u.is_active = true AND u.id <> $3 AND ` + notBlocked("$3", "u.id") + `
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(post.Mentions), post.UserID)
+	return err
 }
 
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 	query := `
-		SELECT id, user_id, title, content, created_at, updated_at, tags, version
+		SELECT id, user_id, title, content, created_at, updated_at, tags, media_ids, visibility, version
 		FROM posts
 		WHERE id = $1
 	`
@@ -77,6 +138,8 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
+		pq.Array(&post.MediaIDs),
+		&post.Visibility,
 		&post.Version,
 	)
 
@@ -115,58 +178,306 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 	return nil
 }
 
+// Update saves the title, content, visibility and mentions of post
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
+		SET title = $1, content = $2, visibility = $3, version = version + 1, updated_at = NOW()
+		WHERE id = $4 AND version = $5
+		RETURNING version, updated_at
 	`
 
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.Visibility,
+			post.ID,
+			post.Version,
+		).Scan(&post.Version, &post.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return s.saveMentions(ctx, tx, post)
+	})
+}
+
+// IsVisible reports whether viewerID may see the post, see postVisible
+func (s *PostStore) IsVisible(ctx context.Context, postID, viewerID int64) (bool, error) {
+	query := `SELECT ` + postVisible("$2", "u") + ` FROM posts p JOIN users u ON u.id = p.user_id WHERE p.id = $1`
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
-
+	var visible bool
+	err := s.db.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
-			return err
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
 		}
+		return false, err
 	}
 
-	return nil
+	return visible, nil
 }
 
+// GetUserFeed returns the posts of the user and the users they follow that the user may see,
+// without muted authors
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
-	if fq.Tags == nil {
-		fq.Tags = []string{}
+	return s.queryFeed(ctx, homeFeedSource, []any{userID}, fq)
+}
+
+// GetUserPosts returns the public posts written by the user, none when the account is private
+func (s *PostStore) GetUserPosts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	return s.queryFeed(ctx, `p.user_id = $1 AND p.visibility = 'public' AND NOT u.is_private`, []any{userID}, fq)
+}
+
+// GetFeedByIDs reads the feed of viewerID from a cached timeline: the posts in postIDs plus the
+// posts of authorIDs from minID on, so that they do not outlast the other authors of a trimmed
+// timeline. Posts the viewer may no longer see and authors muted since the timeline was cached
+// are skipped.
+func (s *PostStore) GetFeedByIDs(ctx context.Context, viewerID int64, postIDs, authorIDs []int64, minID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	source := `(p.id = ANY($2) OR (p.user_id = ANY($3) AND p.id >= $4)) AND ` + postVisible("$1", "u") + ` AND ` + notMuted("$1", "p.user_id")
+
+	return s.queryFeed(ctx, source, []any{viewerID, pq.Array(postIDs), pq.Array(authorIDs), minID}, fq)
+}
+
+// GetTimeline returns the IDs of the newest posts of the user and the users they follow
+func (s *PostStore) GetTimeline(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT id FROM posts
+		WHERE user_id = $1 OR user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetRankedFeed returns the feed ordered by score instead of time, see FeedRanking
+func (s *PostStore) GetRankedFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery, ranking FeedRanking) ([]PostWithMetadata, error) {
+	return s.queryRankedFeed(ctx, userID, homeFeedSource, fq, ranking)
+}
+
+// GetExploreFeed returns the public posts of all users that viewerID may see, newest first or
+// ranked. A zero viewer only sees public accounts. Ranked explore feeds are not personal, so
+// affinity and tag weights should be zero.
+func (s *PostStore) GetExploreFeed(ctx context.Context, viewerID int64, fq PaginatedFeedQuery, ranking FeedRanking) ([]PostWithMetadata, error) {
+	source := `p.visibility = 'public' AND ` + postVisible("$1", "u")
+
+	if fq.Mode == FeedModeRanked {
+		return s.queryRankedFeed(ctx, viewerID, source, fq, ranking)
+	}
+
+	return s.queryFeed(ctx, source, []any{viewerID}, fq)
+}
+
+// GetTrendingTags counts the tags of public posts of public accounts created since
+func (s *PostStore) GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]TagCount, error) {
+	query := `
+		SELECT tag, COUNT(*) AS count
+		FROM posts p
+		JOIN users u ON u.id = p.user_id, unnest(p.tags) AS tag
+		WHERE p.created_at >= $1 AND p.visibility = '` + VisibilityPublic + `' AND NOT u.is_private
+		GROUP BY tag
+		ORDER BY count DESC, tag
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Tag, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// queryRankedFeed ranks the posts matched by source for the viewer, source may use $1 as the viewer ID
+func (s *PostStore) queryRankedFeed(ctx context.Context, viewerID int64, source string, fq PaginatedFeedQuery, ranking FeedRanking) ([]PostWithMetadata, error) {
+	args := []any{viewerID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	filters := feedFilters(fq, arg)
+
+	// Affinity counts the viewer's comments on the author's posts. The viewer's tags come from
+	// the posts they wrote or commented on.
+	query := `
+	WITH affinity AS (
+		SELECT p.user_id, COUNT(*) AS interactions
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.user_id = $1
+		GROUP BY p.user_id
+	),
+	viewer_tags AS (
+		SELECT DISTINCT unnest(tags) AS tag FROM posts
+		WHERE user_id = $1 OR id IN (SELECT post_id FROM comments WHERE user_id = $1)
+	),
+	candidates AS (
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.media_ids, p.visibility,
+			u.username,
+			COUNT(c.id) AS comments_count,
+			ROW_NUMBER() OVER (PARTITION BY p.user_id ORDER BY p.created_at DESC) AS author_rank
+		FROM posts p
+		LEFT JOIN comments c ON c.post_id = p.id
+		LEFT JOIN users u ON p.user_id = u.id
+		WHERE
+			` + source + ` AND
+			p.created_at >= NOW() - make_interval(secs => ` + arg(ranking.Window.Seconds()) + `) AND
+			` + filters + `
+		GROUP BY p.id, u.username
+	),
+	scored AS (
+		SELECT
+			cd.*,
+			(
+				` + arg(ranking.RecencyWeight) + `::float8 * exp(-ln(2) * extract(epoch FROM NOW() - cd.created_at) / ` + arg(ranking.HalfLife.Seconds()) + `::float8) +
+				` + arg(ranking.CommentsWeight) + `::float8 * ln(1 + cd.comments_count) +
+				` + arg(ranking.AffinityWeight) + `::float8 * ln(1 + COALESCE(a.interactions, 0)) +
+				` + arg(ranking.TagsWeight) + `::float8 * (
+					SELECT COUNT(*) FROM unnest(cd.tags) t WHERE t IN (SELECT tag FROM viewer_tags)
+				)::float8 / GREATEST(cardinality(cd.tags), 1)
+			) / (1 + ` + arg(ranking.AuthorRepeatPenalty) + `::float8 * (cd.author_rank - 1)) AS score
+		FROM candidates cd
+		LEFT JOIN affinity a ON a.user_id = cd.user_id
+	)
+	SELECT id, user_id, title, content, created_at, updated_at, version, tags, media_ids, visibility, username, comments_count, score
+	FROM scored
+	ORDER BY score DESC, id DESC
+	LIMIT ` + arg(fq.Limit) + ` OFFSET ` + arg(fq.Offset) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var feed []PostWithMetadata
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			pq.Array(&p.MediaIDs),
+			&p.Visibility,
+			&p.User.Username,
+			&p.CommentCount,
+			&p.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		feed = append(feed, p)
+	}
+
+	return feed, rows.Err()
+}
+
+// queryFeed runs the feed query over the posts matched by source, a condition using
+// the first len(sourceArgs) placeholders
+func (s *PostStore) queryFeed(ctx context.Context, source string, sourceArgs []any, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	args := sourceArgs
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// Keyset pagination on (created_at, id). Backward pages are read in reverse
+	// order and flipped back below.
+	order, cmp := fq.Sort, ">"
+	if order == "desc" {
+		cmp = "<"
+	}
+	if fq.Cursor != nil && fq.Cursor.Backward {
+		order, cmp = reverseSort(order), reverseCmp(cmp)
+	}
+
+	filters := feedFilters(fq, arg)
+
+	keyset := ""
+	if fq.Cursor != nil {
+		keyset = `AND (p.created_at, p.id) ` + cmp + ` (` + arg(fq.Cursor.CreatedAt) + `, ` + arg(fq.Cursor.ID) + `)`
 	}
 
 	query := `
 	SELECT
-		p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+		p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.media_ids, p.visibility,
 		u.username,
 		COUNT(c.id) AS comments_count
 	FROM posts p
 	LEFT JOIN comments c ON c.post_id = p.id
 	LEFT JOIN users u ON p.user_id = u.id
-	LEFT JOIN followers f ON f.follower_id = $1
 	WHERE 
-		(f.user_id = p.user_id OR p.user_id = $1) AND
-		(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-		(p.tags @> $5 OR $5 = '{}')
+		` + source + ` AND
+		` + filters + `
+		` + keyset + `
 	GROUP BY p.id, u.username
-	ORDER BY p.created_at ` + fq.Sort + `
-	LIMIT $2 OFFSET $3
+	ORDER BY p.created_at ` + order + `, p.id ` + order + `
+	LIMIT ` + arg(fq.Limit) + ` OFFSET ` + arg(fq.Offset) + `
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -182,8 +493,11 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 			&p.Title,
 			&p.Content,
 			&p.CreatedAt,
+			&p.UpdatedAt,
 			&p.Version,
 			pq.Array(&p.Tags),
+			pq.Array(&p.MediaIDs),
+			&p.Visibility,
 			&p.User.Username,
 			&p.CommentCount,
 		)
@@ -194,5 +508,53 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		feed = append(feed, p)
 	}
 
-	return feed, nil
+	if fq.Cursor != nil && fq.Cursor.Backward {
+		slices.Reverse(feed)
+	}
+
+	return feed, rows.Err()
+}
+
+// feedFilters returns the search, tag and time conditions of a feed query on posts p
+func feedFilters(fq PaginatedFeedQuery, arg func(any) string) string {
+	if fq.Tags == nil {
+		fq.Tags = []string{}
+	}
+
+	search, tags, since, until := arg(fq.Search), arg(pq.Array(fq.Tags)), arg(fq.Since), arg(fq.Until)
+
+	return `(p.title ILIKE '%' || ` + search + ` || '%' OR p.content ILIKE '%' || ` + search + ` || '%') AND
+		(p.tags @> ` + tags + ` OR ` + tags + ` = '{}') AND
+		(` + since + `::timestamptz IS NULL OR p.created_at >= ` + since + `) AND
+		(` + until + `::timestamptz IS NULL OR p.created_at < ` + until + `)`
+}
+
+func reverseSort(sort string) string {
+	if sort == "desc" {
+		return "asc"
+	}
+	return "desc"
+}
+
+func reverseCmp(cmp string) string {
+	if cmp == "<" {
+		return ">"
+	}
+	return "<"
+}
+
+// postVisible is a condition that holds when viewer may see the post p of author, an alias of
+// users. Authors see all their posts. Others must not be blocked with the author and see public
+// posts when they may see the author's posts, followers posts when they follow the author and
+// mentioned posts when they are mentioned. A zero viewer only sees public posts of public accounts.
+func postVisible(viewer, author string) string {
+	return `(p.user_id = ` + viewer + ` OR (` + notBlocked(viewer, "p.user_id") + ` AND (
+		(p.visibility = '` + VisibilityPublic + `' AND ` + authorVisible(viewer, author) + `) OR
+		(p.visibility = '` + VisibilityFollowers + `' AND EXISTS (
+			SELECT 1 FROM followers pf WHERE pf.user_id = p.user_id AND pf.follower_id = ` + viewer + `
+		)) OR
+		(p.visibility = '` + VisibilityMentioned + `' AND EXISTS (
+			SELECT 1 FROM post_mentions pm WHERE pm.post_id = p.id AND pm.user_id = ` + viewer + `
+		))
+	)))`
 }
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	Token     string
+	FamilyID  string
+	Expiry    time.Time
+	RevokedAt *time.Time
+	CreatedAt string
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, token)
+	})
+}
+
+func (s *RefreshTokenStore) GetByToken(ctx context.Context, token string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, token, family_id, expiry, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revokedAt sql.NullTime
+	refreshToken := &RefreshToken{}
+	err := s.db.QueryRowContext(ctx, query, token).Scan(
+		&refreshToken.ID,
+		&refreshToken.UserID,
+		&refreshToken.Token,
+		&refreshToken.FamilyID,
+		&refreshToken.Expiry,
+		&revokedAt,
+		&refreshToken.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if revokedAt.Valid {
+		refreshToken.RevokedAt = &revokedAt.Time
+	}
+
+	return refreshToken, nil
+}
+
+// Rotate marks the used token as revoked and stores its successor in one transaction.
+// ErrConflict means the token has already been used by a concurrent request.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, usedID int64, next *RefreshToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.revoke(ctx, tx, usedID); err != nil {
+			return err
+		}
+
+		return s.create(ctx, tx, next)
+	})
+}
+
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) RevokeByUserID(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (token, user_id, family_id, expiry)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		token.Token,
+		token.UserID,
+		token.FamilyID,
+		token.Expiry,
+	).Scan(
+		&token.ID,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) revoke(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
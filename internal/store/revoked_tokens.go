@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RevokedTokenStore is the Postgres revocation list for access tokens, used when Redis is disabled
+type RevokedTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RevokedTokenStore) Revoke(ctx context.Context, jti string, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expiry) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, jti, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeUserTokens revokes every token of the user issued up to issuedBefore.
+// The expiry is only needed by TTL based implementations.
+func (s *RevokedTokenStore) RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, issuedBefore)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UserTokensRevokedAt returns zero time if the user never revoked all tokens
+func (s *RevokedTokenStore) UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	query := `SELECT revoked_at FROM user_token_revocations WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revokedAt time.Time
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&revokedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, nil
+		default:
+			return time.Time{}, err
+		}
+	}
+
+	return revokedAt, nil
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	SearchTypePosts    = "posts"
+	SearchTypeComments = "comments"
+	SearchTypeUsers    = "users"
+)
+
+// Highlighted matches are delimited with control characters in ts_headline and turned into
+// <mark> tags after the rest of the snippet is HTML escaped
+const (
+	highlightStart   = "\x02"
+	highlightStop    = "\x03"
+	headlineOptions  = "StartSel=\x02, StopSel=\x03, MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" ... \""
+	titleHeadlineOpt = "StartSel=\x02, StopSel=\x03, HighlightAll=true"
+)
+
+// SearchQuery is a full-text search. Author, tag and time filters apply to posts and comments,
+// users are matched by username only.
+type SearchQuery struct {
+	Query    string     `json:"q" validate:"required,max=200"`
+	Types    []string   `json:"types" validate:"min=1,dive,oneof=posts comments users"`
+	AuthorID int64      `json:"author" validate:"gte=0"`
+	Tag      string     `json:"tag" validate:"max=100"`
+	Since    *time.Time `json:"since"`
+	Until    *time.Time `json:"until"`
+	Limit    int        `json:"limit" validate:"gte=1,lte=50"`
+	Offset   int        `json:"offset" validate:"gte=0"`
+	// Text search configuration the query is parsed with, e.g. english
+	Language string `json:"-"`
+	// Only posts and comments the user may see are matched
+	ViewerID int64 `json:"-"`
+}
+
+type PostSearchResult struct {
+	PostWithMetadata
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Highlight      string  `json:"highlight"`
+}
+
+type CommentSearchResult struct {
+	Comment
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+type UserSearchResult struct {
+	ID        int64   `json:"id"`
+	Username  string  `json:"username"`
+	CreatedAt string  `json:"created_at"`
+	Rank      float64 `json:"rank"`
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// SearchPosts matches posts the viewer may see by title (weighted higher) and content
+func (s *SearchStore) SearchPosts(ctx context.Context, sq SearchQuery) ([]PostSearchResult, error) {
+	args := []any{sq.Language, sq.Query}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	query := `
+	SELECT
+		p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.version, p.tags, p.media_ids, p.visibility,
+		u.username,
+		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+		ts_rank(p.search_vector, q.query) AS rank,
+		ts_headline(p.language, p.title, q.query, ` + arg(titleHeadlineOpt) + `) AS title_highlight,
+		ts_headline(p.language, p.content, q.query, ` + arg(headlineOptions) + `) AS highlight
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	CROSS JOIN websearch_to_tsquery($1::regconfig, $2) AS q(query)
+	WHERE
+		p.search_vector @@ q.query AND ` + postVisible(arg(sq.ViewerID), "u") + ` AND
+		` + searchFilters(sq, "p.user_id", "p.tags", "p.created_at", arg) + `
+	ORDER BY rank DESC, p.id DESC
+	LIMIT ` + arg(sq.Limit) + ` OFFSET ` + arg(sq.Offset) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var p PostSearchResult
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			pq.Array(&p.MediaIDs),
+			&p.Visibility,
+			&p.User.Username,
+			&p.CommentCount,
+			&p.Rank,
+			&p.TitleHighlight,
+			&p.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		p.User.ID = p.UserID
+		p.TitleHighlight = markHighlight(p.TitleHighlight)
+		p.Highlight = markHighlight(p.Highlight)
+		results = append(results, p)
+	}
+
+	return results, rows.Err()
+}
+
+// SearchComments matches comment content on posts the viewer may see, skipping comments of users
+// blocked with the viewer. The tag filter applies to the commented post.
+func (s *SearchStore) SearchComments(ctx context.Context, sq SearchQuery) ([]CommentSearchResult, error) {
+	args := []any{sq.Language, sq.Query}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	viewer := arg(sq.ViewerID)
+
+	query := `
+	SELECT
+		c.id, c.post_id, c.user_id, c.content, c.created_at,
+		u.username,
+		ts_rank(c.search_vector, q.query) AS rank,
+		ts_headline(c.language, c.content, q.query, ` + arg(headlineOptions) + `) AS highlight
+	FROM comments c
+	JOIN posts p ON p.id = c.post_id
+	JOIN users u ON u.id = c.user_id
+	JOIN users pu ON pu.id = p.user_id
+	CROSS JOIN websearch_to_tsquery($1::regconfig, $2) AS q(query)
+	WHERE
+		c.search_vector @@ q.query AND
+		` + postVisible(viewer, "pu") + ` AND ` + notBlocked(viewer, "c.user_id") + ` AND
+		` + searchFilters(sq, "c.user_id", "p.tags", "c.created_at", arg) + `
+	ORDER BY rank DESC, c.id DESC
+	LIMIT ` + arg(sq.Limit) + ` OFFSET ` + arg(sq.Offset) + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CommentSearchResult{}
+	for rows.Next() {
+		var c CommentSearchResult
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.User.Username,
+			&c.Rank,
+			&c.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		c.User.ID = c.UserID
+		c.Highlight = markHighlight(c.Highlight)
+		results = append(results, c)
+	}
+
+	return results, rows.Err()
+}
+
+// SearchUsers matches usernames by trigram similarity or substring, skipping users blocked with the viewer
+func (s *SearchStore) SearchUsers(ctx context.Context, sq SearchQuery) ([]UserSearchResult, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, similarity(u.username, $1) AS rank
+		FROM users u
+		WHERE u.is_active = true AND (u.username % $1 OR u.username ILIKE '%' || $1 || '%') AND
+			` + notBlocked("$4", "u.id") + `
+		ORDER BY rank DESC, u.id
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, sq.Query, sq.Limit, sq.Offset, sq.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.CreatedAt, &u.Rank); err != nil {
+			return nil, err
+		}
+		results = append(results, u)
+	}
+
+	return results, rows.Err()
+}
+
+// searchFilters returns the author, tag and time conditions on the given columns
+func searchFilters(sq SearchQuery, authorCol, tagsCol, createdCol string, arg func(any) string) string {
+	author, tag, since, until := arg(sq.AuthorID), arg(sq.Tag), arg(sq.Since), arg(sq.Until)
+
+	return `(` + author + `::bigint = 0 OR ` + authorCol + ` = ` + author + `) AND
+		(` + tag + ` = '' OR ` + tagsCol + ` @> ARRAY[` + tag + `]::varchar[]) AND
+		(` + since + `::timestamptz IS NULL OR ` + createdCol + ` >= ` + since + `) AND
+		(` + until + `::timestamptz IS NULL OR ` + createdCol + ` < ` + until + `)`
+}
+
+// markHighlight escapes a ts_headline snippet and marks the matches with <mark>
+func markHighlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+func (sq SearchQuery) Parse(r *http.Request) (SearchQuery, error) {
+	qs := r.URL.Query()
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+
+	types := qs.Get("type")
+	if types != "" {
+		sq.Types = strings.Split(types, ",")
+	}
+
+	if author := qs.Get("author"); author != "" {
+		id, err := strconv.ParseInt(author, 10, 64)
+		if err != nil || id < 1 {
+			return sq, errors.New("invalid author")
+		}
+		sq.AuthorID = id
+	}
+
+	sq.Tag = qs.Get("tag")
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, errors.New("invalid limit")
+		}
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, errors.New("invalid offset")
+		}
+		sq.Offset = o
+	}
+
+	now := time.Now()
+
+	if since := qs.Get("since"); since != "" {
+		t, err := parseFeedTime(since, now)
+		if err != nil {
+			return sq, fmt.Errorf("invalid since: %w", err)
+		}
+		sq.Since = &t
+	}
+
+	if until := qs.Get("until"); until != "" {
+		t, err := parseFeedTime(until, now)
+		if err != nil {
+			return sq, fmt.Errorf("invalid until: %w", err)
+		}
+		sq.Until = &t
+	}
+
+	if sq.Since != nil && sq.Until != nil && !sq.Since.Before(*sq.Until) {
+		return sq, errors.New("since must be before until")
+	}
+
+	return sq, nil
+}
@@ -19,7 +19,14 @@ type Storage struct {
 		GetByID(context.Context, int64) (*Post, error)
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
+		IsVisible(ctx context.Context, postID, viewerID int64) (bool, error)
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetUserPosts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetFeedByIDs(ctx context.Context, viewerID int64, postIDs, authorIDs []int64, minID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetTimeline(ctx context.Context, userID int64, limit int) ([]int64, error)
+		GetRankedFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery, ranking FeedRanking) ([]PostWithMetadata, error)
+		GetExploreFeed(ctx context.Context, viewerID int64, fq PaginatedFeedQuery, ranking FeedRanking) ([]PostWithMetadata, error)
+		GetTrendingTags(ctx context.Context, since time.Time, limit int) ([]TagCount, error)
 	}
 	Users interface {
 		GetByID(context.Context, int64) (*User, error)
@@ -28,18 +35,96 @@ type Storage struct {
 		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, user *User) error
+		Reinvite(ctx context.Context, email, token string, exp time.Duration) (*User, error)
+		DeleteExpiredInvitations(context.Context) (int64, error)
+		DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error)
+		CreateWithIdentity(context.Context, *User, *Identity) error
+		UpdateProfile(context.Context, *User) error
+		CreateEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration) error
+		ConfirmEmailChange(ctx context.Context, token string) (int64, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		List(ctx context.Context, postID, viewerID int64, q CommentListQuery) ([]Comment, error)
+		GetByID(ctx context.Context, id, viewerID int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(ctx context.Context, id int64) error
 	}
 	Followers interface {
 		Follow(ctx context.Context, followedID, userID int64) error
 		Unfollow(ctx context.Context, followedID, userID int64) error
+		GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error)
+		GetPopularFollowed(ctx context.Context, followerID int64, minFollowers int) ([]int64, error)
+		GetFollowers(ctx context.Context, userID, viewerID int64, q FollowListQuery) ([]FollowEntry, error)
+		GetFollowing(ctx context.Context, userID, viewerID int64, q FollowListQuery) ([]FollowEntry, error)
+		GetStats(ctx context.Context, userID, viewerID int64) (*FollowStats, error)
+		Request(ctx context.Context, followerID, userID int64) error
+		AcceptRequest(ctx context.Context, userID, requesterID int64) error
+		AcceptAllRequests(ctx context.Context, userID int64) ([]int64, error)
+		DeleteRequest(ctx context.Context, userID, requesterID int64) error
+		GetRequests(ctx context.Context, userID int64, q FollowListQuery) ([]FollowEntry, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		GetByToken(context.Context, string) (*RefreshToken, error)
+		Rotate(ctx context.Context, usedID int64, next *RefreshToken) error
+		RevokeFamily(ctx context.Context, familyID string) error
+		RevokeByUserID(context.Context, int64) error
+	}
+	RevokedTokens interface {
+		Revoke(ctx context.Context, jti string, expiry time.Time) error
+		IsRevoked(ctx context.Context, jti string) (bool, error)
+		RevokeUserTokens(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error
+		UserTokensRevokedAt(ctx context.Context, userID int64) (time.Time, error)
+	}
+	APITokens interface {
+		Create(context.Context, *APIToken) error
+		GetByUserID(context.Context, int64) ([]APIToken, error)
+		GetByToken(context.Context, string) (*APIToken, error)
+		Touch(context.Context, int64) error
+		Delete(ctx context.Context, id, userID int64) error
+		DeleteByUserID(context.Context, int64) error
+	}
+	MFA interface {
+		GetByUserID(context.Context, int64) (*UserMFA, error)
+		CreatePending(ctx context.Context, userID int64, secret string) error
+		Confirm(ctx context.Context, userID, step int64, recoveryCodes []string) error
+		UseStep(ctx context.Context, userID, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+		Delete(context.Context, int64) error
+	}
+	Identities interface {
+		GetUserID(ctx context.Context, provider, subject string) (int64, error)
+		Create(context.Context, *Identity) error
+	}
+	OIDCStates interface {
+		Create(context.Context, *OIDCState) error
+		Consume(context.Context, string) (*OIDCState, error)
+	}
+	Search interface {
+		SearchPosts(context.Context, SearchQuery) ([]PostSearchResult, error)
+		SearchComments(context.Context, SearchQuery) ([]CommentSearchResult, error)
+		SearchUsers(context.Context, SearchQuery) ([]UserSearchResult, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		Mute(ctx context.Context, muterID, mutedID int64) error
+		Unmute(ctx context.Context, muterID, mutedID int64) error
+		IsBlocked(ctx context.Context, userID, otherID int64) (bool, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(context.Context, string) (*Media, error)
+		GetByIDs(context.Context, []string) ([]Media, error)
+		IsVisible(ctx context.Context, id string, viewerID int64) (bool, error)
+		Delete(ctx context.Context, id string, userID int64) error
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
@@ -59,6 +144,33 @@ func NewStorage(db *sql.DB) Storage {
 		Roles: &RoleStore{
 			db,
 		},
+		RefreshTokens: &RefreshTokenStore{
+			db,
+		},
+		RevokedTokens: &RevokedTokenStore{
+			db,
+		},
+		APITokens: &APITokenStore{
+			db,
+		},
+		MFA: &MFAStore{
+			db,
+		},
+		Identities: &IdentityStore{
+			db,
+		},
+		OIDCStates: &OIDCStateStore{
+			db,
+		},
+		Search: &SearchStore{
+			db,
+		},
+		Blocks: &BlockStore{
+			db,
+		},
+		Media: &MediaStore{
+			db,
+		},
 	}
 }
 
@@ -25,6 +25,21 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	UserProfile
+	UsernameChangedAt *time.Time `json:"-"`
+}
+
+// UserProfile is the public profile a user edits themselves
+type UserProfile struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Location    string `json:"location"`
+	Website     string `json:"website"`
+	AvatarURL   string `json:"avatar_url"`
+	// Set when the avatar is an uploaded image
+	AvatarMediaID *string `json:"avatar_media_id"`
+	// Posts of private users are only visible to approved followers
+	IsPrivate bool `json:"is_private"`
 }
 
 type password struct {
@@ -95,7 +110,8 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, created_at, roles.*
+		SELECT users.id, username, email, password, created_at, roles.*,
+			display_name, bio, location, website, avatar_url, avatar_media_id, is_private, username_changed_at
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1 AND is_active = true
@@ -119,6 +135,14 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 		&user.Role.Name,
 		&user.Role.Level,
 		&user.Role.Description,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Location,
+		&user.Website,
+		&user.AvatarURL,
+		&user.AvatarMediaID,
+		&user.IsPrivate,
+		&user.UsernameChangedAt,
 	)
 
 	if err != nil {
@@ -150,6 +174,24 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 	})
 }
 
+// CreateWithIdentity creates an active user for a first-time external login, linked to its identity
+func (s *UserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// The provider has already verified the user, so no invitation is needed
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return createIdentity(ctx, tx, identity)
+	})
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// 1. Find user's token
@@ -173,6 +215,213 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	})
 }
 
+// Reinvite replaces the invitations of an inactive user with a new one and returns that user
+func (s *UserStore) Reinvite(ctx context.Context, email, token string, invitationExp time.Duration) (*User, error) {
+	user := &User{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, username, email, created_at, is_active FROM users
+			WHERE email = $1 AND is_active = false
+			FOR UPDATE
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, email).Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.CreatedAt,
+			&user.IsActive,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_invitations WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteUnactivated removes users that never activated their account and have no valid invitation left
+func (s *UserStore) DeleteUnactivated(ctx context.Context, createdBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM users u
+		WHERE u.is_active = false AND u.created_at < $1 AND NOT EXISTS (
+			SELECT 1 FROM user_invitations ui WHERE ui.user_id = u.id AND ui.expiry > $2
+		)
+		RETURNING u.id
+	`
+
+	var deleted int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, createdBefore, time.Now())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := s.deleteUserInvitations(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		deleted = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// Only the latest reset link stays valid
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword sets the password of user to the owner of the reset token and fills in user.ID
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. Find user's token
+		userID, err := s.getUserIDFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user.ID = userID
+
+		// 2. Update password
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// 3. Clean password resets
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *UserStore) getUserIDFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (int64, error) {
+	query := `
+		SELECT pr.user_id
+		FROM password_resets pr
+		JOIN users u ON u.id = pr.user_id
+		WHERE pr.token = $1 AND pr.expiry > $2 AND u.is_active = true
+	`
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.created_at, u.is_active
@@ -280,7 +529,10 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, id int64) error {
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at FROM users
+		SELECT users.id, username, email, password, created_at, roles.*,
+			display_name, bio, location, website, avatar_url, avatar_media_id, is_private, username_changed_at
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
 		WHERE email = $1 AND is_active = true
 	`
 
@@ -294,6 +546,18 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Location,
+		&user.Website,
+		&user.AvatarURL,
+		&user.AvatarMediaID,
+		&user.IsPrivate,
+		&user.UsernameChangedAt,
 	)
 	if err != nil {
 		switch err {
@@ -306,3 +570,136 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 
 	return user, nil
 }
+
+// UpdateProfile saves the username and profile of user
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users
+		SET username = $1, display_name = $2, bio = $3, location = $4, website = $5, avatar_url = $6,
+			avatar_media_id = $7, is_private = $8, username_changed_at = $9
+		WHERE id = $10 AND is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(
+		ctx,
+		query,
+		user.Username,
+		user.DisplayName,
+		user.Bio,
+		user.Location,
+		user.Website,
+		user.AvatarURL,
+		user.AvatarMediaID,
+		user.IsPrivate,
+		user.UsernameChangedAt,
+		user.ID,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateEmailChange stores a pending change of the user's email, replacing earlier ones
+func (s *UserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// Only the latest confirmation link stays valid
+		if err := s.deleteEmailChanges(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO email_changes (token, user_id, new_email, expiry) VALUES ($1, $2, $3, $4)`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, token, userID, newEmail, time.Now().Add(exp))
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ConfirmEmailChange switches the email of the owner of the token and returns their ID
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. Find the pending change
+		query := `
+			SELECT ec.user_id, ec.new_email
+			FROM email_changes ec
+			JOIN users u ON u.id = ec.user_id
+			WHERE ec.token = $1 AND ec.expiry > $2 AND u.is_active = true
+		`
+
+		hash := sha256.Sum256([]byte(token))
+		hashToken := hex.EncodeToString(hash[:])
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var newEmail string
+		err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&userID, &newEmail)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// 2. Switch the email
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET email = $1 WHERE id = $2`, newEmail, userID); err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		// 3. Clean email changes
+		return s.deleteEmailChanges(ctx, tx, userID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func (s *UserStore) deleteEmailChanges(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
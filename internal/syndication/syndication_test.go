@@ -0,0 +1,108 @@
+package syndication
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFeed() *Feed {
+	return &Feed{
+		ID:       "http://example.com/v1/users/1",
+		Title:    "Posts by alice & bob",
+		Link:     "http://example.com/v1/users/1",
+		SelfLink: "http://example.com/v1/users/1/feed.atom",
+		Updated:  time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+		Entries: []Entry{{
+			ID:         "http://example.com/v1/posts/7",
+			Title:      "<Hello>",
+			Link:       "http://example.com/v1/posts/7",
+			Content:    "First post",
+			Author:     "alice",
+			Categories: []string{"golang"},
+			Published:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Updated:    time.Date(2025, 1, 2, 10, 0, 0, 500, time.UTC),
+			Version:    1,
+		}},
+	}
+}
+
+func TestFeed_LastModified(t *testing.T) {
+	assert.Equal(t, time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC), testFeed().LastModified())
+
+	empty := &Feed{Updated: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}
+	assert.Equal(t, empty.Updated, empty.LastModified())
+}
+
+func TestFeed_ETag(t *testing.T) {
+	feed := testFeed()
+	etag := feed.ETag("atom")
+
+	assert.Equal(t, etag, testFeed().ETag("atom"))
+	assert.NotEqual(t, etag, feed.ETag("rss"))
+
+	feed.Entries[0].Version++
+	assert.NotEqual(t, etag, feed.ETag("atom"))
+}
+
+func TestFeed_Atom(t *testing.T) {
+	body, err := testFeed().Atom()
+	require.NoError(t, err)
+
+	var doc atomFeed
+	require.NoError(t, xml.Unmarshal(body, &doc))
+
+	assert.Equal(t, "Posts by alice & bob", doc.Title)
+	assert.Equal(t, "2025-01-02T10:00:00Z", doc.Updated)
+	require.Len(t, doc.Entries, 1)
+	assert.Equal(t, "<Hello>", doc.Entries[0].Title)
+	assert.Equal(t, "2025-01-01T00:00:00Z", doc.Entries[0].Published)
+	assert.Equal(t, "golang", doc.Entries[0].Categories[0].Term)
+}
+
+func TestFeed_RSS(t *testing.T) {
+	body, err := testFeed().RSS()
+	require.NoError(t, err)
+
+	var doc struct {
+		DCNS    string `xml:"xmlns dc,attr"`
+		Channel struct {
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				GUID    string `xml:"guid"`
+				PubDate string `xml:"pubDate"`
+				Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(body, &doc))
+
+	assert.Equal(t, "http://purl.org/dc/elements/1.1/", doc.DCNS)
+
+	assert.Equal(t, "Thu, 02 Jan 2025 10:00:00 +0000", doc.Channel.LastBuildDate)
+	require.Len(t, doc.Channel.Items, 1)
+	assert.Equal(t, "http://example.com/v1/posts/7", doc.Channel.Items[0].GUID)
+	assert.Equal(t, "Wed, 01 Jan 2025 00:00:00 +0000", doc.Channel.Items[0].PubDate)
+	assert.Equal(t, "alice", doc.Channel.Items[0].Creator)
+}
+
+func TestFeed_Empty(t *testing.T) {
+	feed := &Feed{ID: "http://example.com/v1/tags/go", Title: "Posts tagged go"}
+
+	atom, err := feed.Atom()
+	require.NoError(t, err)
+
+	var atomDoc atomFeed
+	require.NoError(t, xml.Unmarshal(atom, &atomDoc))
+
+	updated, err := time.Parse(time.RFC3339, atomDoc.Updated)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), updated, time.Minute)
+
+	rss, err := feed.RSS()
+	require.NoError(t, err)
+	assert.NotContains(t, string(rss), "lastBuildDate")
+}